@@ -113,6 +113,55 @@ const (
 	OpClosure
 	// OpGetFree retrieve the values in the free field and put them on the stack.
 	OpGetFree
+	// OpNull push object.NativeNull onto the stack, it's what the null literal compiles to.
+	OpNull
+	// OpJumpNull is used by the null-safe index lhs?[index]:
+	// if the value on top of the stack is null, jump to the operand and leave the null on the stack as the result;
+	// otherwise, fall through without touching the stack so that the index can be applied to it.
+	OpJumpNull
+	// OpJumpNotNull is used by the null-coalescing operator lhs ?? rhs:
+	// if the value on top of the stack is not null, jump to the operand and leave it on the stack as the result;
+	// otherwise, pop the null off the stack and fall through to evaluate the rhs.
+	OpJumpNotNull
+	// OpArrayConcat is used by array literals containing spread elements like [...a, x, y, ...b]:
+	// the plain elements between the spreads are collected by OpArray, so the literal above is compiled into
+	// a, OpArray 2 (for x and y), b and then OpArrayConcat 3,
+	// which pops the N arrays off the stack and pushes their concatenation.
+	OpArrayConcat
+	// OpHashMerge is used by hash literals containing spreads like {...defaults, "k": v}:
+	// it pops the N hashes off the stack and pushes a new hash where the later hashes override the earlier ones.
+	OpHashMerge
+	// OpCallSpread is used by calls containing spread arguments like f(...args):
+	// the arguments are compiled into a single array exactly like an array literal,
+	// when executed the array is popped and its elements are pushed back as the arguments of an ordinary call.
+	OpCallSpread
+	// OpIter pop an iterable (array or hash) off the stack and push an *object.Iterator over it.
+	OpIter
+	// OpIterNext drives the loop of a comprehension, the iterator is sitting on top of the stack:
+	// if the iterator has a next element, push it onto the stack and fall through into the body of the loop;
+	// otherwise, pop the exhausted iterator and jump to the operand, which is the end of the loop.
+	OpIterNext
+	// OpDestructure pop an array off the stack and push its first N elements in order, null for the missing ones,
+	// it is followed by N OpSetLocal instructions binding the targets of `for [k, v] in pairs` in reverse order.
+	OpDestructure
+	// OpArrayAppend pop a value and then an array off the stack, and append the value to the array in place.
+	// It is only used on the fresh array built by a comprehension, so it is never observed by user code.
+	OpArrayAppend
+	// OpHashSet pop a value, a key and then a hash off the stack, and set the pair on the hash in place.
+	// Like OpArrayAppend, it is only used on the fresh hash built by a comprehension.
+	OpHashSet
+	// OpSet pop an array off the stack and push a set of its elements, a set literal is compiled into an array
+	// exactly like an array literal, spreads included, followed by OpSet.
+	OpSet
+	// OpIn pop a collection and then an element off the stack, and push whether the element is in the collection.
+	OpIn
+	// OpYield pop a value off the stack and suspend the generator, the value is the next element of its iterator,
+	// and the generator resumes at the next instruction when the element after is asked for.
+	// `yield ...iterable` is compiled into a loop of OpIterNext and OpYield, like a comprehension.
+	OpYield
+	// OpDelegate pop an iterator off the stack and hand the iterator of the generator over to it, it's followed by
+	// OpReturn since it's only emitted for `yield ...iterable` in tail position, see ast.YieldStatement.Tail.
+	OpDelegate
 )
 
 var definitions = map[Opcode]*Definition{
@@ -158,6 +207,21 @@ var definitions = map[Opcode]*Definition{
 	OpGetBuiltIn:    {"OpGetBuiltIn", "", []int{1}},
 	OpClosure:       {"OpClosure", "", []int{2, 1}},
 	OpGetFree:       {"OpGetFree", "", []int{1}},
+	OpNull:          {"OpNull", "", []int{}},
+	OpJumpNull:      {"OpJumpNull", "", []int{2}},
+	OpJumpNotNull:   {"OpJumpNotNull", "", []int{2}},
+	OpArrayConcat:   {"OpArrayConcat", "", []int{2}},
+	OpHashMerge:     {"OpHashMerge", "", []int{2}},
+	OpCallSpread:    {"OpCallSpread", "", []int{}},
+	OpIter:          {"OpIter", "", []int{}},
+	OpIterNext:      {"OpIterNext", "", []int{2}},
+	OpDestructure:   {"OpDestructure", "", []int{1}},
+	OpArrayAppend:   {"OpArrayAppend", "", []int{}},
+	OpHashSet:       {"OpHashSet", "", []int{}},
+	OpSet:           {"OpSet", "", []int{}},
+	OpIn:            {"OpIn", "in", []int{}},
+	OpYield:         {"OpYield", "", []int{}},
+	OpDelegate:      {"OpDelegate", "", []int{}},
 }
 
 // Instructions the instructions are a series of bytes and a single instruction
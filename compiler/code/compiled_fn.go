@@ -17,6 +17,10 @@ const (
 type CompiledFunction struct {
 	Instructions   Instructions
 	NumOfLocalVars int
+	// NumOfParameters the number of arguments a call must pass, the parameters are the first local variables
+	NumOfParameters int
+	// Generator a call returns an iterator over the values yielded by the function, see ast.FnLiteral.Generator
+	Generator bool
 }
 
 func (c *CompiledFunction) Type() object.ObjType {
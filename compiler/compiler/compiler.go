@@ -7,11 +7,14 @@ import (
 	"0x822a5b87/monkey/interpreter/object"
 	"0x822a5b87/monkey/interpreter/token"
 	"fmt"
-	"sort"
 )
 
 type instructionIndex int
 
+// comprehensionAccumulator the name of the hidden local holding the array or hash built by a comprehension,
+// it can never collide with an identifier of the source code.
+const comprehensionAccumulator = "@accumulator"
+
 func (i instructionIndex) add(delta int) int {
 	return int(i) + delta
 }
@@ -77,6 +80,21 @@ func (c *Compiler) ByteCode() *ByteCode {
 	}
 }
 
+// DefineGlobal define a global binding set by the host rather than by a let statement,
+// the binding is kept if it's already defined, it returns the index of the binding in the globals of the vm
+func (c *Compiler) DefineGlobal(name string) int {
+	if s, ok := c.symbolTable.store[name]; ok && s.Scope == GlobalScope {
+		return s.Index
+	}
+	return c.symbolTable.Define(name).Index
+}
+
+// ResolveGlobal the global binding or the built-in function of the name
+func (c *Compiler) ResolveGlobal(name string) (Symbol, bool) {
+	s, ok := c.symbolTable.store[name]
+	return s, ok
+}
+
 func (c *Compiler) compileProgram(program *ast.Program) error {
 	for _, stmt := range program.Statements {
 		err := c.Compile(stmt)
@@ -95,8 +113,12 @@ func (c *Compiler) compileStatement(statement ast.Statement) error {
 		return c.compileBlockStatement(stmt)
 	case *ast.LetStatement:
 		return c.compileLetStatement(stmt)
+	case *ast.InfixDeclaration:
+		return c.compileLetStatement(stmt.Lower())
 	case *ast.ReturnStatement:
 		return c.compileReturnStatement(stmt)
+	case *ast.YieldStatement:
+		return c.compileYieldStatement(stmt)
 	}
 
 	return common.NewErrUnsupportedCompilingNode(statement.String())
@@ -130,6 +152,17 @@ func (c *Compiler) compileBlockStatement(statement *ast.BlockStatement) error {
 }
 
 func (c *Compiler) compileLetStatement(statement *ast.LetStatement) error {
+	// a global function is bound before its body is compiled, so that it can call itself by its name
+	if _, ok := statement.Value.(*ast.FnLiteral); ok && c.symbolTable.Outer == nil {
+		symbol := c.symbolTable.Define(statement.Name.Value)
+		err := c.Compile(statement.Value)
+		if err != nil {
+			return err
+		}
+		c.emitSetScope(symbol)
+		return nil
+	}
+
 	err := c.Compile(statement.Value)
 	if err != nil {
 		return err
@@ -151,12 +184,50 @@ func (c *Compiler) compileReturnStatement(statement *ast.ReturnStatement) error
 	return nil
 }
 
+// compileYieldStatement a spread in tail position hands over with OpDelegate and returns, any other spread is
+// a loop yielding the elements one by one:
+//
+//	<iterable>
+//	OpIter
+//	loop: OpIterNext end
+//	OpYield
+//	OpJump loop
+//	end:
+func (c *Compiler) compileYieldStatement(statement *ast.YieldStatement) error {
+	err := c.Compile(statement.Value)
+	if err != nil {
+		return err
+	}
+	if !statement.Spread {
+		c.emit(code.OpYield)
+		return nil
+	}
+
+	c.emit(code.OpIter)
+	if statement.Tail {
+		c.emit(code.OpDelegate)
+		c.emit(code.OpReturn)
+		return nil
+	}
+	loopStart := c.currentInstructions().Len()
+	iterNextIndex := c.emit(code.OpIterNext, 0)
+	c.emit(code.OpYield)
+	c.emit(code.OpJump, loopStart-1)
+	c.replaceOperand(iterNextIndex, c.currentInstructions().Len()-1)
+	return nil
+}
+
 func (c *Compiler) compileExpression(expr ast.Expression) error {
 	switch expr := expr.(type) {
 	case *ast.IntegerLiteral:
 		return c.compileIntegerLiteral(expr)
+	case *ast.BigIntegerLiteral:
+		return c.compileBigIntegerLiteral(expr)
 	case *ast.BooleanExpression:
 		return c.compileBooleanExpression(expr)
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
+		return nil
 	case *ast.InfixExpression:
 		return c.compileInfixExpression(expr)
 	case *ast.PrefixExpression:
@@ -169,6 +240,8 @@ func (c *Compiler) compileExpression(expr ast.Expression) error {
 		return c.compileStringLiteral(expr)
 	case *ast.ArrayLiteral:
 		return c.compileArrayLiteral(expr)
+	case *ast.SetLiteral:
+		return c.compileSetLiteral(expr)
 	case *ast.HashExpression:
 		return c.compileHashExpression(expr)
 	case *ast.IndexExpression:
@@ -177,7 +250,10 @@ func (c *Compiler) compileExpression(expr ast.Expression) error {
 		return c.compileFnLiteral(expr)
 	case *ast.CallExpression:
 		return c.compileCallExpression(expr)
-
+	case *ast.ArrayComprehension:
+		return c.compileArrayComprehension(expr)
+	case *ast.HashComprehension:
+		return c.compileHashComprehension(expr)
 	}
 	return common.NewErrUnsupportedCompilingNode(expr.String())
 }
@@ -189,6 +265,12 @@ func (c *Compiler) compileIntegerLiteral(literal *ast.IntegerLiteral) error {
 	return nil
 }
 
+func (c *Compiler) compileBigIntegerLiteral(literal *ast.BigIntegerLiteral) error {
+	index := c.constants.AddConstant(object.NewBigInteger(literal.Value))
+	c.emit(code.OpConstant, index.IntValue())
+	return nil
+}
+
 func (c *Compiler) compileBooleanExpression(literal *ast.BooleanExpression) error {
 	if literal.Value {
 		c.emit(code.OpTrue)
@@ -199,6 +281,14 @@ func (c *Compiler) compileBooleanExpression(literal *ast.BooleanExpression) erro
 }
 
 func (c *Compiler) compileInfixExpression(infixExpr *ast.InfixExpression) error {
+	if infixExpr.Operator == string(token.NullCoalescing) {
+		return c.compileNullCoalescing(infixExpr)
+	}
+
+	if infixExpr.IsUserDefined() {
+		return c.compileCallExpression(infixExpr.LowerToCall())
+	}
+
 	err := c.compileExpression(infixExpr.Lhs)
 	if err != nil {
 		return err
@@ -210,6 +300,22 @@ func (c *Compiler) compileInfixExpression(infixExpr *ast.InfixExpression) error
 	return c.compileInfixOperator(infixExpr.Operator)
 }
 
+// compileNullCoalescing the rhs is skipped by OpJumpNotNull as long as the lhs is not null
+func (c *Compiler) compileNullCoalescing(infixExpr *ast.InfixExpression) error {
+	err := c.compileExpression(infixExpr.Lhs)
+	if err != nil {
+		return err
+	}
+
+	jumpNotNullIndex := c.emit(code.OpJumpNotNull, 0)
+	err = c.compileExpression(infixExpr.Rhs)
+	if err != nil {
+		return err
+	}
+	c.replaceOperand(jumpNotNullIndex, c.currentInstructions().Len()-1)
+	return nil
+}
+
 func (c *Compiler) compilePrefixExpression(prefixExpr *ast.PrefixExpression) error {
 	err := c.compileExpression(prefixExpr.Right)
 	if err != nil {
@@ -268,37 +374,111 @@ func (c *Compiler) compileStringLiteral(stringLiteral *ast.StringLiteral) error
 }
 
 func (c *Compiler) compileArrayLiteral(arrayLiteral *ast.ArrayLiteral) error {
-	for _, element := range arrayLiteral.Elements {
-		err := c.Compile(element)
+	return c.compileElements(arrayLiteral.Elements)
+}
+
+func (c *Compiler) compileSetLiteral(setLiteral *ast.SetLiteral) error {
+	err := c.compileElements(setLiteral.Elements)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpSet)
+	return nil
+}
+
+// compileElements compile the expressions into a single array on top of the stack,
+// the plain elements between the spreads are grouped by OpArray and then all the arrays are joined with OpArrayConcat.
+func (c *Compiler) compileElements(elements []ast.Expression) error {
+	if !hasSpread(elements) {
+		for _, element := range elements {
+			err := c.Compile(element)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(elements))
+		return nil
+	}
+
+	numOfArrays, numOfPlainElements := 0, 0
+	for _, element := range elements {
+		spread, ok := element.(*ast.SpreadExpression)
+		if !ok {
+			err := c.Compile(element)
+			if err != nil {
+				return err
+			}
+			numOfPlainElements++
+			continue
+		}
+
+		if numOfPlainElements > 0 {
+			c.emit(code.OpArray, numOfPlainElements)
+			numOfArrays++
+			numOfPlainElements = 0
+		}
+		err := c.Compile(spread.Value)
 		if err != nil {
 			return err
 		}
+		numOfArrays++
+	}
+	if numOfPlainElements > 0 {
+		c.emit(code.OpArray, numOfPlainElements)
+		numOfArrays++
 	}
-	c.emit(code.OpArray, len(arrayLiteral.Elements))
+	c.emit(code.OpArrayConcat, numOfArrays)
 	return nil
 }
 
-func (c *Compiler) compileHashExpression(hashExpression *ast.HashExpression) error {
-	// sort Paris for test
-	pairs := make([]ExpressionPair, 0, len(hashExpression.Pairs))
-	for key, value := range hashExpression.Pairs {
-		pairs = append(pairs, ExpressionPair{key, value})
+func hasSpread(elements []ast.Expression) bool {
+	for _, element := range elements {
+		if _, ok := element.(*ast.SpreadExpression); ok {
+			return true
+		}
 	}
-	sort.Slice(pairs, func(i, j int) bool {
-		return pairs[i].Key.String() < pairs[j].Key.String()
-	})
+	return false
+}
 
-	for _, pair := range pairs {
-		err := c.Compile(pair.Key)
-		if err != nil {
-			return err
+// compileHashExpression compile the pairs in the order they are written,
+// the plain pairs between the spreads are grouped by OpHash and then all the hashes are merged with OpHashMerge.
+func (c *Compiler) compileHashExpression(hashExpression *ast.HashExpression) error {
+	numOfHashes, numOfPlainPairs := 0, 0
+	for _, pair := range hashExpression.Pairs {
+		if pair.Spread == nil {
+			err := c.Compile(pair.Key)
+			if err != nil {
+				return err
+			}
+			err = c.Compile(pair.Value)
+			if err != nil {
+				return err
+			}
+			numOfPlainPairs++
+			continue
 		}
-		err = c.Compile(pair.Value)
+
+		if numOfPlainPairs > 0 {
+			c.emit(code.OpHash, numOfPlainPairs*2)
+			numOfHashes++
+			numOfPlainPairs = 0
+		}
+		err := c.Compile(pair.Spread.Value)
 		if err != nil {
 			return err
 		}
+		numOfHashes++
+	}
+
+	if numOfHashes == 0 {
+		c.emit(code.OpHash, numOfPlainPairs*2)
+		return nil
+	}
+	if numOfPlainPairs > 0 {
+		c.emit(code.OpHash, numOfPlainPairs*2)
+		numOfHashes++
 	}
-	c.emit(code.OpHash, len(hashExpression.Pairs)*2)
+	c.emit(code.OpHashMerge, numOfHashes)
 	return nil
 }
 
@@ -307,11 +487,124 @@ func (c *Compiler) compileIndexExpression(indexExpr *ast.IndexExpression) error
 	if err != nil {
 		return err
 	}
+
+	if !indexExpr.Optional {
+		err = c.Compile(indexExpr.Index)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+		return nil
+	}
+
+	// lhs?[index] : skip both the index and OpIndex when lhs is null
+	jumpNullIndex := c.emit(code.OpJumpNull, 0)
 	err = c.Compile(indexExpr.Index)
 	if err != nil {
 		return err
 	}
 	c.emit(code.OpIndex)
+	c.replaceOperand(jumpNullIndex, c.currentInstructions().Len()-1)
+	return nil
+}
+
+func (c *Compiler) compileArrayComprehension(comprehension *ast.ArrayComprehension) error {
+	return c.compileComprehension(comprehension.Clause, code.OpArray, func() error {
+		err := c.Compile(comprehension.Element)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpArrayAppend)
+		return nil
+	})
+}
+
+func (c *Compiler) compileHashComprehension(comprehension *ast.HashComprehension) error {
+	return c.compileComprehension(comprehension.Clause, code.OpHash, func() error {
+		err := c.Compile(comprehension.Key)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(comprehension.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpHashSet)
+		return nil
+	})
+}
+
+// compileComprehension compile a comprehension into a closure which is called immediately,
+// so that the targets are scoped to the comprehension and the accumulator lives in a local slot.
+// Inside the closure, the elements are consumed by a loop instead of recursion, so it only takes one frame:
+//
+//	OpArray 0 / OpHash 0
+//	OpSetLocal accumulator
+//	<iterable>
+//	OpIter
+//	loop: OpIterNext end
+//	OpSetLocal target                            (or OpDestructure N and N * OpSetLocal)
+//	<condition>
+//	OpJumpNotTruthy loop
+//	OpGetLocal accumulator
+//	<body>                                       (ends with OpArrayAppend / OpHashSet)
+//	OpJump loop
+//	end: OpGetLocal accumulator
+//	OpReturnValue
+func (c *Compiler) compileComprehension(clause *ast.ComprehensionClause, newAccumulator code.Opcode, compileBody func() error) error {
+	c.enterScope()
+
+	accumulator := c.symbolTable.Define(comprehensionAccumulator)
+	c.emit(newAccumulator, 0)
+	c.emitSetScope(accumulator)
+
+	// the iterable is compiled before the targets are defined, so that the x of iterable in [x for x in x] refers to the outer x
+	err := c.Compile(clause.Iterable)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	loopStart := c.currentInstructions().Len()
+	iterNextIndex := c.emit(code.OpIterNext, 0)
+
+	targets := make([]Symbol, 0, len(clause.Targets))
+	for _, target := range clause.Targets {
+		targets = append(targets, c.symbolTable.Define(target.Value))
+	}
+	if clause.Destructure {
+		c.emit(code.OpDestructure, len(targets))
+		for i := len(targets) - 1; i >= 0; i-- {
+			c.emitSetScope(targets[i])
+		}
+	} else {
+		c.emitSetScope(targets[0])
+	}
+
+	if clause.Condition != nil {
+		err = c.Compile(clause.Condition)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJumpNotTruthy, loopStart-1)
+	}
+
+	c.emitGetScope(accumulator)
+	err = compileBody()
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loopStart-1)
+	c.replaceOperand(iterNextIndex, c.currentInstructions().Len()-1)
+
+	c.emitGetScope(accumulator)
+	c.emit(code.OpReturnValue)
+
+	err = c.genClosure(0, false)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpCall, 0)
 	return nil
 }
 
@@ -330,7 +623,7 @@ func (c *Compiler) compileFnLiteral(literal *ast.FnLiteral) error {
 
 	c.completeOpReturn(literal)
 
-	return c.genClosure()
+	return c.genClosure(len(literal.Parameters), literal.Generator)
 }
 
 func (c *Compiler) compileCallExpression(call *ast.CallExpression) error {
@@ -339,6 +632,15 @@ func (c *Compiler) compileCallExpression(call *ast.CallExpression) error {
 		return err
 	}
 
+	if hasSpread(call.Arguments) {
+		err = c.compileElements(call.Arguments)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpCallSpread)
+		return nil
+	}
+
 	for _, argument := range call.Arguments {
 		err = c.compileExpression(argument)
 		if err != nil {
@@ -376,6 +678,9 @@ func (c *Compiler) compileInfixOperator(operator string) error {
 	case string(token.NotEq):
 		c.emit(code.OpNotEqual)
 		return nil
+	case token.InOperator:
+		c.emit(code.OpIn)
+		return nil
 	}
 
 	return common.NewErrUnsupportedCompilingNode(fmt.Sprintf(" infix [%s]", operator))
@@ -471,6 +776,12 @@ func (c *Compiler) exitScope() code.Instructions {
 }
 
 func (c *Compiler) completeOpReturn(literal *ast.FnLiteral) {
+	// the value of a generator is never used, and a yield leaves no value on the stack to return
+	if literal.Generator {
+		c.emit(code.OpReturn)
+		return
+	}
+
 	if c.isLastInstructionMatch(code.OpReturnValue) {
 		return
 	}
@@ -488,13 +799,15 @@ func (c *Compiler) completeOpReturn(literal *ast.FnLiteral) {
 	c.emit(code.OpReturnValue)
 }
 
-func (c *Compiler) genClosure() error {
+func (c *Compiler) genClosure(numOfParameters int, generator bool) error {
 	subSymbolTable := c.symbolTable
 	fnInstructions := c.exitScope()
 
 	fnCompiled := &code.CompiledFunction{
-		Instructions:   fnInstructions,
-		NumOfLocalVars: subSymbolTable.numDefinitions,
+		Instructions:    fnInstructions,
+		NumOfLocalVars:  subSymbolTable.numDefinitions,
+		NumOfParameters: numOfParameters,
+		Generator:       generator,
 	}
 
 	// the closure is inside another function
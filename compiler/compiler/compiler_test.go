@@ -6,6 +6,7 @@ import (
 	"0x822a5b87/monkey/interpreter/lexer"
 	"0x822a5b87/monkey/interpreter/object"
 	"0x822a5b87/monkey/interpreter/parser"
+	"math/big"
 	"reflect"
 	"testing"
 )
@@ -73,6 +74,17 @@ func TestIntegerCompiler(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			// a literal out of the range of int64 is a big integer in the constant pool
+			input:             `18446744073709551616 + 1`,
+			expectedConstants: []interface{}{new(big.Int).Lsh(big.NewInt(1), 64), 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 
 	for i, testCase := range testCases {
@@ -291,6 +303,254 @@ if (true) {
 	}
 }
 
+func TestNullSafety(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			input:             `null`,
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `null ?? 1`,
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpNull),           // 0000
+				code.Make(code.OpJumpNotNull, 6), // 0001
+				code.Make(code.OpConstant, 0),    // 0004
+				code.Make(code.OpPop),            // 0007
+			},
+		},
+		{
+			input:             `let a = [1]; a?[0]`,
+			expectedConstants: []any{1, 0},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),  // 0000
+				code.Make(code.OpArray, 1),     // 0003
+				code.Make(code.OpSetGlobal, 0), // 0006
+				code.Make(code.OpGetGlobal, 0), // 0009
+				code.Make(code.OpJumpNull, 18), // 0012
+				code.Make(code.OpConstant, 1),  // 0015
+				code.Make(code.OpIndex),        // 0018
+				code.Make(code.OpPop),          // 0019
+			},
+		},
+		{
+			input:             `let a = {}; a?.name`,
+			expectedConstants: []any{"name"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),      // 0000
+				code.Make(code.OpSetGlobal, 0), // 0003
+				code.Make(code.OpGetGlobal, 0), // 0006
+				code.Make(code.OpJumpNull, 15), // 0009
+				code.Make(code.OpConstant, 0),  // 0012
+				code.Make(code.OpIndex),        // 0015
+				code.Make(code.OpPop),          // 0016
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		runCompilerTest(t, i, &testCase)
+	}
+}
+
+func TestSpread(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			input:             `let a = [1]; [...a, 2, 3, ...a]`,
+			expectedConstants: []any{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArrayConcat, 3),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let a = {}; {...a, 1: 2}`,
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpHashMerge, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let a = [1]; len(...a)`,
+			expectedConstants: []any{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetBuiltIn, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArrayConcat, 1),
+				code.Make(code.OpCallSpread),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		runCompilerTest(t, i, &testCase)
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			input: `fn(xs) { yield ...xs; yield 1 }`,
+			expectedConstants: []any{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0), // 0000
+					code.Make(code.OpIter),        // 0002
+					code.Make(code.OpIterNext, 9), // 0003
+					code.Make(code.OpYield),       // 0006
+					code.Make(code.OpJump, 2),     // 0007
+					code.Make(code.OpConstant, 0), // 0010
+					code.Make(code.OpYield),       // 0013
+					code.Make(code.OpReturn),      // 0014
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(xs) { yield ...xs }`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0), // 0000
+					code.Make(code.OpIter),        // 0002
+					code.Make(code.OpDelegate),    // 0003
+					code.Make(code.OpReturn),      // 0004
+					code.Make(code.OpReturn),      // 0005
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		runCompilerTest(t, i, &testCase)
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			input: `[x for x in []]`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpArray, 0),     // 0000
+					code.Make(code.OpSetLocal, 0),  // 0003
+					code.Make(code.OpArray, 0),     // 0005
+					code.Make(code.OpIter),         // 0008
+					code.Make(code.OpIterNext, 21), // 0009
+					code.Make(code.OpSetLocal, 1),  // 0012
+					code.Make(code.OpGetLocal, 0),  // 0014
+					code.Make(code.OpGetLocal, 1),  // 0016
+					code.Make(code.OpArrayAppend),  // 0018
+					code.Make(code.OpJump, 8),      // 0019
+					code.Make(code.OpGetLocal, 0),  // 0022
+					code.Make(code.OpReturnValue),  // 0024
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let f = fn(xs) { {k: v for [k, v] in xs if v} };`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpHash, 0),          // 0000
+					code.Make(code.OpSetLocal, 0),      // 0003
+					code.Make(code.OpGetFree, 0),       // 0005
+					code.Make(code.OpIter),             // 0007
+					code.Make(code.OpIterNext, 31),     // 0008
+					code.Make(code.OpDestructure, 2),   // 0011
+					code.Make(code.OpSetLocal, 2),      // 0013
+					code.Make(code.OpSetLocal, 1),      // 0015
+					code.Make(code.OpGetLocal, 2),      // 0017
+					code.Make(code.OpJumpNotTruthy, 7), // 0019
+					code.Make(code.OpGetLocal, 0),      // 0022
+					code.Make(code.OpGetLocal, 1),      // 0024
+					code.Make(code.OpGetLocal, 2),      // 0026
+					code.Make(code.OpHashSet),          // 0028
+					code.Make(code.OpJump, 7),          // 0029
+					code.Make(code.OpGetLocal, 0),      // 0032
+					code.Make(code.OpReturnValue),      // 0034
+				},
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		runCompilerTest(t, i, &testCase)
+	}
+}
+
+func TestUserDefinedInfixOperators(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			input: "infix 45 <+> (a, b) => a\n1 <+> 2",
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCall, 2),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		runCompilerTest(t, i, &testCase)
+	}
+}
+
 func TestGlobalLetStatements(t *testing.T) {
 	testCases := []compilerTestCase{
 		{
@@ -342,6 +602,20 @@ two;
 				code.Make(code.OpGetGlobal, 1),
 				code.Make(code.OpPop),
 			},
+		}, {
+			// a global function is bound before its body is compiled, so it calls itself through the global
+			input: `let f = fn() { f() };`,
+			expectedConstants: []any{
+				[]code.Instructions{
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpCall, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+			},
 		},
 	}
 
@@ -518,6 +792,51 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestSetLiterals(t *testing.T) {
+	testCases := []compilerTestCase{
+		{
+			input:             `#{}`,
+			expectedConstants: []any{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpSet),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let a = [1]; #{2, ...a}`,
+			expectedConstants: []any{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpArrayConcat, 2),
+				code.Make(code.OpSet),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `1 in #{1}`,
+			expectedConstants: []any{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSet),
+				code.Make(code.OpIn),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for i, testCase := range testCases {
+		runCompilerTest(t, i, &testCase)
+	}
+}
+
 func TestIndexExpressions(t *testing.T) {
 	testCases := []compilerTestCase{
 		// test array index
@@ -1153,6 +1472,11 @@ func testConstants(t *testing.T, caseIndex int, expectedConstants []interface{},
 			testIntegerObject(t, caseIndex, constants.GetConstant(code.Index(i)), int64(expected))
 		case string:
 			testStringObject(t, caseIndex, constants.GetConstant(code.Index(i)), expected)
+		case *big.Int:
+			actual, ok := constants.GetConstant(code.Index(i)).(*object.BigInteger)
+			if !ok || actual.Value.Cmp(expected) != 0 {
+				t.Fatalf("case %d expected big integer constant [%s], got [%v]", caseIndex, expected, constants.GetConstant(code.Index(i)))
+			}
 		case []code.Instructions:
 			testClosure(t, caseIndex, expected, constants.GetConstant(code.Index(i)))
 		}
@@ -1,10 +0,0 @@
-package compiler
-
-import (
-	"0x822a5b87/monkey/interpreter/ast"
-)
-
-type ExpressionPair struct {
-	Key   ast.Expression
-	Value ast.Expression
-}
@@ -13,6 +13,10 @@ type Frame struct {
 	ip int
 	// basePointer the stack pointer of callee
 	basePointer int
+	// comparison the call is the method of a comparison operator, its value is converted to a Boolean when it returns
+	comparison bool
+	// negate the call is the __eq__ method of a != operator, its value is negated when it returns
+	negate bool
 }
 
 func NewFrame(f *code.Closure, stackPointer int) *Frame {
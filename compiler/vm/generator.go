@@ -0,0 +1,104 @@
+package vm
+
+import (
+	"0x822a5b87/monkey/compiler/code"
+	"0x822a5b87/monkey/interpreter/common"
+	"0x822a5b87/monkey/interpreter/object"
+)
+
+// generatorStackSize the initial size of the stack of a generator, and generatorFrameSize the initial capacity
+// of its frames, they grow on demand, so that a generator suspended with a shallow stack stays cheap
+const (
+	generatorStackSize = 16
+	generatorFrameSize = 4
+)
+
+// callGenerator replace the generator function and its arguments on the stack with an iterator over the values
+// it yields. The call runs in a vm of its own sharing the globals, whose frames and stack are kept while the
+// generator is suspended, and every element asked for runs it until its next OpYield under the budget of the
+// consumer.
+func (v *Vm) callGenerator(closure *code.Closure, numOfArgs int) error {
+	defer v.incrementIp(1)
+
+	g := &Vm{
+		constants:   v.constants,
+		stack:       make([]object.Object, generatorStackSize),
+		globalStore: v.globalStore,
+		frames:      make([]*Frame, 0, generatorFrameSize),
+		budget:      v.budget,
+	}
+	// the closure and its locals, whose first ones are the arguments
+	if err := g.growStack(1 + closure.Fn.NumOfLocalVars); err != nil {
+		return err
+	}
+	// the generator function is called from an empty frame, which ends the run once the function returns
+	g.pushFrame(NewFrame(&code.Closure{Fn: &code.CompiledFunction{}}, 0))
+	g.sp = copy(g.stack, v.stack[v.sp-numOfArgs-1:v.sp])
+	basePointer := g.sp - numOfArgs
+	g.sp = basePointer + closure.Fn.NumOfLocalVars
+	g.pushFrame(NewFrame(closure, basePointer))
+
+	done := false
+	// running the generator is running, so the element is asked for by the generator itself
+	running := false
+	var iterator *object.Iterator
+	iterator = object.NewLazyIterator(func(budget object.Budget) (object.Object, bool) {
+		if done {
+			return nil, false
+		}
+		if running {
+			return errorObject(common.ErrGeneratorRunning), true
+		}
+		if budget, ok := budget.(*common.Budget); ok {
+			g.budget = budget
+		}
+		g.yielded = false
+		running = true
+		err := g.run()
+		running = false
+		if err != nil {
+			done = true
+			return errorObject(err), true
+		}
+		if !g.yielded {
+			done = true
+			if g.delegate != nil {
+				iterator.Delegate(g.delegate)
+			}
+			return nil, false
+		}
+		return g.pop(), true
+	})
+
+	v.sp = v.sp - numOfArgs - 1
+	return v.push(iterator)
+}
+
+// errorObject the error which stops a generator as the last element of its iterator, see object.Iterator
+func errorObject(err error) *object.Error {
+	if obj, ok := err.(*object.Error); ok {
+		return obj
+	}
+	return &object.Error{Message: err.Error(), Err: err}
+}
+
+// executeYield suspend the run, the yielded value is left on top of the stack for the iterator of the generator
+func (v *Vm) executeYield(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	v.yielded = true
+	return nil
+}
+
+// executeDelegate pop the iterator which the generator hands over to once it returns
+func (v *Vm) executeDelegate(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	definition, _ := code.Lookup(op)
+	iterator, ok := v.pop().(*object.Iterator)
+	if !ok {
+		return common.NewErrEmptyStack(definition.Name)
+	}
+	v.delegate = iterator
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"0x822a5b87/monkey/interpreter/common"
 	"0x822a5b87/monkey/interpreter/evaluator"
 	"0x822a5b87/monkey/interpreter/object"
+	"0x822a5b87/monkey/interpreter/token"
+	"context"
 	"errors"
 	"fmt"
 )
@@ -26,6 +28,14 @@ type Vm struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	// budget the budget of the run in progress
+	budget *common.Budget
+
+	// yielded the run is suspended by OpYield, the yielded value is on top of the stack, see callGenerator
+	yielded bool
+	// delegate the iterator the generator handed over to by OpDelegate
+	delegate *object.Iterator
 }
 
 func NewVm(c *compiler.ByteCode) *Vm {
@@ -62,9 +72,62 @@ func NewVmWithState(code *compiler.ByteCode, prev *Vm) *Vm {
 // In this method, we use code.ReadUint16 instead of code.ReadOperands for the same reason we don't use code.Lookup
 // when fetching the instruction: performance.
 func (v *Vm) Run() error {
+	return v.RunWithContext(context.Background(), common.Limits{})
+}
+
+// RunWithContext run until the end of instructions, one of the limits is exceeded or the context is done.
+// The budget is checked before every instruction, and an aborted run returns an error wrapping one of
+// common.ErrStepLimitExceeded, common.ErrCallDepthExceeded, common.ErrAllocationLimitExceeded and common.ErrCancelled.
+func (v *Vm) RunWithContext(ctx context.Context, limits common.Limits) error {
+	v.budget = common.NewBudget(ctx, limits)
+	if err := v.budget.Check(); err != nil {
+		return err
+	}
+	return v.run()
+}
+
+// CallWithContext call the function with the arguments and return its value, the function is a closure
+// or a built-in function, and it runs with the limits like RunWithContext.
+// The vm must have been created for a program without instructions, like NewVmWithState(&compiler.ByteCode{...}, prev),
+// so that the run ends when the function returns.
+func (v *Vm) CallWithContext(ctx context.Context, limits common.Limits, fn object.Object, args ...object.Object) (object.Object, error) {
+	v.budget = common.NewBudget(ctx, limits)
+	if err := v.budget.Check(); err != nil {
+		return nil, err
+	}
+	for _, obj := range append([]object.Object{fn}, args...) {
+		if err := v.push(obj); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.callFunction(len(args)); err != nil {
+		return nil, err
+	}
+	if err := v.run(); err != nil {
+		return nil, err
+	}
+	return v.pop(), nil
+}
+
+// Global the value of the global binding at the index
+func (v *Vm) Global(index int) object.Object {
+	return v.globalStore[index]
+}
+
+// SetGlobal set the value of the global binding at the index
+func (v *Vm) SetGlobal(index int, obj object.Object) {
+	v.globalStore[index] = obj
+}
+
+// run the dispatch loop
+func (v *Vm) run() error {
 	var err error
 	// In every loop, we reach the end of a single instruction and increment by 1 byte to move to the next instruction
-	for v.hasNext() {
+	for !v.yielded && v.hasNext() {
+		if err = v.budget.Step(); err != nil {
+			return err
+		}
+
 		op := v.currentOpcode()
 		switch op {
 		case code.OpConstant:
@@ -73,7 +136,8 @@ func (v *Vm) Run() error {
 			err = v.opPop()
 		case code.OpTrue, code.OpFalse:
 			err = v.opBoolean(op)
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpIn:
 			err = v.executeBinaryOperation(op)
 		case code.OpBang, code.OpMinus:
 			err = v.executePrefixOpcode(op)
@@ -107,6 +171,34 @@ func (v *Vm) Run() error {
 			err = v.executeClosure(op)
 		case code.OpGetFree:
 			err = v.executeGetFree(op)
+		case code.OpNull:
+			err = v.opNull()
+		case code.OpJumpNull:
+			err = v.executeJumpNull(op)
+		case code.OpJumpNotNull:
+			err = v.executeJumpNotNull(op)
+		case code.OpArrayConcat:
+			err = v.executeArrayConcat(op)
+		case code.OpHashMerge:
+			err = v.executeHashMerge(op)
+		case code.OpCallSpread:
+			err = v.executeCallSpread(op)
+		case code.OpIter:
+			err = v.executeIter(op)
+		case code.OpIterNext:
+			err = v.executeIterNext(op)
+		case code.OpDestructure:
+			err = v.executeDestructure(op)
+		case code.OpArrayAppend:
+			err = v.executeArrayAppend(op)
+		case code.OpHashSet:
+			err = v.executeHashSet(op)
+		case code.OpSet:
+			err = v.executeSet(op)
+		case code.OpYield:
+			err = v.executeYield(op)
+		case code.OpDelegate:
+			err = v.executeDelegate(op)
 		default:
 			err = fmt.Errorf("wrong type of Opcode : [%d]", op)
 		}
@@ -126,6 +218,11 @@ func (v *Vm) StackTop() object.Object {
 	return v.stack[v.sp-1]
 }
 
+// LastPopped the element popped off the stack last, which is the value of the last expression statement of a run
+func (v *Vm) LastPopped() object.Object {
+	return v.stack[v.sp]
+}
+
 // TestOnlyLastPoppedStackElement this method is for test only
 // Sometimes, we want to assert that "this should have been on the stack, right before you popped it off"
 func (v *Vm) TestOnlyLastPoppedStackElement() object.Object {
@@ -133,8 +230,8 @@ func (v *Vm) TestOnlyLastPoppedStackElement() object.Object {
 }
 
 func (v *Vm) push(o object.Object) error {
-	if v.sp >= StackSize {
-		return errors.New("stack overflow")
+	if err := v.growStack(v.sp + 1); err != nil {
+		return err
 	}
 
 	v.stack[v.sp] = o
@@ -143,6 +240,21 @@ func (v *Vm) push(o object.Object) error {
 	return nil
 }
 
+// growStack make room for size elements on the stack, the stack of a generator starts small and grows on demand
+// up to StackSize, see callGenerator
+func (v *Vm) growStack(size int) error {
+	if size <= len(v.stack) {
+		return nil
+	}
+	if size > StackSize {
+		return common.ErrCallDepthExceeded
+	}
+	stack := make([]object.Object, min(max(size, 2*len(v.stack)), StackSize))
+	copy(stack, v.stack)
+	v.stack = stack
+	return nil
+}
+
 func (v *Vm) hasNext() bool {
 	return v.currentIp() < len(v.currentInstructions())
 }
@@ -189,57 +301,78 @@ func (v *Vm) opBoolean(op code.Opcode) error {
 	}
 }
 
+// pushResult push the result of an operation, an error object, like a division by zero, fails the run instead,
+// and the elements of a new object are charged to the budget
+func (v *Vm) pushResult(result object.Object) error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	if err := v.budget.Allocate(common.SizeOf(result)); err != nil {
+		return err
+	}
+	return v.push(result)
+}
+
 // opAdd add two number from the stack and push the result back onto the stack
 func (v *Vm) opAdd(lhs, rhs object.Object) error {
 	left := lhs.(object.Add)
 	right := rhs.(object.Add)
-	return v.push(left.Add(right))
+	return v.pushResult(left.Add(right))
 }
 
 func (v *Vm) opSub(lhs, rhs object.Object) error {
 	left := lhs.(object.Subtract)
 	right := rhs.(object.Subtract)
-	return v.push(left.Sub(right))
+	return v.pushResult(left.Sub(right))
 }
 
 func (v *Vm) opMul(lhs, rhs object.Object) error {
 	left := lhs.(object.Multiply)
 	right := rhs.(object.Multiply)
-	return v.push(left.Mul(right))
+	return v.pushResult(left.Mul(right))
 }
 
 func (v *Vm) opDiv(lhs, rhs object.Object) error {
 	left := lhs.(object.Divide)
 	right := rhs.(object.Divide)
-	return v.push(left.Divide(right))
+	return v.pushResult(left.Divide(right))
 }
 
 func (v *Vm) opEqual(lhs, rhs object.Object) error {
-	left := lhs.(object.Equatable)
-	right := rhs.(object.Equatable)
-	return v.push(left.Equal(right))
+	return v.push(object.NativeBoolean(object.Equals(lhs, rhs)))
 }
+
 func (v *Vm) opNotEqual(lhs, rhs object.Object) error {
-	left := lhs.(object.Equatable)
-	right := rhs.(object.Equatable)
-	return v.push(left.NotEqual(right))
+	return v.push(object.NativeBoolean(!object.Equals(lhs, rhs)))
 }
+
 func (v *Vm) opGreaterThan(lhs, rhs object.Object) error {
-	left := lhs.(object.Comparable)
-	right := rhs.(object.Comparable)
-	return v.push(left.GreaterThan(right))
+	c, err := evaluator.Compare(string(token.GT), lhs, rhs)
+	if err != nil {
+		return errors.New(err.Message)
+	}
+	return v.push(object.NativeBoolean(c > 0))
 }
+
 func (v *Vm) opLessThan(lhs, rhs object.Object) error {
-	left := lhs.(object.Comparable)
-	right := rhs.(object.Comparable)
-	return v.push(left.LessThan(right))
+	c, err := evaluator.Compare(string(token.LT), lhs, rhs)
+	if err != nil {
+		return errors.New(err.Message)
+	}
+	return v.push(object.NativeBoolean(c < 0))
 }
 
 func (v *Vm) executeBinaryOperation(op code.Opcode) error {
+	definition, _ := code.Lookup(op)
+	if v.sp >= 2 {
+		if method, ok := evaluator.OperatorMethod(definition.Operator, v.stack[v.sp-2], v.stack[v.sp-1]); ok {
+			return v.callOperatorMethod(op, method)
+		}
+	}
+
 	defer v.incrementIp(1)
 	rhs := v.pop()
 	lhs := v.pop()
-	definition, _ := code.Lookup(op)
 	if lhs == nil || rhs == nil {
 		return common.NewErrEmptyStack(definition.Name)
 	}
@@ -266,11 +399,43 @@ func (v *Vm) executeBinaryOperation(op code.Opcode) error {
 		return v.opGreaterThan(lhs, rhs)
 	case code.OpLessThan:
 		return v.opLessThan(lhs, rhs)
+	case code.OpIn:
+		return v.pushResult(rhs.(object.Container).Contains(lhs))
 	default:
 		return common.NewErrUnsupportedBinaryExpr(definition.Name)
 	}
 }
 
+// callOperatorMethod call the method overloading the operator with the operands on top of the stack, the call
+// returns to the instruction after the operator like the call of OpCall. The value of a comparison is converted
+// to a Boolean, and negated for !=, right away for a built-in function, and when the frame returns for a closure.
+func (v *Vm) callOperatorMethod(op code.Opcode, method object.Object) error {
+	rhs := v.pop()
+	lhs := v.pop()
+	for _, obj := range []object.Object{method, lhs, rhs} {
+		if err := v.push(obj); err != nil {
+			return err
+		}
+	}
+
+	framesIndex := v.framesIndex
+	if err := v.callFunction(2); err != nil {
+		return err
+	}
+	switch op {
+	case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
+	default:
+		return nil
+	}
+	negate := op == code.OpNotEqual
+	if v.framesIndex > framesIndex {
+		v.currentFrame().comparison, v.currentFrame().negate = true, negate
+	} else {
+		v.stack[v.sp-1] = object.NativeBoolean(v.isTruthy(v.stack[v.sp-1]) != negate)
+	}
+	return nil
+}
+
 func (v *Vm) executePrefixOpcode(op code.Opcode) error {
 	defer v.incrementIp(1)
 	lhs := v.pop()
@@ -279,6 +444,10 @@ func (v *Vm) executePrefixOpcode(op code.Opcode) error {
 		return common.NewErrEmptyStack(definition.Name)
 	}
 
+	if err := evaluator.PrefixExpressionTypeCheck(definition.Operator, lhs); err != nil {
+		return errors.New(err.Message)
+	}
+
 	switch op {
 	case code.OpBang:
 		return v.opBang(lhs)
@@ -308,6 +477,45 @@ func (v *Vm) executeNotTruthyJump(op code.Opcode) error {
 	}
 }
 
+// executeJumpNull peek the top of the stack and jump if it is null, the stack is left unchanged in both cases
+func (v *Vm) executeJumpNull(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	definition, _ := code.Lookup(op)
+
+	top := v.StackTop()
+	if top == nil {
+		return common.NewErrEmptyStack(definition.Name)
+	}
+
+	if top == object.NativeNull {
+		return v.doJump(definition)
+	}
+	// skip operands
+	v.incrementIp(2)
+	return nil
+}
+
+// executeJumpNotNull peek the top of the stack and jump if it is not null, otherwise the null is popped
+func (v *Vm) executeJumpNotNull(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	definition, _ := code.Lookup(op)
+
+	top := v.StackTop()
+	if top == nil {
+		return common.NewErrEmptyStack(definition.Name)
+	}
+
+	if top != object.NativeNull {
+		return v.doJump(definition)
+	}
+	v.pop()
+	// skip operands
+	v.incrementIp(2)
+	return nil
+}
+
 func (v *Vm) executeJump(op code.Opcode) error {
 	defer v.incrementIp(1)
 
@@ -335,64 +543,277 @@ func (v *Vm) executeOpArray(op code.Opcode) error {
 	defer v.incrementIp(1)
 
 	n := v.readUint16AndIncIp()
-	array := &object.Array{Elements: make([]object.Object, n.IntValue())}
-	for i := n.IntValue() - 1; i >= 0; i-- {
-		array.Elements[i] = v.pop()
+	if err := v.budget.Allocate(n.IntValue()); err != nil {
+		return err
 	}
+	array := object.NewArray(v.stack[v.sp-n.IntValue() : v.sp])
+	v.sp -= n.IntValue()
 	return v.push(array)
 }
 
 func (v *Vm) executeHash(op code.Opcode) error {
 	defer v.incrementIp(1)
 
-	doubleN := v.readUint16AndIncIp()
-	hash := &object.Hash{Pairs: make(map[object.HashKey]*object.HashPair)}
-	for i := 0; i < doubleN.IntValue(); i += 2 {
-		value := v.pop()
-		key := v.pop()
-		hashable := key.(object.Hashable)
-		hash.Pairs[hashable.HashKey()] = &object.HashPair{
-			Key:   key,
-			Value: value,
+	doubleN := v.readUint16AndIncIp().IntValue()
+	if err := v.budget.Allocate(doubleN / 2); err != nil {
+		return err
+	}
+	hash := object.NewHash()
+	// the pairs are read from the bottom up, so that the hash keeps the order they are written in
+	for i := v.sp - doubleN; i < v.sp; i += 2 {
+		key, value := v.stack[i], v.stack[i+1]
+		hashable, ok := object.AsHashable(key)
+		if !ok {
+			return common.NewErrUnhashable(key.Type())
+		}
+		hash.Set(hashable, value)
+	}
+	v.sp -= doubleN
+	return v.push(hash)
+}
+
+// executeSet pop the array of the elements of a set literal and push the set
+func (v *Vm) executeSet(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	definition, _ := code.Lookup(op)
+	obj := v.pop()
+	if obj == nil {
+		return common.NewErrEmptyStack(definition.Name)
+	}
+	set := object.NewSet()
+	for _, element := range obj.(*object.Array).Elements() {
+		hashable, ok := object.AsHashable(element)
+		if !ok {
+			return common.NewErrUnhashable(element.Type())
+		}
+		set.Insert(hashable)
+	}
+	return v.push(set)
+}
+
+// executeArrayConcat pop N arrays off the stack and push their concatenation
+func (v *Vm) executeArrayConcat(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	n := v.readUint16AndIncIp().IntValue()
+	elements := make([]object.Object, 0)
+	for _, obj := range v.stack[v.sp-n : v.sp] {
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return common.NewErrCannotSpread(obj.Type())
+		}
+		elements = append(elements, array.Elements()...)
+	}
+	if err := v.budget.Allocate(len(elements)); err != nil {
+		return err
+	}
+	v.sp -= n
+	return v.push(object.NewArray(elements))
+}
+
+// executeHashMerge pop N hashes off the stack and merge them into a new hash, the later ones override the earlier ones
+func (v *Vm) executeHashMerge(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	n := v.readUint16AndIncIp().IntValue()
+	hash := object.NewHash()
+	for _, obj := range v.stack[v.sp-n : v.sp] {
+		other, ok := obj.(*object.Hash)
+		if !ok {
+			return common.NewErrCannotSpread(obj.Type())
 		}
+		hash.Merge(other)
+	}
+	if err := v.budget.Allocate(hash.Len()); err != nil {
+		return err
 	}
+	v.sp -= n
 	return v.push(hash)
 }
 
+func (v *Vm) executeIter(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	definition, _ := code.Lookup(op)
+	obj := v.pop()
+	if obj == nil {
+		return common.NewErrEmptyStack(definition.Name)
+	}
+	iterable, ok := obj.(object.Iterable)
+	if !ok {
+		return common.NewErrNotIterable(obj.Type())
+	}
+	return v.push(iterable.Iterator())
+}
+
+// executeIterNext push the next element of the iterator on top of the stack, or pop the iterator and jump out of the loop
+func (v *Vm) executeIterNext(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	definition, _ := code.Lookup(op)
+	iterator, ok := v.StackTop().(*object.Iterator)
+	if !ok {
+		return common.NewErrEmptyStack(definition.Name)
+	}
+
+	element, ok := iterator.Next(v.budget)
+	if !ok {
+		v.pop()
+		return v.doJump(definition)
+	}
+	if err, isError := element.(*object.Error); isError {
+		return err
+	}
+	// skip operands
+	v.incrementIp(2)
+	return v.push(element)
+}
+
+func (v *Vm) executeDestructure(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	n := v.readUint8AndIncIp().IntValue()
+	obj := v.pop()
+	array, ok := obj.(*object.Array)
+	if !ok {
+		return common.NewErrCannotDestructure(obj.Type())
+	}
+	for i := 0; i < n; i++ {
+		var element object.Object = object.NativeNull
+		if i < array.Size() {
+			element = array.Get(i)
+		}
+		err := v.push(element)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *Vm) executeArrayAppend(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	definition, _ := code.Lookup(op)
+	value := v.pop()
+	obj := v.pop()
+	if value == nil || obj == nil {
+		return common.NewErrEmptyStack(definition.Name)
+	}
+	array, ok := obj.(*object.Array)
+	if !ok {
+		return common.NewErrTypeMismatch(string(object.ObjArray), string(obj.Type()))
+	}
+	if err := v.budget.Allocate(1); err != nil {
+		return err
+	}
+	array.Append(value)
+	return nil
+}
+
+func (v *Vm) executeHashSet(op code.Opcode) error {
+	defer v.incrementIp(1)
+
+	definition, _ := code.Lookup(op)
+	value := v.pop()
+	key := v.pop()
+	obj := v.pop()
+	if value == nil || key == nil || obj == nil {
+		return common.NewErrEmptyStack(definition.Name)
+	}
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		return common.NewErrTypeMismatch(string(object.ObjHash), string(obj.Type()))
+	}
+	hashable, ok := object.AsHashable(key)
+	if !ok {
+		return common.NewErrUnhashable(key.Type())
+	}
+	if err := v.budget.Allocate(1); err != nil {
+		return err
+	}
+	hash.Set(hashable, value)
+	return nil
+}
+
 func (v *Vm) executeIndex(op code.Opcode) error {
 	defer v.incrementIp(1)
 
+	definition, _ := code.Lookup(op)
 	index := v.pop()
 	obj := v.pop()
+	if index == nil || obj == nil {
+		return common.NewErrEmptyStack(definition.Name)
+	}
 
 	indexed, ok := obj.(object.Index)
 	if !ok {
-		return common.NewErrIndex(indexed.Type())
+		return common.NewErrIndex(obj.Type())
 	}
 
-	return v.push(indexed.Index(index))
+	return v.pushResult(indexed.Index(index))
 }
 
 func (v *Vm) executeCall(op code.Opcode) error {
 	// NumOfLocalVars = NumOfArguments + NumOfVariablesDefinedInFunction
 	numOfArgs := v.readUint8AndIncIp()
-	obj := v.stack[v.sp-numOfArgs.IntValue()-1]
+	return v.callFunction(numOfArgs.IntValue())
+}
+
+// executeCallSpread pop the array of arguments and push its elements back onto the stack,
+// so that the function can be called as if the arguments were compiled one by one.
+func (v *Vm) executeCallSpread(op code.Opcode) error {
+	definition, _ := code.Lookup(op)
+	obj := v.pop()
+	if obj == nil {
+		return common.NewErrEmptyStack(definition.Name)
+	}
+	args, ok := obj.(*object.Array)
+	if !ok {
+		return common.NewErrCannotSpread(obj.Type())
+	}
+	for _, arg := range args.Elements() {
+		err := v.push(arg)
+		if err != nil {
+			return err
+		}
+	}
+	return v.callFunction(args.Size())
+}
+
+// callFunction call the function sitting below the numOfArgs arguments on top of the stack
+func (v *Vm) callFunction(numOfArgs int) error {
+	obj := v.stack[v.sp-numOfArgs-1]
 
 	switch fn := obj.(type) {
 	case *code.Closure:
-		return v.executeCallClosure(fn, numOfArgs.IntValue())
+		return v.executeCallClosure(fn, numOfArgs)
 	case *object.BuiltIn:
-		return v.executeCallBuiltIn(fn, numOfArgs.IntValue())
+		return v.executeCallBuiltIn(fn, numOfArgs)
 	default:
-		return common.NewErrTypeMismatch(object.ObjFunction.String(), obj.Type().String())
+		return common.NewErrNotFunction(obj.Type())
 	}
 }
 
 func (v *Vm) executeCallClosure(closure *code.Closure, numOfArgs int) error {
+	if numOfArgs != closure.Fn.NumOfParameters {
+		return common.NewErrWrongNumberOfArguments(closure.Fn.NumOfParameters, numOfArgs)
+	}
+	if closure.Fn.Generator {
+		return v.callGenerator(closure, numOfArgs)
+	}
+	// the main frame is not a call
+	if maxDepth := v.budget.MaxCallDepth(MaxFrameSize - 1); v.framesIndex > maxDepth {
+		return common.NewErrCallDepthExceeded(maxDepth)
+	}
 	// base pointer points to the start position of local variable
 	basePointer := v.sp - numOfArgs
 	// stack pointer points to the start position of the new frame's stack
 	stackPointer := v.sp + closure.Fn.NumOfLocalVars
+	if err := v.growStack(stackPointer); err != nil {
+		return err
+	}
 	frame := NewFrame(closure, basePointer)
 	v.sp = stackPointer
 	v.pushFrame(frame)
@@ -403,7 +824,14 @@ func (v *Vm) executeCallClosure(closure *code.Closure, numOfArgs int) error {
 func (v *Vm) executeCallBuiltIn(builtIn *object.BuiltIn, numOfArgs int) error {
 	defer v.incrementIp(1)
 	args := v.stack[v.sp-numOfArgs : v.sp]
-	o := builtIn.BuiltInFn(args...)
+	o := builtIn.Call(v.budget, args...)
+	// a built-in function fails the run like the evaluator does, instead of pushing the error as a value
+	if err, ok := o.(*object.Error); ok {
+		return err
+	}
+	if err := v.budget.Allocate(common.SizeOf(o)); err != nil {
+		return err
+	}
 	v.sp = v.sp - numOfArgs - 1
 	if o != nil {
 		return v.push(o)
@@ -417,6 +845,9 @@ func (v *Vm) executeReturnValue(op code.Opcode) error {
 	returnValue := v.pop()
 	oldFrame := v.popFrame()
 	v.sp = oldFrame.basePointer - 1
+	if oldFrame.comparison {
+		returnValue = object.NativeBoolean(v.isTruthy(returnValue) != oldFrame.negate)
+	}
 	_ = v.push(returnValue)
 	return nil
 }
@@ -425,6 +856,9 @@ func (v *Vm) executeReturn(op code.Opcode) error {
 	defer v.incrementIp(1)
 	oldFrame := v.popFrame()
 	v.sp = oldFrame.basePointer - 1
+	if oldFrame.comparison {
+		return v.push(object.NativeBoolean(oldFrame.negate))
+	}
 	return v.push(object.NativeNull)
 }
 
@@ -488,8 +922,10 @@ func (v *Vm) executeClosure(op code.Opcode) error {
 	for i := 0; i < numFree.IntValue(); i++ {
 		free[i] = v.stack[v.sp-numFree.IntValue()+i]
 	}
-	closure.Free = free
-	return v.push(closure)
+	v.sp -= numFree.IntValue()
+	// the constant is shared by every closure created from the same function literal,
+	// so the free variables must go to a new closure instead of the constant itself
+	return v.push(&code.Closure{Fn: closure.Fn, Free: free})
 }
 
 func (v *Vm) executeGetFree(op code.Opcode) error {
@@ -547,6 +983,11 @@ func (v *Vm) opPop() error {
 	return nil
 }
 
+func (v *Vm) opNull() error {
+	defer v.incrementIp(1)
+	return v.push(object.NativeNull)
+}
+
 func (v *Vm) opBang(lhs object.Object) error {
 	switch lhs {
 	case object.NativeFalse, object.NativeNull:
@@ -560,7 +1001,7 @@ func (v *Vm) opBang(lhs object.Object) error {
 
 func (v *Vm) opMinus(lhs object.Object) error {
 	left := lhs.(object.Negative)
-	return v.push(left.Negative())
+	return v.pushResult(left.Negative())
 }
 
 func (v *Vm) operands() {
@@ -580,7 +1021,12 @@ func (v *Vm) currentFrame() *Frame {
 }
 
 func (v *Vm) pushFrame(newFrame *Frame) {
-	v.frames[v.framesIndex] = newFrame
+	// the frames of a generator grow on demand, see callGenerator
+	if v.framesIndex == len(v.frames) {
+		v.frames = append(v.frames, newFrame)
+	} else {
+		v.frames[v.framesIndex] = newFrame
+	}
 	v.framesIndex++
 }
 
@@ -4,11 +4,17 @@ import (
 	"0x822a5b87/monkey/compiler/code"
 	"0x822a5b87/monkey/compiler/compiler"
 	"0x822a5b87/monkey/interpreter/ast"
+	"0x822a5b87/monkey/interpreter/common"
 	"0x822a5b87/monkey/interpreter/lexer"
 	"0x822a5b87/monkey/interpreter/object"
 	"0x822a5b87/monkey/interpreter/parser"
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestIntegerArithmetic(t *testing.T) {
@@ -35,6 +41,31 @@ func TestIntegerArithmetic(t *testing.T) {
 	runVmTests(t, testCases)
 }
 
+func TestBigIntegers(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807"},
+		{"100000000000000000000 / 10", "10000000000000000000"},
+		{"let f = fn(f, n) { if (n < 2) { return 1; }; return n * f(f, n - 1); }; f(f, 25)", "15511210043330985984000000"},
+		{"9223372036854775808 > 9223372036854775807", "true"},
+		{"9223372036854775808 == 9223372036854775807 + 1", "true"},
+		{"{9223372036854775808: 1}[9223372036854775807 + 1]", "1"},
+	}
+
+	for caseIndex, testCase := range testCases {
+		actual := runVm(t, caseIndex, testCase.input).TestOnlyLastPoppedStackElement()
+		if actual.Inspect() != testCase.expected {
+			t.Errorf("test case [%d] expected [%s], got [%s]", caseIndex, testCase.expected, actual.Inspect())
+		}
+	}
+}
+
 func TestBooleanArithmetic(t *testing.T) {
 	testCases := []vmTestCase{
 		{"true", true},
@@ -61,11 +92,123 @@ func TestBooleanArithmetic(t *testing.T) {
 		{"!!false", false},
 		{"!5", false},
 		{"!!-2147483648", true},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" < "b"`, true},
+		{`"ab" > "a"`, true},
+		{`"b" < "ab"`, false},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 2] < [1, 2, 0]", true},
+		{`[true, "b"] > [true, "a"]`, true},
+		{"[] < []", false},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{"1 == true", false},
+		{`1 != "1"`, true},
+		{"null == null", true},
+		{"[null] == [false]", false},
+		{"let f = fn() { 1 }; f == f", true},
+		{"fn() { 1 } == fn() { 1 }", false},
+		{"len == len", true},
+		{"len == first", false},
 	}
 
 	runVmTests(t, testCases)
 }
 
+func TestSets(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`#{}`, `#{}`},
+		{`#{3, 1, 2, 1, 3}`, `#{3, 1, 2}`},
+		{`let xs = [2, 3]; #{1, ...xs, 2}`, `#{1, 2, 3}`},
+		{`len(#{"a", "b", "a"})`, `2`},
+		{`[2 in #{1, 2}, 3 in #{1, 2}, "a" in {"a": 1}, 1 in [0, 1], 1 in []]`, `[true, false, true, true, false]`},
+		{`let s = #{1, 2}; let t = add(s, 3); [s, t, remove(t, 1)]`, `[#{1, 2}, #{1, 2, 3}, #{2, 3}]`},
+		{`let a = #{1, 2, 3}; let b = #{3, 4, 2}; [union(a, b), intersection(a, b), difference(a, b)]`,
+			`[#{1, 2, 3, 4}, #{2, 3}, #{1}]`},
+		{`[x * 2 for x in #{1, 2, 1}]`, `[2, 4]`},
+	}
+
+	for caseIndex, testCase := range testCases {
+		actual := runVm(t, caseIndex, testCase.input).TestOnlyLastPoppedStackElement()
+		if actual.Inspect() != testCase.expected {
+			t.Errorf("test case [%d] expected [%s], got [%s]", caseIndex, testCase.expected, actual.Inspect())
+		}
+	}
+}
+
+func TestArrayKeys(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`let grid = {[0, 0]: "a", [0, 1]: "b"}; [grid[[0, 0]], grid[[0, 1]], grid[[1, 0]]]`, `[a, b, null]`},
+		{`let k = [1, [2, "x"]]; let h = {k: 1}; h[[1, [2, "x"]]]`, `1`},
+		{`#{[1, 2], [1, 2], [2, 1]}`, `#{[1, 2], [2, 1]}`},
+		{`[[1, 2] in #{[1, 2]}, [2] in #{[1, 2]}, [1] in {[1]: 0}]`, `[true, false, true]`},
+		{`let h = assoc({}, [1], 1); [h, dissoc(h, [1])]`, `[{[1]:1}, {}]`},
+		{`{[1, 2]: 1} == {[1, 2]: 1}`, `true`},
+	}
+
+	for caseIndex, testCase := range testCases {
+		actual := runVm(t, caseIndex, testCase.input).TestOnlyLastPoppedStackElement()
+		if actual.Inspect() != testCase.expected {
+			t.Errorf("test case [%d] expected [%s], got [%s]", caseIndex, testCase.expected, actual.Inspect())
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "division by zero"},
+		{"let f = fn(x) { x / 0 }; f(1) + 1", "division by zero"},
+		{"9223372036854775808 / 0", "division by zero"},
+		{"if (1 / 0) { 1 }", "division by zero"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{`-"a"`, "unknown operator: -STRING"},
+		{"-null", "unknown operator: -NULL"},
+		{"1[0]", "error index type = [INTEGER]"},
+		{"null[0]", "error index type = [NULL]"},
+		{"{1: 1}[[{}]]", "unusable as hash key: ARRAY"},
+		{"1()", "not a function: INTEGER"},
+		{"fn(a) { a }()", "number of parameters mismatch: expected [1], got [0]"},
+		{"fn() { 1 }(1)", "number of parameters mismatch: expected [0], got [1]"},
+		{"fn(a) { a }(...[1, 2])", "number of parameters mismatch: expected [1], got [2]"},
+		{`"a" < 1`, "type mismatch: STRING < INTEGER"},
+		{`[1, 2] < [1, "a"]`, "type mismatch: INTEGER < STRING"},
+		{"[true] > [false]", "unknown operator: BOOLEAN > BOOLEAN"},
+		{`{"a": 1} < {"a": 2}`, "unknown operator: HASH < HASH"},
+		{"#{[1, {}]}", "unusable as hash key: ARRAY"},
+		{"{[1, fn() {}]: 1}", "unusable as hash key: ARRAY"},
+		{"[fn() {}] in #{}", "unusable as hash key: ARRAY"},
+		{"1 in 1", "unknown operator: INTEGER in INTEGER"},
+		{`{"__eq__": fn(a, b) { 1 / 0 }} == 1`, "division by zero"},
+		{`{"__add__": 1} + 1`, "not a function: INTEGER"},
+		{"let g = fn() { yield 1; 1 / 0 }; [x for x in g()]", "division by zero"},
+		{"let g = fn() { yield ...1 }; [x for x in g()]", "not iterable: INTEGER"},
+	}
+
+	for caseIndex, testCase := range testCases {
+		c := compiler.NewCompiler()
+		if err := c.Compile(parse(testCase.input)); err != nil {
+			t.Fatalf("test case [%d] compile error : [%s]", caseIndex, err.Error())
+		}
+		err := NewVm(c.ByteCode()).Run()
+		if err == nil || err.Error() != testCase.expected {
+			t.Fatalf("test case [%d] expected error [%s], actual [%v]", caseIndex, testCase.expected, err)
+		}
+	}
+}
+
 func TestConditionals(t *testing.T) {
 	testCases := []vmTestCase{
 		{"if (true) { 10 }", 10},
@@ -117,65 +260,76 @@ func TestArrayLiterals(t *testing.T) {
 func TestHashLiterals(t *testing.T) {
 	testCases := []vmTestCase{
 		{
-			input: `{}`,
-			expected: &object.Hash{
-				Pairs: map[object.HashKey]*object.HashPair{},
-			},
+			input:    `{}`,
+			expected: newHash(),
 		},
 		{
 			input: `{1:2, 2:3}`,
-			expected: &object.Hash{
-				Pairs: map[object.HashKey]*object.HashPair{
-					(&object.Integer{Value: 1}).HashKey(): {
-						Key:   &object.Integer{Value: 1},
-						Value: &object.Integer{Value: 2},
-					},
-					(&object.Integer{Value: 2}).HashKey(): {
-						Key:   &object.Integer{Value: 2},
-						Value: &object.Integer{Value: 3},
-					},
+			expected: newHash(
+				&object.HashPair{
+					Key:   &object.Integer{Value: 1},
+					Value: &object.Integer{Value: 2},
 				},
-			},
+				&object.HashPair{
+					Key:   &object.Integer{Value: 2},
+					Value: &object.Integer{Value: 3},
+				},
+			),
 		},
 		{
 			input: `{1+1:2+2, 3+3:4*4}`,
-			expected: &object.Hash{
-				Pairs: map[object.HashKey]*object.HashPair{
-					(&object.Integer{Value: 2}).HashKey(): {
-						Key:   &object.Integer{Value: 2},
-						Value: &object.Integer{Value: 4},
-					},
-					(&object.Integer{Value: 6}).HashKey(): {
-						Key:   &object.Integer{Value: 6},
-						Value: &object.Integer{Value: 16},
-					},
+			expected: newHash(
+				&object.HashPair{
+					Key:   &object.Integer{Value: 2},
+					Value: &object.Integer{Value: 4},
 				},
-			},
+				&object.HashPair{
+					Key:   &object.Integer{Value: 6},
+					Value: &object.Integer{Value: 16},
+				},
+			),
 		},
 		{
 			input: `{1+1:2+2, 3+3:4*4, 100 * 100: 200 - 500}`,
-			expected: &object.Hash{
-				Pairs: map[object.HashKey]*object.HashPair{
-					(&object.Integer{Value: 2}).HashKey(): {
-						Key:   &object.Integer{Value: 2},
-						Value: &object.Integer{Value: 4},
-					},
-					(&object.Integer{Value: 6}).HashKey(): {
-						Key:   &object.Integer{Value: 6},
-						Value: &object.Integer{Value: 16},
-					},
-					(&object.Integer{Value: 10000}).HashKey(): {
-						Key:   &object.Integer{Value: 10000},
-						Value: &object.Integer{Value: -300},
-					},
+			expected: newHash(
+				&object.HashPair{
+					Key:   &object.Integer{Value: 2},
+					Value: &object.Integer{Value: 4},
 				},
-			},
+				&object.HashPair{
+					Key:   &object.Integer{Value: 6},
+					Value: &object.Integer{Value: 16},
+				},
+				&object.HashPair{
+					Key:   &object.Integer{Value: 10000},
+					Value: &object.Integer{Value: -300},
+				},
+			),
 		},
 	}
 
 	runVmTests(t, testCases)
 }
 
+func TestHashInsertionOrder(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: 3, true: 4}`, `{b:1, a:2, 3:3, true:4}`},
+		{`{"c": 0, "b": 1, "a": 2, "b": 3}`, `{c:0, b:3, a:2}`},
+		{`let a = {"x": 1, "y": 2}; {"z": 0, ...a, "x": 3}`, `{z:0, x:3, y:2}`},
+		{`{v: k for [k, v] in {"z": "x", "y": "y", "x": "z"}}`, `{x:z, y:y, z:x}`},
+	}
+
+	for i, tc := range testCases {
+		vm := runVm(t, i, tc.input)
+		if actual := vm.TestOnlyLastPoppedStackElement().Inspect(); actual != tc.expected {
+			t.Errorf("test case [%d] expected = [%s], actual = [%s]", i, tc.expected, actual)
+		}
+	}
+}
+
 func TestIndexExpressions(t *testing.T) {
 	testCases := []vmTestCase{
 		{`[1][0]`, &object.Integer{Value: 1}},
@@ -198,6 +352,272 @@ func TestIndexExpressions(t *testing.T) {
 	runVmTests(t, testCases)
 }
 
+func TestNullSafety(t *testing.T) {
+	testCases := []vmTestCase{
+		{"null", object.NativeNull},
+		{"null ?? 1", 1},
+		{"2 ?? 1", 2},
+		{"false ?? 1", false},
+		{"null ?? null ?? 3", 3},
+		{`{"a": 1}["b"] ?? 5`, 5},
+		{`let user = null; user?.name`, object.NativeNull},
+		{`let user = {"name": "monkey"}; user?.name`, "monkey"},
+		{`let user = {"name": "monkey"}; user?.age ?? 18`, 18},
+		{`let xs = null; xs?[0]`, object.NativeNull},
+		{`let xs = [1, 2]; xs?[1]`, 2},
+		{`let ys = [[1], null]; ys[1]?[0] ?? ys[0]?[0]`, 1},
+		{`let f = fn(x) { x?[0] ?? -1 }; f(null) + f([2])`, 1},
+		{"null == null", true},
+		{"null != null", false},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestSpread(t *testing.T) {
+	testCases := []vmTestCase{
+		{`let a = [1, 2]; [...a, 3, ...a]`, []int{1, 2, 3, 1, 2}},
+		{`let a = [1, 2]; [0, ...a]`, []int{0, 1, 2}},
+		{`[...[], ...[]]`, []int{}},
+		{`let a = [1]; let b = [...a]; len(push(b, 2)) + len(a)`, 3},
+		{
+			input: `let defaults = {"k": 1, "j": 2}; {...defaults, "k": 3}`,
+			expected: newHash(
+				&object.HashPair{
+					Key:   &object.StringObj{Value: "k"},
+					Value: &object.Integer{Value: 3},
+				},
+				&object.HashPair{
+					Key:   &object.StringObj{Value: "j"},
+					Value: &object.Integer{Value: 2},
+				},
+			),
+		},
+		{`let a = {"k": 1}; let b = {"k": 2}; {...a, ...b}["k"]`, 2},
+		{`let h = {"k": 2}; {"k": 1, ...h}["k"]`, 2},
+		{`let h = {"k": 2}; {"k": 1, ...h, "k": 3}["k"]`, 3},
+		{`let add = fn(a, b, c) { a + b + c }; let args = [1, 2]; add(...args, 3)`, 6},
+		{`let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])`, 6},
+		{`let forward = fn(f, args) { f(...args) }; forward(fn(a, b) { a * b }, [3, 4])`, 12},
+		{`let sum = fn(a, b) { let c = a + b; c }; sum(...[1, 2]) + sum(...[3, 4])`, 10},
+		{`len(...["monkey"])`, 6},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestComprehensions(t *testing.T) {
+	testCases := []vmTestCase{
+		{`[x * 2 for x in [1, 2, 3]]`, []int{2, 4, 6}},
+		{`[x for x in [1, -2, 3, -4] if x > 0]`, []int{1, 3}},
+		{`[x for x in []]`, []int{}},
+		{`let x = [1, 2]; [x * 10 for x in x]`, []int{10, 20}},
+		{`let xs = [1, 2]; let y = 3; [x + y for x in xs]`, []int{4, 5}},
+		{`let f = fn(xs, n) { [x * n for x in xs if x != n] }; f([1, 2, 3], 2)`, []int{2, 6}},
+		{`let f = fn(n) { 1 + len([x for x in [1, 2, 3] if x > n]) }; f(1)`, 3},
+		{`[[k, v] for [k, v] in [[1, 2]]][0]`, []int{1, 2}},
+		{`[len(row) for row in [[x, x] for x in [1, 2, 3]]]`, []int{2, 2, 2}},
+		{`[v for [k, v] in {"a": 1}]`, []int{1}},
+		{`[b for [a, b] in [[1]]][0]`, object.NativeNull},
+		{`let fs = [fn() { x } for x in [1, 2, 3]]; fs[0]() + fs[2]()`, 4},
+		{
+			input: `{k: v * 2 for [k, v] in [["a", 1], ["b", 2]] if v > 1}`,
+			expected: newHash(
+				&object.HashPair{
+					Key:   &object.StringObj{Value: "b"},
+					Value: &object.Integer{Value: 4},
+				},
+			),
+		},
+		{`let h = {"a": 1, "b": 2}; {k: v + 1 for [k, v] in h}["b"]`, 3},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestBadComprehensionBytecode(t *testing.T) {
+	// bytecode the compiler never emits fails the run instead of panicking
+	testCases := []struct {
+		instructions []code.Instructions
+		expected     string
+	}{
+		{
+			[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpConstant, 0), code.Make(code.OpArrayAppend)},
+			"type mismatch : expect [ARRAY], actual [INTEGER]",
+		},
+		{
+			[]code.Instructions{code.Make(code.OpConstant, 0), code.Make(code.OpArrayAppend)},
+			"the stack is empty, cannot do pop for OpArrayAppend",
+		},
+		{
+			[]code.Instructions{
+				code.Make(code.OpConstant, 0), code.Make(code.OpConstant, 0), code.Make(code.OpConstant, 0),
+				code.Make(code.OpHashSet),
+			},
+			"type mismatch : expect [HASH], actual [INTEGER]",
+		},
+	}
+
+	for caseIndex, testCase := range testCases {
+		constants := code.NewConstants()
+		constants.AddConstant(&object.Integer{Value: 1})
+		instructions := code.Instructions{}
+		for _, ins := range testCase.instructions {
+			instructions = append(instructions, ins...)
+		}
+
+		err := NewVm(&compiler.ByteCode{Instructions: instructions, Constants: constants}).Run()
+		if err == nil || err.Error() != testCase.expected {
+			t.Errorf("test case [%d] expected error [%s], actual [%v]", caseIndex, testCase.expected, err)
+		}
+	}
+}
+
+func TestComprehensionDoesNotConsumeFrames(t *testing.T) {
+	// builds an array of 10 ^ 4 elements, far more than MaxFrameSize
+	names := []string{"a", "b", "c", "d"}
+	input := "let a = [1, 1, 1, 1, 1, 1, 1, 1, 1, 1];"
+	for i := 1; i < len(names); i++ {
+		input += fmt.Sprintf("let %s = [%s];", names[i], strings.TrimSuffix(strings.Repeat("..."+names[i-1]+", ", 10), ", "))
+	}
+	input += "len([x * 2 for x in d if x > 0])"
+
+	runVmTests(t, []vmTestCase{{input, 10000}})
+}
+
+func TestGenerators(t *testing.T) {
+	testCases := []vmTestCase{
+		{`let g = fn() { yield 1; yield 2 }; [x for x in g()]`, []int{1, 2}},
+		{`let g = fn(n) { yield n; yield n * 2 }; let it = g(3); next(it); next(it)["value"]`, 6},
+		{`let g = fn() { yield 1 }; let it = g(); next(it); next(it)["done"]`, true},
+		{`let g = fn() { yield ...[1, 2]; yield 3 }; [x for x in g()]`, []int{1, 2, 3}},
+		{`let g = fn(xs) { [x for x in xs] }; g(iter(#{1}))`, []int{1}},
+		// a string is iterated by characters rather than bytes
+		{`[c for c in "héllo"]`, []string{"h", "é", "l", "l", "o"}},
+		{`let g = fn() { yield ..."日本" }; [c for c in g()]`, []string{"日", "本"}},
+		{`let f = fn(f, n) { if (n < 3) { yield n; yield ...f(f, n + 1) } }; [x for x in f(f, 0)]`, []int{0, 1, 2}},
+		// a generator is lazy, only the elements asked for are computed
+		{`let count = fn(count, n) { yield n; yield ...count(count, n + 1) }; let it = count(count, 0); next(it); next(it)["value"]`, 1},
+		// a generator delegating to itself by its name, like the naturals of the README
+		{
+			`let naturals = fn(n) { yield n; yield ...naturals(n + 1) };
+let it = naturals(0);
+next(it);
+let take = fn(it, n) { if (n > 0) { yield next(it)["value"]; yield ...take(it, n - 1) } };
+[x * x for x in take(it, 3)]`,
+			[]int{1, 4, 9},
+		},
+		{`let g = fn() { let x = 1; yield x; x + 1 }; [x for x in g()]`, []int{1}},
+		// the stack and the frames of a generator grow beyond their initial size
+		{
+			`let sum = fn(n) { if (n == 0) { return 0; }; return n + sum(n - 1); };
+let g = fn(n) { yield sum(n); yield sum(n * 2) };
+[x for x in g(150)]`,
+			[]int{11325, 45150},
+		},
+		{`next(iter([]))["value"]`, object.NativeNull},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestGeneratorDelegationDoesNotConsumeFrames(t *testing.T) {
+	input := `let count = fn(count, n) { if (n > 0) { yield n; yield ...count(count, n - 1) } }; len([x for x in count(count, 10000)])`
+
+	runVmTests(t, []vmTestCase{{input, 10000}})
+}
+
+func TestGeneratorAskingForItsOwnElement(t *testing.T) {
+	// the generator calls the host back, which asks its iterator for the next element while it's running
+	var iterator *object.Iterator
+	self := &object.BuiltIn{Name: "self", BuiltInFn: func(objs ...object.Object) object.Object {
+		element, _ := iterator.Next(nil)
+		return element
+	}}
+
+	c := compiler.NewCompiler()
+	if err := c.Compile(parse("let g = fn(self) { yield 1; yield self() }")); err != nil {
+		t.Fatalf("compile error : [%s]", err.Error())
+	}
+	v := NewVm(c.ByteCode())
+	if err := v.Run(); err != nil {
+		t.Fatalf("vm error : [%s]", err.Error())
+	}
+	caller := NewVmWithState(&compiler.ByteCode{Constants: c.ByteCode().Constants}, v)
+	obj, err := caller.CallWithContext(context.Background(), common.Limits{}, v.Global(0), self)
+	if err != nil {
+		t.Fatalf("vm error : [%s]", err.Error())
+	}
+	iterator = obj.(*object.Iterator)
+
+	element, _ := iterator.Next(nil)
+	testIntegerObject(t, 0, 1, element)
+	element, ok := iterator.Next(nil)
+	if err, isError := element.(*object.Error); !ok || !isError || !errors.Is(err, common.ErrGeneratorRunning) {
+		t.Fatalf("expected a generator already executing error, actual [%v]", element)
+	}
+	if _, ok = iterator.Next(nil); ok {
+		t.Fatalf("expected the generator to be done after its error")
+	}
+}
+
+func TestOperatorOverloading(t *testing.T) {
+	vec := `let plus = fn(a, b) { {...a, "x": a["x"] + b["x"], "y": a["y"] + b["y"]} };
+let scale = fn(a, k) { {...a, "x": a["x"] * k, "y": a["y"] * k} };
+let same = fn(a, b) { [a["x"], a["y"]] == [b["x"], b["y"]] };
+let vec = fn(x, y) { {"x": x, "y": y, "__add__": plus, "__mul__": scale, "__eq__": same} };
+`
+	testCases := []vmTestCase{
+		{vec + `(vec(1, 2) + vec(3, 4))["y"]`, 6},
+		{vec + `(vec(1, 2) * 3)["x"]`, 3},
+		// the method of the rhs is called when the lhs has none
+		{`let cents = {"__add__": fn(a, b) { a + b["value"] }, "value": 5}; 1 + cents`, 6},
+		{vec + `vec(1, 2) == vec(1, 2)`, true},
+		{vec + `vec(1, 2) != vec(1, 2)`, false},
+		{vec + `vec(1, 2) != vec(2, 1)`, true},
+		{vec + `let f = fn(a, b) { if (a != b) { 1 } else { 2 } }; f(vec(1, 2), vec(1, 2)) + 10`, 12},
+		{`let money = {"__lt__": fn(a, b) { a["cents"] < b["cents"] }, "cents": 1}; money < {"cents": 2}`, true},
+		{`{"__eq__": contains, "a": 1} != "a"`, false},
+		{`{"__eq__": fn(a, b) {}} != 1`, true},
+		// the value of a comparison is converted to a Boolean by its truthiness
+		{`{"__eq__": fn(a, b) { "yes" }} == 2`, true},
+		{`{"__eq__": fn(a, b) { "yes" }} != 2`, false},
+		{`{"__eq__": fn(a, b) {}} == 2`, false},
+		{`{"__eq__": dissoc} == "a"`, true},
+		{`{"__eq__": dissoc} != "a"`, false},
+		{`{"__lt__": fn(a, b) { null }} < 1`, false},
+		{`{"__gt__": fn(a, b) { 1 }} > 1`, true},
+		{`{"__add__": fn(a, b) { "sum" }} + 1`, "sum"},
+		{`{"__add__": 1} == {"__add__": 1}`, true},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestUserDefinedInfixOperators(t *testing.T) {
+	testCases := []vmTestCase{
+		{"infix 45 <+> (a, b) => a * 10 + b\n1 <+> 2", 12},
+		{"infix 45 <+> (a, b) => a * 10 + b\n1 <+> 2 <+> 3", 123},
+		{"infixr 45 <+> (a, b) => a * 10 + b\n1 <+> 2 <+> 3", 33},
+		{"infix 45 <+> (a, b) => a * 10 + b\n1 + 2 <+> 3 * 2", 27},
+		{"infix 15 |> (x, f) => f(x)\nlet double = fn(x) { x * 2 }\n3 |> double |> double", 12},
+		{"let n = 100\ninfix 45 %% (a, b) => a + b + n\nlet f = fn(x) { x %% 1 }\nf(1)", 102},
+		{"let f = fn() { infix 45 ++ (a, b) => a - b; 5 ++ 3 }\nf()", 2},
+	}
+
+	runVmTests(t, testCases)
+}
+
+func TestRecursiveGlobalFunctions(t *testing.T) {
+	testCases := []vmTestCase{
+		{"let fact = fn(n) { if (n == 0) { return 1; }; n * fact(n - 1) }; fact(5)", 120},
+		{"let fib = fn(n) { if (n < 2) { return n; }; fib(n - 1) + fib(n - 2) }; let f = fib; f(10)", 55},
+		{"let count = fn(n) { if (n == 0) { return 0; }; 1 + count(n - 1) }; let g = fn() { count(3) }; g()", 3},
+	}
+
+	runVmTests(t, testCases)
+}
+
 func TestCallingFunctionsWithoutArgument(t *testing.T) {
 	testCases := []vmTestCase{
 		{
@@ -480,6 +900,22 @@ first(a);
 `,
 			expected: &object.Integer{Value: -100},
 		},
+		{
+			input:    `let a = [1, 2, 3]; let b = assoc(a, 1, 5); a[1] * 10 + b[1]`,
+			expected: &object.Integer{Value: 25},
+		},
+		{
+			input:    `let a = [1, 2, 3]; let b = rest(a); len(a) * 10 + first(b)`,
+			expected: &object.Integer{Value: 32},
+		},
+		{
+			input:    `let h = {"a": 1}; let g = assoc(h, "a", 2); h["a"] * 10 + g["a"]`,
+			expected: &object.Integer{Value: 12},
+		},
+		{
+			input:    `let h = {"a": 1, "b": 2}; let g = dissoc(h, "a"); [h == {"a": 1, "b": 2}, g == {"b": 2}] == [true, true]`,
+			expected: object.NativeTrue,
+		},
 	}
 
 	runVmTests(t, testCases)
@@ -563,11 +999,131 @@ closure();
 `,
 			expected: 99,
 		},
+		{
+			input: `
+let newAdder = fn(a) {
+	fn(b) { a + b };
+};
+let addOne = newAdder(1);
+let addTwo = newAdder(2);
+addOne(1);
+`,
+			expected: 2,
+		},
+		{
+			input: `
+let f = fn(a) {
+	let g = fn() { a };
+	a + g();
+};
+f(2);
+`,
+			expected: 4,
+		},
 	}
 
 	runVmTests(t, testCases)
 }
 
+func TestLimits(t *testing.T) {
+	testCases := []struct {
+		input    string
+		limits   common.Limits
+		expected error
+	}{
+		{"let f = fn(f, n) { f(f, n + 1) }; f(f, 0)", common.Limits{MaxSteps: 1000}, common.ErrStepLimitExceeded},
+		{"let f = fn(f, n) { f(f, n + 1) }; f(f, 0)", common.Limits{MaxCallDepth: 10}, common.ErrCallDepthExceeded},
+		{"let f = fn(f, n) { f(f, n + 1) }; f(f, 0)", common.Limits{}, common.ErrCallDepthExceeded},
+		{"let grow = fn(grow, a) { grow(grow, [...a, ...a]) }; grow(grow, [1])", common.Limits{MaxAllocations: 1000}, common.ErrAllocationLimitExceeded},
+		{`let grow = fn(grow, s) { grow(grow, s + s) }; grow(grow, "a")`, common.Limits{MaxAllocations: 1000}, common.ErrAllocationLimitExceeded},
+		{"let a = [1, 2, 3, 4, 5]; [x * 2 for x in a]", common.Limits{MaxAllocations: 8}, common.ErrAllocationLimitExceeded},
+		{"{1: 1, 2: 2, 3: 3}", common.Limits{MaxAllocations: 2}, common.ErrAllocationLimitExceeded},
+		{"push([1, 2], 3)", common.Limits{MaxAllocations: 4}, common.ErrAllocationLimitExceeded},
+	}
+
+	for caseIndex, testCase := range testCases {
+		c := compiler.NewCompiler()
+		if err := c.Compile(parse(testCase.input)); err != nil {
+			t.Fatalf("test case [%d] compile error : [%s]", caseIndex, err.Error())
+		}
+		err := NewVm(c.ByteCode()).RunWithContext(context.Background(), testCase.limits)
+		if !errors.Is(err, testCase.expected) {
+			t.Fatalf("test case [%d] expected error [%v], actual [%v]", caseIndex, testCase.expected, err)
+		}
+	}
+
+	// the limits which are not exceeded don't change the result
+	c := compiler.NewCompiler()
+	_ = c.Compile(parse("let fib = fn(fib, n) { if (n < 2) { return n; }; return fib(fib, n - 1) + fib(fib, n - 2); }; fib(fib, 10)"))
+	vm := NewVm(c.ByteCode())
+	err := vm.RunWithContext(context.Background(), common.Limits{MaxSteps: 100000, MaxCallDepth: 20, MaxAllocations: 10})
+	if err != nil {
+		t.Fatalf("vm error : [%s]", err.Error())
+	}
+	testIntegerObject(t, 0, 55, vm.TestOnlyLastPoppedStackElement())
+}
+
+func TestGeneratorRunsUnderTheLimitsOfTheConsumer(t *testing.T) {
+	var c *compiler.Compiler
+	var v *Vm
+	runWithLimits := func(input string, limits common.Limits) error {
+		if c == nil {
+			c = compiler.NewCompiler()
+		} else {
+			c = compiler.NewCompilerWithState(c)
+		}
+		if err := c.Compile(parse(input)); err != nil {
+			t.Fatalf("compile error : [%s]", err.Error())
+		}
+		if v == nil {
+			v = NewVm(c.ByteCode())
+		} else {
+			v = NewVmWithState(c.ByteCode(), v)
+		}
+		return v.RunWithContext(context.Background(), limits)
+	}
+
+	// the generator is created by a run with a tight budget, and drained by one with a larger budget
+	err := runWithLimits(`let count = fn(n) { if (n > 0) { yield n; yield ...count(n - 1) } }; let it = count(1000)`,
+		common.Limits{MaxSteps: 100})
+	if err != nil {
+		t.Fatalf("vm error : [%s]", err.Error())
+	}
+	if err = runWithLimits("len([x for x in it])", common.Limits{MaxSteps: 100000}); err != nil {
+		t.Fatalf("vm error : [%s]", err.Error())
+	}
+	testIntegerObject(t, 0, 1000, v.LastPopped())
+
+	// and the other way around
+	_ = runWithLimits("let it = count(1000)", common.Limits{})
+	if err = runWithLimits("len([x for x in it])", common.Limits{MaxSteps: 1000}); !errors.Is(err, common.ErrStepLimitExceeded) {
+		t.Fatalf("expected a step limit error, actual [%v]", err)
+	}
+	_ = runWithLimits("let it = count(1000)", common.Limits{})
+	if err = runWithLimits("next(it); next(it)", common.Limits{MaxSteps: 10}); !errors.Is(err, common.ErrStepLimitExceeded) {
+		t.Fatalf("expected a step limit error, actual [%v]", err)
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	c := compiler.NewCompiler()
+	_ = c.Compile(parse("let fib = fn(fib, n) { if (n < 2) { return n; }; return fib(fib, n - 1) + fib(fib, n - 2); }; fib(fib, 40)"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := NewVm(c.ByteCode()).RunWithContext(ctx, common.Limits{})
+	if !errors.Is(err, common.ErrCancelled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a cancelled error, actual [%v]", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = NewVm(c.ByteCode()).RunWithContext(ctx, common.Limits{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled error, actual [%v]", err)
+	}
+}
+
 func runVmTests(t *testing.T, testCases []vmTestCase) {
 	t.Helper()
 
@@ -608,7 +1164,7 @@ func testExpectedObject(t *testing.T, caseIndex int, expected interface{}, actua
 		}
 	case string:
 		testStringObject(t, caseIndex, actual, expected)
-	case []int:
+	case []int, []string:
 		testArrayObject(t, caseIndex, expected, actual)
 	case *object.Hash:
 		testHashObject(t, caseIndex, expected, actual)
@@ -629,14 +1185,23 @@ func testArrayObject(t *testing.T, caseIndex int, expected any, actual object.Ob
 		return
 	}
 
-	if len(actualArray.Elements) != v.Len() {
-		t.Fatalf("test case [%d] length not match, expected = [%d], actual = [%d]", caseIndex, v.Len(), len(actualArray.Elements))
+	if actualArray.Size() != v.Len() {
+		t.Fatalf("test case [%d] length not match, expected = [%d], actual = [%d]", caseIndex, v.Len(), actualArray.Size())
 	}
-	for i, element := range actualArray.Elements {
+	for i, element := range actualArray.Elements() {
 		testExpectedObject(t, caseIndex, v.Index(i).Interface(), element)
 	}
 }
 
+// newHash build the expected hash from the pairs in their insertion order
+func newHash(pairs ...*object.HashPair) *object.Hash {
+	hash := object.NewHash()
+	for _, pair := range pairs {
+		hash.Set(pair.Key.(object.Hashable), pair.Value)
+	}
+	return hash
+}
+
 func testHashObject(t *testing.T, caseIndex int, expected any, actual object.Object) {
 	t.Helper()
 
@@ -649,14 +1214,15 @@ func testHashObject(t *testing.T, caseIndex int, expected any, actual object.Obj
 	if !ok {
 		t.Errorf("object not match : expected [%T] actual [%+v]", expected, actual)
 	}
-	if len(actualArray.Pairs) != len(expectedHash.Pairs) {
-		t.Fatalf("test case [%d] length not match, expected = [%d], actual = [%d]", caseIndex, len(expectedHash.Pairs), len(actualArray.Pairs))
+	if actualArray.Len() != expectedHash.Len() {
+		t.Fatalf("test case [%d] length not match, expected = [%d], actual = [%d]", caseIndex, expectedHash.Len(), actualArray.Len())
 	}
 
-	for k, element := range actualArray.Pairs {
-		pair, ok := expectedHash.Pairs[k]
-		if !ok {
-			t.Fatalf("test case [%d] does't contains key = [%s]", caseIndex, k.Type)
+	// the pairs must be in the same insertion order
+	for i, element := range actualArray.Pairs() {
+		pair := expectedHash.Pairs()[i]
+		if element.Key.Inspect() != pair.Key.Inspect() {
+			t.Fatalf("test case [%d] key [%d] not match, expected = [%s], actual = [%s]", caseIndex, i, pair.Key.Inspect(), element.Key.Inspect())
 		}
 		testExpectedObject(t, caseIndex, pair.Value, element.Value)
 	}
@@ -4,6 +4,7 @@ import (
 	"0x822a5b87/monkey/interpreter/token"
 	"bytes"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -39,6 +40,8 @@ type Expression interface {
 // every valid monkey program is a serials of  statements.
 type Program struct {
 	Statements []Statement
+	// Comments the comments of the source code in order, they don't affect the execution of the program
+	Comments []*Comment
 }
 
 func (p *Program) TokenLiteral() string {
@@ -56,10 +59,34 @@ func (p *Program) String() string {
 	return buffer.String()
 }
 
+// Comment a line comment from // to the end of line, the literal of the token is the text including the //
+type Comment struct {
+	Token token.Token
+}
+
+func (c *Comment) TokenLiteral() string {
+	return c.Token.Literal
+}
+
+func (c *Comment) String() string {
+	return c.Token.Literal
+}
+
 // Identifier note that identifier is an Expression
 type Identifier struct {
 	Token token.Token
 	Value string
+
+	// depth and slot locate the binding the identifier refers to, see Resolve
+	depth    int
+	slot     int
+	resolved bool
+}
+
+// Binding the depth and the slot of the local binding the identifier refers to,
+// ok is false if the identifier is not resolved to a local binding
+func (identifier *Identifier) Binding() (depth, slot int, ok bool) {
+	return identifier.depth, identifier.slot, identifier.resolved
 }
 
 func (identifier *Identifier) expressionNode() {}
@@ -102,6 +129,31 @@ func (r *ReturnStatement) String() string {
 }
 func (r *ReturnStatement) statementNode() {}
 
+// YieldStatement `yield value;` produce the value as the next element of the generator and suspend it until the
+// element after is asked for, `yield ...iterable;` yield every element of the iterable.
+// A function whose body contains a yield statement, outside the nested functions, is a generator, see FnLiteral.
+type YieldStatement struct {
+	Token token.Token
+	Value Expression
+	// Spread the value is an iterable whose elements are yielded, instead of the value itself
+	Spread bool
+	// Tail the spread is the last thing the generator does, so the generator can hand its iterator over to the
+	// iterable instead of yielding the elements one by one, which keeps a generator delegating to itself
+	// recursively, like an infinite sequence, in constant space
+	Tail bool
+}
+
+func (y *YieldStatement) TokenLiteral() string {
+	return y.Token.Literal
+}
+func (y *YieldStatement) String() string {
+	if y.Spread {
+		return fmt.Sprintf("%s ...%s;", y.Token.Literal, y.Value.String())
+	}
+	return fmt.Sprintf("%s %s;", y.Token.Literal, y.Value.String())
+}
+func (y *YieldStatement) statementNode() {}
+
 // ExpressionStatement we need it because it's totally legal in monkey to write the following code:
 // let x = 10;
 // x + 10;
@@ -143,6 +195,22 @@ func (i *IntegerLiteral) String() string {
 
 func (i *IntegerLiteral) expressionNode() {}
 
+// BigIntegerLiteral an integer literal out of the range of int64
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (b *BigIntegerLiteral) TokenLiteral() string {
+	return b.Token.Literal
+}
+
+func (b *BigIntegerLiteral) String() string {
+	return b.Value.String()
+}
+
+func (b *BigIntegerLiteral) expressionNode() {}
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -197,10 +265,25 @@ func (boolExpr *BooleanExpression) String() string {
 
 func (boolExpr *BooleanExpression) expressionNode() {}
 
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (n *NullLiteral) TokenLiteral() string {
+	return n.Token.Literal
+}
+
+func (n *NullLiteral) String() string {
+	return n.Token.Literal
+}
+
+func (n *NullLiteral) expressionNode() {}
+
 type CallExpression struct {
 	Token     token.Token
 	Fn        Expression
 	Arguments []Expression
+	End       token.Token // the ')' token
 }
 
 func (callExpr *CallExpression) TokenLiteral() string {
@@ -254,8 +337,9 @@ func (ie *IfExpression) String() string {
 func (ie *IfExpression) expressionNode() {}
 
 type BlockStatement struct {
-	Token      token.Token
+	Token      token.Token // the '{' token
 	Statements []Statement
+	End        token.Token // the '}' token
 }
 
 func (bs *BlockStatement) TokenLiteral() string {
@@ -276,6 +360,16 @@ type FnLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	// Generator the body yields, so a call returns an iterator over the yielded values instead of running the body
+	Generator bool
+
+	// locals the names of the slots of the frame of a call, see Resolve
+	locals []string
+}
+
+// Locals the names of the slots of the frame of a call, the parameters come first
+func (f *FnLiteral) Locals() []string {
+	return f.locals
 }
 
 func (f *FnLiteral) TokenLiteral() string {
@@ -316,6 +410,7 @@ func (s *StringLiteral) expressionNode() {}
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	End      token.Token // the ']' token
 }
 
 func (a *ArrayLiteral) TokenLiteral() string {
@@ -336,10 +431,35 @@ func (a *ArrayLiteral) String() string {
 
 func (a *ArrayLiteral) expressionNode() {}
 
+// SetLiteral #{1, 2, 3}, the duplicate elements are kept only once, at the position they first appear
+type SetLiteral struct {
+	Token    token.Token
+	Elements []Expression
+	End      token.Token // the '}' token
+}
+
+func (s *SetLiteral) TokenLiteral() string {
+	return s.Token.Literal
+}
+
+func (s *SetLiteral) String() string {
+	elements := make([]string, 0, len(s.Elements))
+	for _, expr := range s.Elements {
+		elements = append(elements, expr.String())
+	}
+	return "#{" + strings.Join(elements, ", ") + "}"
+}
+
+func (s *SetLiteral) expressionNode() {}
+
+// IndexExpression represents lhs[index], as well as the null-safe forms lhs?[index] and lhs?.name.
+// For lhs?.name, the Index is a StringLiteral holding the name.
 type IndexExpression struct {
 	Token token.Token
 	Lhs   Expression
 	Index Expression
+	// Optional the expression evaluates to null instead of indexing when Lhs is null
+	Optional bool
 }
 
 func (i *IndexExpression) TokenLiteral() string {
@@ -350,6 +470,15 @@ func (i *IndexExpression) String() string {
 	buffer := bytes.Buffer{}
 	buffer.WriteString("(")
 	buffer.WriteString(i.Lhs.String())
+	if i.Token.Type == token.OptionalChaining {
+		buffer.WriteString("?.")
+		buffer.WriteString(i.Index.String())
+		buffer.WriteString(")")
+		return buffer.String()
+	}
+	if i.Optional {
+		buffer.WriteString("?")
+	}
 	buffer.WriteString("[")
 	buffer.WriteString(i.Index.String())
 	buffer.WriteString("])")
@@ -360,7 +489,24 @@ func (i *IndexExpression) expressionNode() {}
 
 type HashExpression struct {
 	Token token.Token
-	Pairs map[Expression]Expression
+	// Pairs the pairs in the order they are written, which is also the order of the evaluated hash.
+	// The later pairs override the earlier ones, so {...defaults, "k": v} always overrides "k".
+	Pairs []*HashPair
+	End   token.Token // the '}' token
+}
+
+// HashPair a key-value pair of a HashExpression, or a spread {...other} when Spread is not nil
+type HashPair struct {
+	Key    Expression
+	Value  Expression
+	Spread *SpreadExpression
+}
+
+func (p *HashPair) String() string {
+	if p.Spread != nil {
+		return p.Spread.String()
+	}
+	return fmt.Sprintf("%s:%s", p.Key.String(), p.Value.String())
 }
 
 func (m *HashExpression) TokenLiteral() string {
@@ -372,8 +518,8 @@ func (m *HashExpression) String() string {
 	buffer.WriteString("{")
 
 	elements := make([]string, 0)
-	for k, v := range m.Pairs {
-		elements = append(elements, fmt.Sprintf("%s:%s", k.String(), v.String()))
+	for _, pair := range m.Pairs {
+		elements = append(elements, pair.String())
 	}
 
 	buffer.WriteString(strings.Join(elements, ", "))
@@ -382,3 +528,152 @@ func (m *HashExpression) String() string {
 }
 
 func (m *HashExpression) expressionNode() {}
+
+// SpreadExpression ...value, it expands an array into array literals and call arguments,
+// or a hash into hash literals.
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (s *SpreadExpression) TokenLiteral() string {
+	return s.Token.Literal
+}
+
+func (s *SpreadExpression) String() string {
+	return "..." + s.Value.String()
+}
+
+func (s *SpreadExpression) expressionNode() {}
+
+// ComprehensionClause the `for target in iterable if condition` part shared by array and hash comprehensions.
+// The target is either a single identifier, or a list of identifiers like [k, v] which destructures the element.
+type ComprehensionClause struct {
+	Token       token.Token // the 'for' token
+	Targets     []*Identifier
+	Destructure bool
+	Iterable    Expression
+	// Condition is optional, the elements for which it is not truthy are skipped
+	Condition Expression
+
+	// locals the names of the slots of the frame of an iteration, see Resolve
+	locals []string
+}
+
+// Locals the names of the slots of the frame of an iteration, the targets come first
+func (c *ComprehensionClause) Locals() []string {
+	return c.locals
+}
+
+func (c *ComprehensionClause) TokenLiteral() string {
+	return c.Token.Literal
+}
+
+func (c *ComprehensionClause) String() string {
+	buffer := bytes.Buffer{}
+	buffer.WriteString("for ")
+	targets := make([]string, 0)
+	for _, target := range c.Targets {
+		targets = append(targets, target.String())
+	}
+	if c.Destructure {
+		buffer.WriteString("[" + strings.Join(targets, ", ") + "]")
+	} else {
+		buffer.WriteString(strings.Join(targets, ", "))
+	}
+	buffer.WriteString(" in ")
+	buffer.WriteString(c.Iterable.String())
+	if c.Condition != nil {
+		buffer.WriteString(" if ")
+		buffer.WriteString(c.Condition.String())
+	}
+	return buffer.String()
+}
+
+// ArrayComprehension [element for target in iterable if condition]
+type ArrayComprehension struct {
+	Token   token.Token // the '[' token
+	Element Expression
+	Clause  *ComprehensionClause
+}
+
+func (a *ArrayComprehension) TokenLiteral() string {
+	return a.Token.Literal
+}
+
+func (a *ArrayComprehension) String() string {
+	return "[" + a.Element.String() + " " + a.Clause.String() + "]"
+}
+
+func (a *ArrayComprehension) expressionNode() {}
+
+// HashComprehension {key: value for target in iterable if condition}
+type HashComprehension struct {
+	Token  token.Token // the '{' token
+	Key    Expression
+	Value  Expression
+	Clause *ComprehensionClause
+}
+
+func (h *HashComprehension) TokenLiteral() string {
+	return h.Token.Literal
+}
+
+func (h *HashComprehension) String() string {
+	return "{" + h.Key.String() + ":" + h.Value.String() + " " + h.Clause.String() + "}"
+}
+
+func (h *HashComprehension) expressionNode() {}
+
+// InfixDeclaration infix 45 <+> (a, b) => expr declares a user-defined infix operator, infixr declares a right
+// associative one. It binds the operator to a function of the two operands, and it is lowered to
+// `let <+> = fn(a, b) { expr }`, the name of the binding can never collide with an identifier.
+type InfixDeclaration struct {
+	Token            token.Token // the 'infix' or 'infixr' token
+	Precedence       int64
+	RightAssociative bool
+	Operator         string
+	Params           []*Identifier
+	Body             Expression
+
+	// locals the names of the slots of the frame of a call, see Resolve
+	locals []string
+}
+
+func (d *InfixDeclaration) TokenLiteral() string {
+	return d.Token.Literal
+}
+
+func (d *InfixDeclaration) String() string {
+	return fmt.Sprintf("%s %d %s (%s, %s) => %s",
+		d.Token.Literal, d.Precedence, d.Operator, d.Params[0].String(), d.Params[1].String(), d.Body.String())
+}
+
+func (d *InfixDeclaration) statementNode() {}
+
+// Lower the let statement binding the operator to its function
+func (d *InfixDeclaration) Lower() *LetStatement {
+	body := &BlockStatement{
+		Token:      d.Token,
+		Statements: []Statement{&ExpressionStatement{Token: d.Token, Expr: d.Body}},
+	}
+	return &LetStatement{
+		Token: d.Token,
+		Name:  &Identifier{Token: d.Token, Value: d.Operator},
+		Value: &FnLiteral{Token: d.Token, Parameters: d.Params, Body: body, locals: d.locals},
+	}
+}
+
+// IsUserDefined reports whether the operator is declared by an InfixDeclaration
+func (ie *InfixExpression) IsUserDefined() bool {
+	return ie.Token.Type == token.OPERATOR
+}
+
+// LowerToCall lhs <+> rhs is a call of the function bound to the operator: <+>(lhs, rhs)
+func (ie *InfixExpression) LowerToCall() *CallExpression {
+	return &CallExpression{
+		Token:     ie.Token,
+		Fn:        &Identifier{Token: ie.Token, Value: ie.Operator},
+		Arguments: []Expression{ie.Lhs, ie.Rhs},
+	}
+}
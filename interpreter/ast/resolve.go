@@ -0,0 +1,138 @@
+package ast
+
+// Resolve assign every local binding a slot in the frame of its scope, and every identifier referring to a local
+// binding its (depth, slot), the depth is the number of frames between the identifier and the binding.
+//
+// A function literal, an infix declaration and a comprehension clause are scopes, the blocks are not, and the top
+// level is not either, so the globals and the builtins are left unresolved and looked up by their names.
+// The bindings declared by let statements are hoisted to the start of their scope, so an identifier used
+// before the let statement which declares it, like a recursive closure, still refers to its slot.
+// The parser resolves the programs it parses, the evaluator only reads the resolution and falls back to the names
+// of the identifiers which are not resolved. Resolve can run again on the same tree, it replaces the previous
+// resolution.
+func Resolve(node Node) {
+	Walk(node, &resolver{})
+}
+
+// scope the bindings of a frame in the order of their slots
+type scope struct {
+	names []string
+	slots map[string]int
+}
+
+func (s *scope) declare(name string) {
+	if _, ok := s.slots[name]; !ok {
+		s.slots[name] = len(s.names)
+		s.names = append(s.names, name)
+	}
+}
+
+type resolver struct {
+	scopes []*scope
+}
+
+func (r *resolver) Visit(node Node) Visitor {
+	switch node := node.(type) {
+	case *Identifier:
+		r.lookup(node)
+	case *FnLiteral:
+		node.locals = r.function(node.Parameters, node.Body)
+		return nil
+	case *InfixDeclaration:
+		node.locals = r.function(node.Params, node.Body)
+		return nil
+	case *ArrayComprehension:
+		r.comprehension(node.Clause, node.Element)
+		return nil
+	case *HashComprehension:
+		r.comprehension(node.Clause, node.Key, node.Value)
+		return nil
+	}
+	return r
+}
+
+// function resolve the function in a scope of its own, the parameters take the first slots
+func (r *resolver) function(params []*Identifier, body Node) []string {
+	s := r.push()
+	for _, param := range params {
+		s.declare(param.Value)
+	}
+	hoist(s, body)
+
+	for _, param := range params {
+		Walk(param, r)
+	}
+	Walk(body, r)
+	r.pop()
+	return s.names
+}
+
+// comprehension the iterable is resolved in the enclosing scope, and the others in the scope of the clause
+func (r *resolver) comprehension(clause *ComprehensionClause, exprs ...Expression) {
+	Walk(clause.Iterable, r)
+
+	s := r.push()
+	for _, target := range clause.Targets {
+		s.declare(target.Value)
+	}
+	exprs = append(exprs, clause.Condition)
+	for _, expr := range exprs {
+		if expr != nil {
+			hoist(s, expr)
+		}
+	}
+
+	for _, target := range clause.Targets {
+		Walk(target, r)
+	}
+	for _, expr := range exprs {
+		walkExpression(expr, r)
+	}
+	r.pop()
+	clause.locals = s.names
+}
+
+func (r *resolver) push() *scope {
+	s := &scope{slots: make(map[string]int)}
+	r.scopes = append(r.scopes, s)
+	return s
+}
+
+func (r *resolver) pop() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+// lookup resolve the identifier to the innermost binding of its name, or leave it unresolved if it's global
+func (r *resolver) lookup(identifier *Identifier) {
+	identifier.resolved = false
+	for depth := 0; depth < len(r.scopes); depth++ {
+		s := r.scopes[len(r.scopes)-1-depth]
+		if slot, ok := s.slots[identifier.Value]; ok {
+			identifier.depth, identifier.slot, identifier.resolved = depth, slot, true
+			return
+		}
+	}
+}
+
+// hoist declare the bindings of the let statements and the infix declarations of the scope,
+// which are not inside a nested scope
+func hoist(s *scope, node Node) {
+	Inspect(node, func(node Node) bool {
+		switch node := node.(type) {
+		case *LetStatement:
+			s.declare(node.Name.Value)
+		case *InfixDeclaration:
+			s.declare(node.Operator)
+			return false
+		case *FnLiteral:
+			return false
+		case *ArrayComprehension:
+			hoist(s, node.Clause.Iterable)
+			return false
+		case *HashComprehension:
+			hoist(s, node.Clause.Iterable)
+			return false
+		}
+		return true
+	})
+}
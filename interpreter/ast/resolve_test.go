@@ -0,0 +1,66 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	block := func(statements ...Statement) *BlockStatement { return &BlockStatement{Statements: statements} }
+
+	// let f = fn(x) { let g = fn() { x + y + z }; let y = 1; g }
+	// [e + x for e in x]
+	x, y, z, g := ident("x"), ident("y"), ident("z"), ident("g")
+	inner := &FnLiteral{Body: block(&ExpressionStatement{Expr: &InfixExpression{
+		Lhs:      &InfixExpression{Lhs: x, Operator: "+", Rhs: y},
+		Operator: "+",
+		Rhs:      z,
+	}})}
+	outer := &FnLiteral{Parameters: []*Identifier{ident("x")}, Body: block(
+		&LetStatement{Name: ident("g"), Value: inner},
+		&LetStatement{Name: ident("y"), Value: &IntegerLiteral{Value: 1}},
+		&ExpressionStatement{Expr: g},
+	)}
+	e, topX, iterable := ident("e"), ident("x"), ident("x")
+	clause := &ComprehensionClause{Targets: []*Identifier{ident("e")}, Iterable: iterable}
+	program := &Program{Statements: []Statement{
+		&LetStatement{Name: ident("f"), Value: outer},
+		&ExpressionStatement{Expr: &ArrayComprehension{
+			Element: &InfixExpression{Lhs: e, Operator: "+", Rhs: topX},
+			Clause:  clause,
+		}},
+	}}
+	Resolve(program)
+
+	if !reflect.DeepEqual(outer.Locals(), []string{"x", "g", "y"}) {
+		t.Errorf("expected outer locals [x g y], got %v", outer.Locals())
+	}
+	if len(inner.Locals()) != 0 {
+		t.Errorf("expected no inner locals, got %v", inner.Locals())
+	}
+	if !reflect.DeepEqual(clause.Locals(), []string{"e"}) {
+		t.Errorf("expected clause locals [e], got %v", clause.Locals())
+	}
+
+	tests := []struct {
+		identifier *Identifier
+		depth      int
+		slot       int
+		ok         bool
+	}{
+		{x, 1, 0, true},
+		{y, 1, 2, true},
+		{z, 0, 0, false},
+		{g, 0, 1, true},
+		{e, 0, 0, true},
+		{topX, 0, 0, false},
+		{iterable, 0, 0, false},
+	}
+	for i, tt := range tests {
+		depth, slot, ok := tt.identifier.Binding()
+		if ok != tt.ok || (ok && (depth != tt.depth || slot != tt.slot)) {
+			t.Errorf("test case [%d] expected [%d %d %t], got [%d %d %t]", i, tt.depth, tt.slot, tt.ok, depth, slot, ok)
+		}
+	}
+}
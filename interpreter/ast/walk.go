@@ -0,0 +1,220 @@
+package ast
+
+// Visitor the Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children of node with the visitor w,
+// followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order, the children are visited in the order they are written.
+// The comments of a program are not part of the tree and are not visited.
+func Walk(node Node, v Visitor) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			Walk(stmt, v)
+		}
+	case *LetStatement:
+		Walk(node.Name, v)
+		Walk(node.Value, v)
+	case *ReturnStatement:
+		walkExpression(node.ReturnValue, v)
+	case *YieldStatement:
+		Walk(node.Value, v)
+	case *ExpressionStatement:
+		walkExpression(node.Expr, v)
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			Walk(stmt, v)
+		}
+	case *InfixDeclaration:
+		for _, param := range node.Params {
+			Walk(param, v)
+		}
+		Walk(node.Body, v)
+	case *PrefixExpression:
+		Walk(node.Right, v)
+	case *InfixExpression:
+		Walk(node.Lhs, v)
+		Walk(node.Rhs, v)
+	case *CallExpression:
+		Walk(node.Fn, v)
+		for _, argument := range node.Arguments {
+			Walk(argument, v)
+		}
+	case *IfExpression:
+		Walk(node.Condition, v)
+		Walk(node.Consequence, v)
+		if node.Alternative != nil {
+			Walk(node.Alternative, v)
+		}
+	case *FnLiteral:
+		for _, param := range node.Parameters {
+			Walk(param, v)
+		}
+		Walk(node.Body, v)
+	case *ArrayLiteral:
+		for _, element := range node.Elements {
+			Walk(element, v)
+		}
+	case *SetLiteral:
+		for _, element := range node.Elements {
+			Walk(element, v)
+		}
+	case *IndexExpression:
+		Walk(node.Lhs, v)
+		Walk(node.Index, v)
+	case *HashExpression:
+		for _, pair := range node.Pairs {
+			if pair.Spread != nil {
+				Walk(pair.Spread, v)
+				continue
+			}
+			Walk(pair.Key, v)
+			Walk(pair.Value, v)
+		}
+	case *SpreadExpression:
+		Walk(node.Value, v)
+	case *ComprehensionClause:
+		for _, target := range node.Targets {
+			Walk(target, v)
+		}
+		Walk(node.Iterable, v)
+		walkExpression(node.Condition, v)
+	case *ArrayComprehension:
+		Walk(node.Element, v)
+		Walk(node.Clause, v)
+	case *HashComprehension:
+		Walk(node.Key, v)
+		Walk(node.Value, v)
+		Walk(node.Clause, v)
+	}
+
+	v.Visit(nil)
+}
+
+// walkExpression walk the expression unless it's nil
+func walkExpression(expr Expression, v Visitor) {
+	if expr != nil {
+		Walk(expr, v)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order like Walk: It starts by calling f(node),
+// and if f returns true, Inspect invokes f recursively for each of the children of node, followed by f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(node, inspector(f))
+}
+
+// ModifierFunc returns the node which replaces the given node
+type ModifierFunc func(Node) Node
+
+// Modify rewrites an AST from the bottom up: the children of the node are modified first, and then the node
+// itself is replaced by modifier(node). The children are replaced in place, and the modifier must return
+// a node that fits the position, an Expression for an expression and an *Identifier for a name or a parameter.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		for i, stmt := range node.Statements {
+			node.Statements[i] = Modify(stmt, modifier).(Statement)
+		}
+	case *LetStatement:
+		node.Name = Modify(node.Name, modifier).(*Identifier)
+		node.Value = modifyExpression(node.Value, modifier)
+	case *ReturnStatement:
+		node.ReturnValue = modifyExpression(node.ReturnValue, modifier)
+	case *YieldStatement:
+		node.Value = modifyExpression(node.Value, modifier)
+	case *ExpressionStatement:
+		node.Expr = modifyExpression(node.Expr, modifier)
+	case *BlockStatement:
+		for i, stmt := range node.Statements {
+			node.Statements[i] = Modify(stmt, modifier).(Statement)
+		}
+	case *InfixDeclaration:
+		for i, param := range node.Params {
+			node.Params[i] = Modify(param, modifier).(*Identifier)
+		}
+		node.Body = modifyExpression(node.Body, modifier)
+	case *PrefixExpression:
+		node.Right = modifyExpression(node.Right, modifier)
+	case *InfixExpression:
+		node.Lhs = modifyExpression(node.Lhs, modifier)
+		node.Rhs = modifyExpression(node.Rhs, modifier)
+	case *CallExpression:
+		node.Fn = modifyExpression(node.Fn, modifier)
+		for i, argument := range node.Arguments {
+			node.Arguments[i] = modifyExpression(argument, modifier)
+		}
+	case *IfExpression:
+		node.Condition = modifyExpression(node.Condition, modifier)
+		node.Consequence = Modify(node.Consequence, modifier).(*BlockStatement)
+		if node.Alternative != nil {
+			node.Alternative = Modify(node.Alternative, modifier).(*BlockStatement)
+		}
+	case *FnLiteral:
+		for i, param := range node.Parameters {
+			node.Parameters[i] = Modify(param, modifier).(*Identifier)
+		}
+		node.Body = Modify(node.Body, modifier).(*BlockStatement)
+	case *ArrayLiteral:
+		for i, element := range node.Elements {
+			node.Elements[i] = modifyExpression(element, modifier)
+		}
+	case *SetLiteral:
+		for i, element := range node.Elements {
+			node.Elements[i] = modifyExpression(element, modifier)
+		}
+	case *IndexExpression:
+		node.Lhs = modifyExpression(node.Lhs, modifier)
+		node.Index = modifyExpression(node.Index, modifier)
+	case *HashExpression:
+		for _, pair := range node.Pairs {
+			if pair.Spread != nil {
+				pair.Spread = Modify(pair.Spread, modifier).(*SpreadExpression)
+				continue
+			}
+			pair.Key = modifyExpression(pair.Key, modifier)
+			pair.Value = modifyExpression(pair.Value, modifier)
+		}
+	case *SpreadExpression:
+		node.Value = modifyExpression(node.Value, modifier)
+	case *ComprehensionClause:
+		for i, target := range node.Targets {
+			node.Targets[i] = Modify(target, modifier).(*Identifier)
+		}
+		node.Iterable = modifyExpression(node.Iterable, modifier)
+		node.Condition = modifyExpression(node.Condition, modifier)
+	case *ArrayComprehension:
+		node.Element = modifyExpression(node.Element, modifier)
+		node.Clause = Modify(node.Clause, modifier).(*ComprehensionClause)
+	case *HashComprehension:
+		node.Key = modifyExpression(node.Key, modifier)
+		node.Value = modifyExpression(node.Value, modifier)
+		node.Clause = Modify(node.Clause, modifier).(*ComprehensionClause)
+	}
+
+	return modifier(node)
+}
+
+// modifyExpression modify the expression unless it's nil
+func modifyExpression(expr Expression, modifier ModifierFunc) Expression {
+	if expr == nil {
+		return nil
+	}
+	return Modify(expr, modifier).(Expression)
+}
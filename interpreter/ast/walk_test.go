@@ -0,0 +1,216 @@
+package ast
+
+import (
+	"0x822a5b87/monkey/interpreter/token"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	block := func(expr Expression) *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expr: expr}}}
+	}
+
+	// let f = fn(x) { if (!x) { x[1] } else { g(...x) } }
+	// return [e for [k, e] in {1: 1, ...h} if k + 1]
+	// infix 45 <+> (a, b) => {k: v for v in [null]}
+	program := &Program{Statements: []Statement{
+		&LetStatement{Name: ident("f"), Value: &FnLiteral{
+			Parameters: []*Identifier{ident("x")},
+			Body: block(&IfExpression{
+				Condition:   &PrefixExpression{Operator: "!", Right: ident("x")},
+				Consequence: block(&IndexExpression{Lhs: ident("x"), Index: one()}),
+				Alternative: block(&CallExpression{
+					Fn:        ident("g"),
+					Arguments: []Expression{&SpreadExpression{Value: ident("x")}},
+				}),
+			}),
+		}},
+		&ReturnStatement{ReturnValue: &ArrayComprehension{
+			Element: ident("e"),
+			Clause: &ComprehensionClause{
+				Targets:     []*Identifier{ident("k"), ident("e")},
+				Destructure: true,
+				Iterable: &HashExpression{Pairs: []*HashPair{
+					{Key: one(), Value: one()},
+					{Spread: &SpreadExpression{Value: ident("h")}},
+				}},
+				Condition: &InfixExpression{Operator: "+", Lhs: ident("k"), Rhs: one()},
+			},
+		}},
+		&InfixDeclaration{
+			Operator: "<+>",
+			Params:   []*Identifier{ident("a"), ident("b")},
+			Body: &HashComprehension{
+				Key:    ident("k"),
+				Value:  ident("v"),
+				Clause: &ComprehensionClause{Targets: []*Identifier{ident("v")}, Iterable: &ArrayLiteral{Elements: []Expression{&NullLiteral{}}}},
+			},
+		},
+	}}
+
+	expected := []string{
+		"*ast.Program",
+		"*ast.LetStatement", "f", "*ast.FnLiteral", "x", "*ast.BlockStatement", "*ast.ExpressionStatement",
+		"*ast.IfExpression", "*ast.PrefixExpression", "x",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.IndexExpression", "x", "1",
+		"*ast.BlockStatement", "*ast.ExpressionStatement", "*ast.CallExpression", "g", "*ast.SpreadExpression", "x",
+		"*ast.ReturnStatement", "*ast.ArrayComprehension", "e", "*ast.ComprehensionClause", "k", "e",
+		"*ast.HashExpression", "1", "1", "*ast.SpreadExpression", "h", "*ast.InfixExpression", "k", "1",
+		"*ast.InfixDeclaration", "a", "b", "*ast.HashComprehension", "k", "v", "*ast.ComprehensionClause", "v",
+		"*ast.ArrayLiteral", "*ast.NullLiteral",
+	}
+
+	actual := make([]string, 0)
+	depth, maxDepth := 0, 0
+	Inspect(program, func(node Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+		depth++
+		maxDepth = max(depth, maxDepth)
+		switch node := node.(type) {
+		case *Identifier:
+			actual = append(actual, node.Value)
+		case *IntegerLiteral:
+			actual = append(actual, node.String())
+		default:
+			actual = append(actual, fmt.Sprintf("%T", node))
+		}
+		return true
+	})
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected = %v\nactual = %v", expected, actual)
+	}
+	if depth != 0 || maxDepth != 11 {
+		t.Fatalf("every visited node must be followed by a nil, depth = [%d], max depth = [%d]", depth, maxDepth)
+	}
+
+	// the children are skipped when the visitor returns nil
+	statements := 0
+	Inspect(program, func(node Node) bool {
+		if _, ok := node.(Statement); ok {
+			statements++
+		}
+		_, ok := node.(*Program)
+		return ok
+	})
+	if statements != 3 {
+		t.Fatalf("expected only the [3] top level statements to be visited, got [%d]", statements)
+	}
+}
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	block := func(expr Expression) *BlockStatement {
+		return &BlockStatement{Statements: []Statement{&ExpressionStatement{Expr: expr}}}
+	}
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		return two()
+	}
+
+	testCases := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expr: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expr: two()}}},
+		},
+		{
+			&InfixExpression{Lhs: one(), Operator: "+", Rhs: two()},
+			&InfixExpression{Lhs: two(), Operator: "+", Rhs: two()},
+		},
+		{
+			&InfixExpression{Lhs: two(), Operator: "+", Rhs: one()},
+			&InfixExpression{Lhs: two(), Operator: "+", Rhs: two()},
+		},
+		{&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+		{&IndexExpression{Lhs: one(), Index: one()}, &IndexExpression{Lhs: two(), Index: two()}},
+		{
+			&IfExpression{Condition: one(), Consequence: block(one()), Alternative: block(one())},
+			&IfExpression{Condition: two(), Consequence: block(two()), Alternative: block(two())},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Name: ident("a"), Value: one()}, &LetStatement{Name: ident("a"), Value: two()}},
+		{
+			&FnLiteral{Parameters: []*Identifier{}, Body: block(one())},
+			&FnLiteral{Parameters: []*Identifier{}, Body: block(two())},
+		},
+		{
+			&CallExpression{Fn: one(), Arguments: []Expression{one(), &SpreadExpression{Value: one()}}},
+			&CallExpression{Fn: two(), Arguments: []Expression{two(), &SpreadExpression{Value: two()}}},
+		},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+		{
+			&HashExpression{Pairs: []*HashPair{{Key: one(), Value: one()}, {Spread: &SpreadExpression{Value: one()}}}},
+			&HashExpression{Pairs: []*HashPair{{Key: two(), Value: two()}, {Spread: &SpreadExpression{Value: two()}}}},
+		},
+		{
+			&ArrayComprehension{Element: one(), Clause: &ComprehensionClause{
+				Targets: []*Identifier{ident("x")}, Iterable: one(), Condition: one()}},
+			&ArrayComprehension{Element: two(), Clause: &ComprehensionClause{
+				Targets: []*Identifier{ident("x")}, Iterable: two(), Condition: two()}},
+		},
+		{
+			&HashComprehension{Key: one(), Value: one(), Clause: &ComprehensionClause{
+				Targets: []*Identifier{ident("x")}, Iterable: one()}},
+			&HashComprehension{Key: two(), Value: two(), Clause: &ComprehensionClause{
+				Targets: []*Identifier{ident("x")}, Iterable: two()}},
+		},
+		{
+			&InfixDeclaration{Operator: "<+>", Params: []*Identifier{ident("a"), ident("b")}, Body: one()},
+			&InfixDeclaration{Operator: "<+>", Params: []*Identifier{ident("a"), ident("b")}, Body: two()},
+		},
+	}
+
+	for i, testCase := range testCases {
+		modified := Modify(testCase.input, turnOneIntoTwo)
+		if !reflect.DeepEqual(modified, testCase.expected) {
+			t.Errorf("test case [%d] not equal, expected = [%#v], actual = [%#v]", i, testCase.expected, modified)
+		}
+	}
+}
+
+func TestModifyReplacesNodes(t *testing.T) {
+	// rename every identifier x to y, and fold 1 + 2 into 3
+	program := &Program{Statements: []Statement{
+		&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: &Identifier{Value: "x"}, Value: &InfixExpression{
+			Operator: "+", Lhs: &IntegerLiteral{Value: 1}, Rhs: &IntegerLiteral{Value: 2}}},
+		&ExpressionStatement{Expr: &CallExpression{Fn: &Identifier{Value: "x"}, Arguments: []Expression{}}},
+	}}
+
+	Modify(program, func(node Node) Node {
+		switch node := node.(type) {
+		case *Identifier:
+			if node.Value == "x" {
+				return &Identifier{Value: "y"}
+			}
+		case *InfixExpression:
+			lhs, lok := node.Lhs.(*IntegerLiteral)
+			rhs, rok := node.Rhs.(*IntegerLiteral)
+			if lok && rok && node.Operator == "+" {
+				return &IntegerLiteral{Value: lhs.Value + rhs.Value}
+			}
+		}
+		return node
+	})
+
+	expected := "let y = 3;y()"
+	if program.String() != expected {
+		t.Fatalf("expected [%s], got [%s]", expected, program.String())
+	}
+}
@@ -0,0 +1,87 @@
+// Package astdot renders an AST as a Graphviz DOT graph, `monkey ast -dot file | dot -Tsvg > ast.svg` draws the tree.
+//
+// Every node is a box labelled by its type and its scalar fields, like the operator of an infix expression
+// or the value of a literal, and every edge is labelled by the field holding the child.
+package astdot
+
+import (
+	"0x822a5b87/monkey/interpreter/ast"
+	"0x822a5b87/monkey/interpreter/token"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var tokenType = reflect.TypeOf(token.Token{})
+
+// Render the node and all its descendants as a DOT digraph
+func Render(node ast.Node) string {
+	r := &renderer{}
+	r.buffer.WriteString("digraph ast {\n")
+	r.buffer.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	r.node(reflect.ValueOf(node))
+	r.buffer.WriteString("}\n")
+	return r.buffer.String()
+}
+
+type renderer struct {
+	buffer strings.Builder
+	// count the number of nodes rendered so far, the ids of the nodes are n0, n1, ...
+	count int
+}
+
+// node render the node before its children, and return its id
+func (r *renderer) node(v reflect.Value) string {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	id := fmt.Sprintf("n%d", r.count)
+	r.count++
+
+	label := []string{v.Type().Name()}
+	if comment, ok := v.Addr().Interface().(*ast.Comment); ok {
+		label = append(label, comment.Token.Literal)
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		switch value.Kind() {
+		case reflect.Slice, reflect.Interface, reflect.Pointer, reflect.Struct:
+		default:
+			if !field.IsExported() {
+				continue
+			}
+			label = append(label, fmt.Sprintf("%s: %v", field.Name, value.Interface()))
+		}
+	}
+	r.buffer.WriteString(fmt.Sprintf("  %s [label=%s];\n", id, quote(strings.Join(label, "\n"))))
+
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		switch {
+		case !field.IsExported() || field.Type == tokenType:
+			continue
+		case value.Kind() == reflect.Slice:
+			for j := 0; j < value.Len(); j++ {
+				r.edge(id, fmt.Sprintf("%s[%d]", field.Name, j), value.Index(j))
+			}
+		case value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer:
+			if !value.IsNil() {
+				r.edge(id, field.Name, value)
+			}
+		}
+	}
+	return id
+}
+
+// edge render the child and the edge from the parent to it
+func (r *renderer) edge(parent, name string, child reflect.Value) {
+	id := r.node(child)
+	r.buffer.WriteString(fmt.Sprintf("  %s -> %s [label=%s];\n", parent, id, quote(name)))
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,47 @@
+package astdot
+
+import (
+	"0x822a5b87/monkey/interpreter/parser"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	program, err := parser.Parse(`let a = -b + "c\"d" // comment
+f(a, null)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `digraph ast {
+  node [shape=box, fontname="monospace"];
+  n0 [label="Program"];
+  n1 [label="LetStatement"];
+  n2 [label="Identifier\nValue: a"];
+  n1 -> n2 [label="Name"];
+  n3 [label="InfixExpression\nOperator: +"];
+  n4 [label="PrefixExpression\nOperator: -"];
+  n5 [label="Identifier\nValue: b"];
+  n4 -> n5 [label="Right"];
+  n3 -> n4 [label="Lhs"];
+  n6 [label="StringLiteral\nLiteral: c\"d"];
+  n3 -> n6 [label="Rhs"];
+  n1 -> n3 [label="Value"];
+  n0 -> n1 [label="Statements[0]"];
+  n7 [label="ExpressionStatement"];
+  n8 [label="CallExpression"];
+  n9 [label="Identifier\nValue: f"];
+  n8 -> n9 [label="Fn"];
+  n10 [label="Identifier\nValue: a"];
+  n8 -> n10 [label="Arguments[0]"];
+  n11 [label="NullLiteral"];
+  n8 -> n11 [label="Arguments[1]"];
+  n7 -> n8 [label="Expr"];
+  n0 -> n7 [label="Statements[1]"];
+  n12 [label="Comment\n// comment"];
+  n0 -> n12 [label="Comments[0]"];
+}
+`
+	if actual := Render(program); actual != expected {
+		t.Fatalf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+}
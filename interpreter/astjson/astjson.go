@@ -0,0 +1,236 @@
+// Package astjson encodes an AST as JSON and decodes it back into identical nodes.
+//
+// Every node is encoded as an object whose "kind" is the name of its type, followed by its fields in the order
+// they are declared, so the output is stable and can be used as golden files. The tokens are kept in full,
+// including their line and column, which are the spans of the nodes:
+//
+//	{"kind": "Identifier", "token": {"type": "IDENTIFIER", "literal": "x", "line": 1, "column": 5, ...}, "value": "x"}
+//
+// A nil node or a nil list is encoded as null, and an empty list as [], since the parser produces both.
+package astjson
+
+import (
+	"0x822a5b87/monkey/interpreter/ast"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+// kinds the types of the nodes keyed by their kind
+var kinds = make(map[string]reflect.Type)
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func init() {
+	nodes := []any{
+		&ast.Program{}, &ast.Comment{},
+		&ast.LetStatement{}, &ast.ReturnStatement{}, &ast.YieldStatement{}, &ast.ExpressionStatement{}, &ast.BlockStatement{},
+		&ast.InfixDeclaration{},
+		&ast.Identifier{}, &ast.IntegerLiteral{}, &ast.BigIntegerLiteral{}, &ast.FloatLiteral{}, &ast.BooleanExpression{}, &ast.NullLiteral{},
+		&ast.StringLiteral{}, &ast.PrefixExpression{}, &ast.InfixExpression{}, &ast.CallExpression{},
+		&ast.IfExpression{}, &ast.FnLiteral{}, &ast.ArrayLiteral{}, &ast.SetLiteral{}, &ast.IndexExpression{},
+		&ast.HashExpression{}, &ast.HashPair{}, &ast.SpreadExpression{}, &ast.ComprehensionClause{},
+		&ast.ArrayComprehension{}, &ast.HashComprehension{},
+	}
+	for _, node := range nodes {
+		t := reflect.TypeOf(node).Elem()
+		kinds[t.Name()] = t
+	}
+}
+
+// Marshal encode the node and all its descendants as indented JSON
+func Marshal(node ast.Node) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	if err := encode(&buffer, reflect.ValueOf(node)); err != nil {
+		return nil, err
+	}
+
+	indented := bytes.Buffer{}
+	if err := json.Indent(&indented, buffer.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	indented.WriteByte('\n')
+	return indented.Bytes(), nil
+}
+
+// Unmarshal decode the JSON encoded by Marshal, the node is resolved like the parser resolves the programs it parses
+func Unmarshal(data []byte) (ast.Node, error) {
+	var node ast.Node
+	if err := decode(data, reflect.ValueOf(&node).Elem()); err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, fmt.Errorf("astjson: null is not a node")
+	}
+	ast.Resolve(node)
+	return node, nil
+}
+
+func encode(buffer *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			buffer.WriteString("null")
+			return nil
+		}
+		return encode(buffer, v.Elem())
+	case reflect.Pointer:
+		if v.IsNil() {
+			buffer.WriteString("null")
+			return nil
+		}
+		// a value which isn't a node, like the *big.Int of a BigIntegerLiteral, is encoded by itself
+		if marshaler, ok := v.Interface().(json.Marshaler); ok {
+			return writeValue(buffer, marshaler)
+		}
+		kind := v.Elem().Type().Name()
+		if kinds[kind] != v.Elem().Type() {
+			return fmt.Errorf("astjson: unknown node type [%s]", v.Type())
+		}
+		buffer.WriteString(`{"kind":`)
+		writeValue(buffer, kind)
+		return encodeFields(buffer, v.Elem(), false)
+	case reflect.Struct:
+		buffer.WriteString("{")
+		return encodeFields(buffer, v, true)
+	case reflect.Slice:
+		if v.IsNil() {
+			buffer.WriteString("null")
+			return nil
+		}
+		buffer.WriteString("[")
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buffer.WriteString(",")
+			}
+			if err := encode(buffer, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buffer.WriteString("]")
+		return nil
+	default:
+		return writeValue(buffer, v.Interface())
+	}
+}
+
+// encodeFields encode the fields of the struct and close the object
+func encodeFields(buffer *bytes.Buffer, v reflect.Value, first bool) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if !first {
+			buffer.WriteString(",")
+		}
+		first = false
+		writeValue(buffer, fieldName(field))
+		buffer.WriteString(":")
+		if err := encode(buffer, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	buffer.WriteString("}")
+	return nil
+}
+
+func writeValue(buffer *bytes.Buffer, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	buffer.Write(data)
+	return nil
+}
+
+// decode the data into v, which must be settable
+func decode(data []byte, v reflect.Value) error {
+	isNull := bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if isNull {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		if v.Type().Implements(unmarshalerType) {
+			value := reflect.New(v.Type().Elem())
+			if err := json.Unmarshal(data, value.Interface()); err != nil {
+				return err
+			}
+			v.Set(value)
+			return nil
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		var kind string
+		if err := json.Unmarshal(fields["kind"], &kind); err != nil {
+			return fmt.Errorf("astjson: node without kind: %s", data)
+		}
+		t, ok := kinds[kind]
+		if !ok {
+			return fmt.Errorf("astjson: unknown node kind [%s]", kind)
+		}
+		node := reflect.New(t)
+		if !node.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("astjson: node kind [%s] can't be used as [%s]", kind, v.Type())
+		}
+		if err := decodeFields(fields, node.Elem()); err != nil {
+			return err
+		}
+		v.Set(node)
+		return nil
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		return decodeFields(fields, v)
+	case reflect.Slice:
+		if isNull {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		var elements []json.RawMessage
+		if err := json.Unmarshal(data, &elements); err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(v.Type(), len(elements), len(elements))
+		for i, element := range elements {
+			if err := decode(element, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+}
+
+// decodeFields the missing fields are left as zero values
+func decodeFields(fields map[string]json.RawMessage, v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		data, ok := fields[fieldName(field)]
+		if !field.IsExported() || !ok {
+			continue
+		}
+		if err := decode(data, v.Field(i)); err != nil {
+			return fmt.Errorf("%s.%s: %w", v.Type().Name(), field.Name, err)
+		}
+	}
+	return nil
+}
+
+// fieldName the name of the field in lower camel case, ReturnValue is encoded as returnValue
+func fieldName(field reflect.StructField) string {
+	r, size := utf8.DecodeRuneInString(field.Name)
+	return string(unicode.ToLower(r)) + field.Name[size:]
+}
@@ -0,0 +1,110 @@
+package astjson
+
+import (
+	"0x822a5b87/monkey/interpreter/ast"
+	"0x822a5b87/monkey/interpreter/parser"
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// TestGolden snapshot the parser: every testdata/*.monkey is parsed and compared with the JSON in the golden file
+// of the same name, run `go test ./astjson -update` to update the golden files after changing the parser
+func TestGolden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "*.monkey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no test data")
+	}
+
+	for _, source := range sources {
+		sourceCode, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		program, err := parser.Parse(string(sourceCode))
+		if err != nil {
+			t.Fatalf("[%s] parse error: %s", source, err)
+		}
+		actual, err := Marshal(program)
+		if err != nil {
+			t.Fatalf("[%s] marshal error: %s", source, err)
+		}
+
+		golden := strings.TrimSuffix(source, ".monkey") + ".json"
+		if *update {
+			if err = os.WriteFile(golden, actual, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("[%s] doesn't match the golden file [%s]:\n%s", source, golden, actual)
+		}
+
+		testRoundTrip(t, source, program)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		`let a = 1; let b = a + 2 * 3;`,
+		`fn() {}; fn(x) { return x; }(1)`,
+		`if (a) { b } else { c }; if (a) { b }`,
+		`[]; {}; [1, [2, [3]]]; {"a": {"b": null}}`,
+		`x?.y?[0] ?? -1; !true`,
+		`92233720368547758070 * -1`,
+		`#{1, ...xs}; 1 in #{}`,
+	}
+	for _, input := range inputs {
+		program, err := parser.Parse(input)
+		if err != nil {
+			t.Fatalf("[%s] parse error: %s", input, err)
+		}
+		testRoundTrip(t, input, program)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	inputs := []string{
+		`null`,
+		`{"statements": []}`,
+		`{"kind": "Unknown"}`,
+		`{"kind": "HashPair"}`,
+		`{"kind": "Program", "statements": [{"kind": "Identifier"}]}`,
+		`{"kind": "IntegerLiteral", "value": "five"}`,
+	}
+	for _, input := range inputs {
+		if node, err := Unmarshal([]byte(input)); err == nil {
+			t.Errorf("[%s] expected an error, got [%+v]", input, node)
+		}
+	}
+}
+
+func testRoundTrip(t *testing.T, name string, program *ast.Program) {
+	t.Helper()
+
+	data, err := Marshal(program)
+	if err != nil {
+		t.Fatalf("[%s] marshal error: %s", name, err)
+	}
+	node, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("[%s] unmarshal error: %s", name, err)
+	}
+	if !reflect.DeepEqual(program, node) {
+		t.Fatalf("[%s] the unmarshalled program is not identical, expected = [%s], actual = [%s]",
+			name, program.String(), node.String())
+	}
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"0x822a5b87/monkey/interpreter/object"
+	"context"
+	"fmt"
+)
+
+// pollInterval the number of steps between two checks of the context, checking it on every step is too expensive
+const pollInterval = 1024
+
+// Limits the budget of an execution of untrusted code, a zero limit means unlimited
+type Limits struct {
+	// MaxSteps the max number of steps, a step is an evaluated node for the evaluator, and an executed instruction
+	// for the vm
+	MaxSteps int
+	// MaxCallDepth the max depth of the call stack, zero means the default depth of the engine,
+	// which is the deepest depth the engine supports
+	MaxCallDepth int
+	// MaxAllocations the max number of elements allocated, which are the elements of the arrays, the pairs of the
+	// hashes and the bytes of the strings created by the execution, an element copied to a new array counts again
+	MaxAllocations int
+}
+
+// Budget tracks the resources consumed by an execution against its Limits.
+// Once a limit is exceeded or the context is done, the budget keeps failing with the same error,
+// so the error can't be swallowed by the program.
+type Budget struct {
+	ctx         context.Context
+	limits      Limits
+	steps       int
+	allocations int
+	err         error
+}
+
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	return &Budget{ctx: ctx, limits: limits}
+}
+
+// Step consume a step, and check the context every pollInterval steps
+func (b *Budget) Step() error {
+	if b.err != nil {
+		return b.err
+	}
+	b.steps++
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		b.err = fmt.Errorf("%w: max steps [%d]", ErrStepLimitExceeded, b.limits.MaxSteps)
+		return b.err
+	}
+	if b.steps%pollInterval == 0 {
+		return b.Check()
+	}
+	return nil
+}
+
+// Check fails if the context is done
+func (b *Budget) Check() error {
+	if b.err == nil && b.ctx.Err() != nil {
+		b.err = fmt.Errorf("%w: %w", ErrCancelled, b.ctx.Err())
+	}
+	return b.err
+}
+
+// Allocate consume n allocated elements
+func (b *Budget) Allocate(n int) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.allocations += n
+	if b.limits.MaxAllocations > 0 && b.allocations > b.limits.MaxAllocations {
+		b.err = fmt.Errorf("%w: max allocations [%d]", ErrAllocationLimitExceeded, b.limits.MaxAllocations)
+	}
+	return b.err
+}
+
+// MaxCallDepth the max call depth of the limits, or defaultDepth if it's not set or deeper than defaultDepth
+func (b *Budget) MaxCallDepth(defaultDepth int) int {
+	if b.limits.MaxCallDepth <= 0 || b.limits.MaxCallDepth > defaultDepth {
+		return defaultDepth
+	}
+	return b.limits.MaxCallDepth
+}
+
+// SizeOf the number of elements allocated for the object, see Limits.MaxAllocations
+func SizeOf(obj object.Object) int {
+	switch obj := obj.(type) {
+	case *object.Array:
+		return obj.Size()
+	case *object.Hash:
+		return obj.Len()
+	case *object.Set:
+		return int(obj.Len().Value)
+	case *object.StringObj:
+		return len(obj.Value)
+	case *object.BigInteger:
+		return (obj.Value.BitLen() + 7) / 8
+	default:
+		return 0
+	}
+}
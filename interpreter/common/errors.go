@@ -9,6 +9,16 @@ var (
 	ErrUnknownToken            = ErrorInfo{100000, "unknown token"} // encounter unknown token
 	ErrSyntax                  = ErrorInfo{100001, "syntax error"}
 	ErrUnknownTypeOfExpression = ErrorInfo{100002, "unknown type of expression"}
+
+	// the errors of an execution aborted by its Limits or its context, they're wrapped with the details,
+	// use errors.Is to tell them apart
+	ErrStepLimitExceeded       = ErrorInfo{100017, "step limit exceeded"}
+	ErrCallDepthExceeded       = ErrorInfo{100018, "stack overflow"}
+	ErrAllocationLimitExceeded = ErrorInfo{100019, "allocation limit exceeded"}
+	ErrCancelled               = ErrorInfo{100020, "execution cancelled"}
+
+	// ErrGeneratorRunning a generator asks for the next element of its own iterator, which would wait for itself
+	ErrGeneratorRunning = ErrorInfo{100023, "generator already executing"}
 )
 
 type ErrorCode int // ErrorCode 错误码
@@ -65,3 +75,31 @@ func NewOperandWidthError(operandsCount int) error {
 func NewUnknownScope(scope string) error {
 	return errUnknownScope.format(scope)
 }
+
+func NewErrCannotSpread(name object.ObjType) error {
+	return errCannotSpread.format(name)
+}
+
+func NewErrNotIterable(name object.ObjType) error {
+	return errNotIterable.format(name)
+}
+
+func NewErrCannotDestructure(name object.ObjType) error {
+	return errCannotDestructure.format(name)
+}
+
+func NewErrCallDepthExceeded(maxDepth int) error {
+	return fmt.Errorf("%w: max call depth [%d] exceeded", ErrCallDepthExceeded, maxDepth)
+}
+
+func NewErrUnhashable(name object.ObjType) error {
+	return errUnhashable.format(name)
+}
+
+func NewErrNotFunction(name object.ObjType) error {
+	return errNotFunction.format(name)
+}
+
+func NewErrWrongNumberOfArguments(expectedCount, actualCount int) error {
+	return errWrongNumberOfArguments.format(expectedCount, actualCount)
+}
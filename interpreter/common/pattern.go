@@ -13,6 +13,12 @@ var (
 	errOpCodeUndefined           = errorPattern{100010, "opcode [%d] undefined"}
 	errOperandWidth              = errorPattern{100011, "operands width error [%d]"}
 	errUnknownScope              = errorPattern{100012, "unknown scope [%s]"}
+	errCannotSpread              = errorPattern{100013, "cannot spread: %s"}
+	errNotIterable               = errorPattern{100014, "not iterable: %s"}
+	errCannotDestructure         = errorPattern{100015, "cannot destructure: %s"}
+	errUnhashable                = errorPattern{100016, "unusable as hash key: %s"}
+	errNotFunction               = errorPattern{100021, "not a function: %s"}
+	errWrongNumberOfArguments    = errorPattern{100022, "number of parameters mismatch: expected [%d], got [%d]"}
 )
 
 type errorPattern struct {
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"0x822a5b87/monkey/interpreter/astdot"
+	"0x822a5b87/monkey/interpreter/astjson"
+	"0x822a5b87/monkey/interpreter/parser"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// astCommand prints the AST of the file, or of the standard input if no file is given, as JSON or as a DOT graph
+func astCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dot := flags.Bool("dot", false, "print the AST as a Graphviz DOT graph instead of JSON")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "usage: monkey ast [-dot] [file]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil || flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	name := stdinName
+	var source []byte
+	var err error
+	if flags.NArg() == 0 {
+		source, err = io.ReadAll(stdin)
+	} else {
+		name = flags.Arg(0)
+		source, err = os.ReadFile(name)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		return 2
+	}
+
+	program, err := parser.Parse(string(source))
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		return 2
+	}
+
+	if *dot {
+		_, err = io.WriteString(stdout, astdot.Render(program))
+	} else {
+		var data []byte
+		if data, err = astjson.Marshal(program); err == nil {
+			_, err = stdout.Write(data)
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		return 2
+	}
+	return 0
+}
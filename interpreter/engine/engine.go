@@ -0,0 +1,161 @@
+// Package engine runs programs in isolated instances of the language.
+//
+// A Runtime owns all the state of the programs it runs: the global environment of the evaluator, or the symbols,
+// the constants and the globals of the compiler and the vm, so the runtimes in one process never share any state.
+// A Runtime must be used by one goroutine at a time, but any number of runtimes can run in parallel.
+package engine
+
+import (
+	"0x822a5b87/monkey/compiler/compiler"
+	"0x822a5b87/monkey/compiler/vm"
+	"0x822a5b87/monkey/interpreter/ast"
+	"0x822a5b87/monkey/interpreter/common"
+	"0x822a5b87/monkey/interpreter/evaluator"
+	"0x822a5b87/monkey/interpreter/object"
+	"0x822a5b87/monkey/interpreter/parser"
+	"context"
+	"fmt"
+)
+
+// Kind the engine which runs the programs
+type Kind string
+
+const (
+	Interpreter Kind = "i" // Interpreter the tree-walking evaluator
+	Compiler    Kind = "c" // Compiler the bytecode compiler and the vm
+)
+
+type Runtime struct {
+	kind Kind
+	// Limits the limits of every run, see common.Limits
+	Limits common.Limits
+
+	// operators the user-defined operators declared by the sources parsed so far, see Parse
+	operators *parser.Operators
+
+	evaluator *evaluator.Evaluator
+	env       *object.Environment
+
+	compiler *compiler.Compiler
+	vm       *vm.Vm
+}
+
+func New(kind Kind) *Runtime {
+	return &Runtime{
+		kind:      kind,
+		operators: parser.NewOperators(),
+		evaluator: evaluator.New(),
+		env:       object.NewEnvironment(nil),
+	}
+}
+
+// Parse parse the source code of a run, the operators declared by the sources parsed before are known to it,
+// like the bindings of the previous runs
+func (r *Runtime) Parse(src string) (*ast.Program, error) {
+	return parser.ParseWithOperators(src, r.operators)
+}
+
+// Run run the node in the runtime, the bindings it defines are kept for the following runs.
+// An error of the evaluator is returned as an *object.Error, which carries the call stack.
+func (r *Runtime) Run(ctx context.Context, node ast.Node) (object.Object, error) {
+	switch r.kind {
+	case Interpreter:
+		obj := r.evaluator.EvalWithContext(ctx, node, r.env, r.Limits)
+		if err, ok := obj.(*object.Error); ok {
+			return nil, err
+		}
+		return obj, nil
+	case Compiler:
+		return r.runVm(ctx, node)
+	default:
+		return nil, fmt.Errorf("unknown engine [%s]", r.kind)
+	}
+}
+
+// Call call the function bound to the name with the arguments, the bindings of the previous runs are visible to it
+func (r *Runtime) Call(ctx context.Context, name string, args ...object.Object) (object.Object, error) {
+	fn, ok := r.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("undefined function [%s]", name)
+	}
+
+	var obj object.Object
+	switch r.kind {
+	case Interpreter:
+		obj = r.evaluator.CallWithContext(ctx, name, fn, args, r.Limits)
+	case Compiler:
+		var err error
+		// the call runs in a vm of its own, which shares the constants and the globals of the runtime
+		v := vm.NewVmWithState(&compiler.ByteCode{Constants: r.compiler.ByteCode().Constants}, r.vm)
+		if obj, err = v.CallWithContext(ctx, r.Limits, fn, args...); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown engine [%s]", r.kind)
+	}
+
+	if err, ok := obj.(*object.Error); ok {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Set bind the value to the name in the global scope, like a let statement does
+func (r *Runtime) Set(name string, obj object.Object) {
+	if r.kind == Compiler {
+		r.initVm()
+		r.vm.SetGlobal(r.compiler.DefineGlobal(name), obj)
+		return
+	}
+	r.env.Set(name, obj)
+}
+
+// Get the value bound to the name in the global scope, including the built-in functions
+func (r *Runtime) Get(name string) (object.Object, bool) {
+	if r.kind != Compiler {
+		return r.env.Get(name)
+	}
+
+	r.initVm()
+	symbol, ok := r.compiler.ResolveGlobal(name)
+	if !ok {
+		return nil, false
+	}
+	switch symbol.Scope {
+	case compiler.GlobalScope:
+		obj := r.vm.Global(symbol.Index)
+		return obj, obj != nil
+	case compiler.BuiltInScope:
+		return object.BuiltIns[symbol.Index], true
+	default:
+		return nil, false
+	}
+}
+
+// RegisterFunc bind the Go function to the name in the global scope, it's called like a built-in function
+func (r *Runtime) RegisterFunc(name string, fn object.BuiltInFunction) {
+	r.Set(name, &object.BuiltIn{Name: name, BuiltInFn: fn})
+}
+
+// initVm create the compiler and the vm before the first run, so that the globals can be set before it
+func (r *Runtime) initVm() {
+	if r.compiler == nil {
+		r.compiler = compiler.NewCompiler()
+		r.vm = vm.NewVm(r.compiler.ByteCode())
+	}
+}
+
+// runVm compile the node and run it in a vm, both of them start with the state of the previous run
+func (r *Runtime) runVm(ctx context.Context, node ast.Node) (object.Object, error) {
+	r.initVm()
+	r.compiler = compiler.NewCompilerWithState(r.compiler)
+	if err := r.compiler.Compile(node); err != nil {
+		return nil, err
+	}
+
+	r.vm = vm.NewVmWithState(r.compiler.ByteCode(), r.vm)
+	if err := r.vm.RunWithContext(ctx, r.Limits); err != nil {
+		return nil, err
+	}
+	return r.vm.LastPopped(), nil
+}
@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"0x822a5b87/monkey/interpreter/object"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func run(r *Runtime, input string) (object.Object, error) {
+	program, err := r.Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return r.Run(context.Background(), program)
+}
+
+func TestRuntimesAreIsolated(t *testing.T) {
+	for _, kind := range []Kind{Interpreter, Compiler} {
+		r1, r2 := New(kind), New(kind)
+		if _, err := run(r1, "let x = 1;"); err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", kind, err)
+		}
+		if _, err := run(r2, "let x = 2;"); err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", kind, err)
+		}
+
+		for i, tt := range []struct {
+			runtime  *Runtime
+			expected int64
+		}{{r1, 1}, {r2, 2}} {
+			obj, err := run(tt.runtime, "x")
+			if err != nil {
+				t.Fatalf("[%s] runtime [%d] unexpected error [%s]", kind, i, err)
+			}
+			if integer, ok := obj.(*object.Integer); !ok || integer.Value != tt.expected {
+				t.Fatalf("[%s] runtime [%d] expected [%d], got [%s]", kind, i, tt.expected, obj.Inspect())
+			}
+		}
+
+		if _, err := run(New(kind), "x"); err == nil {
+			t.Fatalf("[%s] expected x to be undefined in a new runtime", kind)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	_, err := run(New(Interpreter), "let f = fn() { y }; f()")
+	var evalErr *object.Error
+	if !errors.As(err, &evalErr) || len(evalErr.Stack) != 1 {
+		t.Fatalf("expected an evaluator error with its call stack, got [%v]", err)
+	}
+
+	if _, err = run(New(Compiler), "y"); err == nil {
+		t.Fatalf("expected a compile error")
+	}
+}
+
+func TestOperatorsOfPreviousRuns(t *testing.T) {
+	for _, kind := range []Kind{Interpreter, Compiler} {
+		r := New(kind)
+		if _, err := run(r, "infix 45 <+> (a, b) => a * 10 + b"); err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", kind, err)
+		}
+		obj, err := run(r, "1 <+> 2 <+> 3")
+		if err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", kind, err)
+		}
+		if integer, ok := obj.(*object.Integer); !ok || integer.Value != 123 {
+			t.Fatalf("[%s] expected [123], got [%s]", kind, obj.Inspect())
+		}
+
+		if _, err = run(New(kind), "1 <+> 2"); err == nil {
+			t.Fatalf("[%s] expected <+> to be undeclared in a new runtime", kind)
+		}
+	}
+}
+
+// TestRuntimesInParallel run it with -race to check that the runtimes don't share any state
+func TestRuntimesInParallel(t *testing.T) {
+	const program = `
+let map = fn(arr, f) { [f(x) for x in arr] };
+let h = {"a": 1, "b": 2};
+let a = map([1, 2, 3, 4], fn(x) { x * h["b"] });
+a[0] + a[1] + a[2] + last(a) + %d`
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		kind := []Kind{Interpreter, Compiler}[i%2]
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := New(kind)
+			for j := 0; j < 20; j++ {
+				obj, err := run(r, fmt.Sprintf(program, i))
+				if err != nil {
+					errs <- err
+					return
+				}
+				if integer, ok := obj.(*object.Integer); !ok || integer.Value != int64(20+i) {
+					errs <- fmt.Errorf("[%s] expected [%d], got [%s]", kind, 20+i, obj.Inspect())
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -5,46 +5,72 @@ import (
 	"0x822a5b87/monkey/interpreter/common"
 	"0x822a5b87/monkey/interpreter/object"
 	"0x822a5b87/monkey/interpreter/token"
+	"context"
 	"fmt"
 	"reflect"
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Eval evaluate the node in the environment, an error produced by a function call carries the call stack.
+// The evaluation is unlimited unless it's started by EvalWithContext.
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	if e.budget == nil {
+		return e.EvalWithContext(context.Background(), node, env, common.Limits{})
+	}
+	if err := e.budget.Step(); err != nil {
+		return e.budgetError(err)
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalStatements(node.Statements, env, false)
+		return e.evalStatements(node.Statements, env, false)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expr, env)
+		return e.Eval(node.Expr, env)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
 	case *ast.BlockStatement:
-		return evalStatements(node.Statements, env, true)
+		return e.evalStatements(node.Statements, env, true)
 	case *ast.ReturnStatement:
-		return evalReturnStatement(node, env)
+		return e.evalReturnStatement(node, env)
+	case *ast.YieldStatement:
+		return e.evalYieldStatement(node, env)
 	case *ast.BooleanExpression:
 		return evalBooleanLiteral(node)
 	case *ast.IntegerLiteral:
 		return evalIntegralLiteral(node)
+	case *ast.BigIntegerLiteral:
+		return object.NewBigInteger(node.Value)
+	case *ast.NullLiteral:
+		return object.NativeNull
 	case *ast.PrefixExpression:
-		return evalPrefixExpression(node, env)
+		return e.evalPrefixExpression(node, env)
 	case *ast.InfixExpression:
-		return evalInfixExpression(node, env)
+		return e.evalInfixExpression(node, env)
 	case *ast.LetStatement:
-		return evalLetStatement(node, env)
+		return e.evalLetStatement(node, env)
+	case *ast.InfixDeclaration:
+		return e.evalLetStatement(node.Lower(), env)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FnLiteral:
 		return evalFnLiteral(node, env)
 	case *ast.CallExpression:
-		return evalCallExpression(node, env)
+		return e.evalCallExpression(node, env, false)
 	case *ast.StringLiteral:
 		return evalStringLiteral(node)
 	case *ast.ArrayLiteral:
-		return evalArrayLiteral(node, env)
+		return e.evalArrayLiteral(node, env)
+	case *ast.SetLiteral:
+		return e.evalSetLiteral(node, env)
 	case *ast.IndexExpression:
-		return evalIndexExpression(node, env)
+		return e.evalIndexExpression(node, env)
 	case *ast.HashExpression:
-		return evalHash(node, env)
+		return e.evalHash(node, env)
+	case *ast.ArrayComprehension:
+		return e.evalArrayComprehension(node, env)
+	case *ast.HashComprehension:
+		return e.evalHashComprehension(node, env)
+	case *ast.SpreadExpression:
+		return newError("%s spread is only allowed in array literals, set literals, hash literals and calls", cannotSpreadErrStr)
 	default:
 		panic(fmt.Errorf("error node type for [%s]", reflect.TypeOf(node).String()))
 	}
@@ -58,9 +84,21 @@ func evalBooleanLiteral(booleanExpression *ast.BooleanExpression) object.Object
 	return nativeBoolean(booleanExpression.Value)
 }
 
-func evalInfixExpression(infix *ast.InfixExpression, env *object.Environment) object.Object {
-	lhsObj := Eval(infix.Lhs, env)
-	rhsObj := Eval(infix.Rhs, env)
+func (e *Evaluator) evalInfixExpression(infix *ast.InfixExpression, env *object.Environment) object.Object {
+	if infix.Operator == string(token.NullCoalescing) {
+		return e.evalNullCoalescing(infix, env)
+	}
+
+	if infix.IsUserDefined() {
+		return e.evalCallExpression(infix.LowerToCall(), env, false)
+	}
+
+	lhsObj := e.Eval(infix.Lhs, env)
+	rhsObj := e.Eval(infix.Rhs, env)
+
+	if method, ok := OperatorMethod(infix.Operator, lhsObj, rhsObj); ok {
+		return e.evalOperatorMethod(infix, method, lhsObj, rhsObj)
+	}
 
 	err := InfixExpressionTypeCheck(infix.Operator, lhsObj, rhsObj)
 	if err != nil {
@@ -69,11 +107,11 @@ func evalInfixExpression(infix *ast.InfixExpression, env *object.Environment) ob
 
 	switch infix.Operator {
 	case string(token.PLUS):
-		return evalAdd(lhsObj, rhsObj)
+		return e.allocate(evalAdd(lhsObj, rhsObj))
 	case string(token.SUB):
 		return evalSubtract(lhsObj, rhsObj)
 	case string(token.ASTERISK):
-		return evalMultiply(lhsObj, rhsObj)
+		return e.allocate(evalMultiply(lhsObj, rhsObj))
 	case string(token.SLASH):
 		return evalDivide(lhsObj, rhsObj)
 	case string(token.GT):
@@ -84,6 +122,8 @@ func evalInfixExpression(infix *ast.InfixExpression, env *object.Environment) ob
 		return evalEqual(lhsObj, rhsObj)
 	case string(token.NotEq):
 		return evalNotEqual(lhsObj, rhsObj)
+	case token.InOperator:
+		return rhsObj.(object.Container).Contains(lhsObj)
 	case string(token.LBRACKET):
 		return evalNotEqual(lhsObj, rhsObj)
 	}
@@ -91,32 +131,74 @@ func evalInfixExpression(infix *ast.InfixExpression, env *object.Environment) ob
 	return object.NativeNull
 }
 
+// evalOperatorMethod call the method overloading the operator of the infix expression with the operands,
+// the value of a comparison is converted to a Boolean by its truthiness, and the value of != is the negation
+// of the value of __eq__
+func (e *Evaluator) evalOperatorMethod(infix *ast.InfixExpression, method, lhs, rhs object.Object) object.Object {
+	frame := object.Frame{Function: operatorMethods[infix.Operator], Line: infix.Token.Line, Column: infix.Token.Column}
+	args := []object.Object{lhs, rhs}
+
+	var result object.Object
+	switch fn := method.(type) {
+	case *object.Fn:
+		result = e.evalFn(fn, args, frame)
+	case *object.BuiltIn:
+		result = e.callBuiltIn(fn, args, frame)
+	default:
+		return newError("%s %s", notFunctionErrStr, method.Type())
+	}
+
+	// the method of an empty body has no value
+	if result == nil {
+		result = object.NativeNull
+	}
+	if result.Type() == object.ObjError {
+		return result
+	}
+	switch infix.Operator {
+	case string(token.EQ), string(token.LT), string(token.GT):
+		return nativeBoolean(isTruthyObject(result))
+	case string(token.NotEq):
+		return nativeBoolean(!isTruthyObject(result))
+	}
+	return result
+}
+
+// evalNullCoalescing the rhs of a ?? b is only evaluated when the lhs is null
+func (e *Evaluator) evalNullCoalescing(infix *ast.InfixExpression, env *object.Environment) object.Object {
+	lhsObj := e.Eval(infix.Lhs, env)
+	if lhsObj != object.NativeNull {
+		return lhsObj
+	}
+	return e.Eval(infix.Rhs, env)
+}
+
 //func evalIndex(array, index object.Object) object.Object {
 //
 //}
 
 func evalNotEqual(lhsObj, rhsObj object.Object) object.Object {
-	l := lhsObj.(object.Equatable)
-	r := rhsObj.(object.Equatable)
-	return l.NotEqual(r)
+	return nativeBoolean(!object.Equals(lhsObj, rhsObj))
 }
 
 func evalEqual(lhsObj, rhsObj object.Object) object.Object {
-	l := lhsObj.(object.Equatable)
-	r := rhsObj.(object.Equatable)
-	return l.Equal(r)
+	return nativeBoolean(object.Equals(lhsObj, rhsObj))
 }
 
 func evalLessThan(lhsObj, rhsObj object.Object) object.Object {
-	l := lhsObj.(object.Comparable)
-	r := rhsObj.(object.Comparable)
-	return l.LessThan(r)
+	c, err := Compare(string(token.LT), lhsObj, rhsObj)
+	if err != nil {
+		return err
+	}
+	return nativeBoolean(c < 0)
 }
 
 func evalGreaterThan(lhsObj, rhsObj object.Object) object.Object {
-	l := lhsObj.(object.Comparable)
-	r := rhsObj.(object.Comparable)
-	return l.GreaterThan(r)
+	c, err := Compare(string(token.GT), lhsObj, rhsObj)
+	if err != nil {
+		return err
+	}
+	return nativeBoolean(c > 0)
 }
 
 func evalAdd(lhsObj, rhsObj object.Object) object.Object {
@@ -154,8 +236,8 @@ func evalInfixExpressionIntegerLiteral(operator token.TokenType, lhsIntegerObj,
 	}
 }
 
-func evalPrefixExpression(prefix *ast.PrefixExpression, env *object.Environment) object.Object {
-	rhs := Eval(prefix.Right, env)
+func (e *Evaluator) evalPrefixExpression(prefix *ast.PrefixExpression, env *object.Environment) object.Object {
+	rhs := e.Eval(prefix.Right, env)
 	err := PrefixExpressionTypeCheck(prefix.Operator, rhs)
 	if err != nil {
 		return err
@@ -163,22 +245,19 @@ func evalPrefixExpression(prefix *ast.PrefixExpression, env *object.Environment)
 
 	switch prefix.Operator {
 	case string(token.BANG):
-		return evalBangOfPrefixExpression(prefix.Right, env)
+		return evalBangOfPrefixExpression(rhs)
 	case string(token.SUB):
-		return evalMinusOfPrefixExpression(prefix.Right, env)
+		return evalMinusOfPrefixExpression(rhs)
 	default:
 		panic(common.ErrUnknownToken)
 	}
 }
 
-func evalMinusOfPrefixExpression(rightExpr ast.Expression, env *object.Environment) object.Object {
-	right := Eval(rightExpr, env)
-	integer := right.(*object.Integer)
-	return &object.Integer{Value: -integer.Value}
+func evalMinusOfPrefixExpression(right object.Object) object.Object {
+	return right.(object.Negative).Negative()
 }
 
-func evalBangOfPrefixExpression(rightExpr ast.Expression, env *object.Environment) object.Object {
-	right := Eval(rightExpr, env)
+func evalBangOfPrefixExpression(right object.Object) object.Object {
 	switch right {
 	case object.NativeFalse:
 		return object.NativeTrue
@@ -199,25 +278,76 @@ func nativeBoolean(input bool) object.Object {
 	}
 }
 
-func evalLetStatement(letStatement *ast.LetStatement, env *object.Environment) object.Object {
-	obj := Eval(letStatement.Value, env)
+func (e *Evaluator) evalLetStatement(letStatement *ast.LetStatement, env *object.Environment) object.Object {
+	obj := e.Eval(letStatement.Value, env)
 	if obj.Type() == object.ObjError {
 		return obj
 	}
-	env.Set(letStatement.Name.Value, obj)
+	bind(env, letStatement.Name, obj)
 	return obj
 }
 
-func evalCallExpression(call *ast.CallExpression, env *object.Environment) object.Object {
-	fnOrBuiltIn := Eval(call.Fn, env)
+// bind bind the value to the identifier declared in the environment, in its slot if it's resolved
+func bind(env *object.Environment, identifier *ast.Identifier, obj object.Object) {
+	if depth, slot, ok := identifier.Binding(); ok && depth == 0 && env.SetSlot(slot, obj) {
+		return
+	}
+	env.Set(identifier.Value, obj)
+}
+
+// evalCallExpression a call in tail position of a function body is returned as a tailCall, see evalTail
+func (e *Evaluator) evalCallExpression(call *ast.CallExpression, env *object.Environment, tail bool) object.Object {
+	fnOrBuiltIn := e.Eval(call.Fn, env)
+	if fnOrBuiltIn.Type() == object.ObjError {
+		return fnOrBuiltIn
+	}
 	switch fnValue := fnOrBuiltIn.(type) {
 	case *object.Fn:
-		return evalFn(call, fnValue, env)
+		args, err := e.evalExpressions(call.Arguments, env)
+		if err != nil {
+			return err
+		}
+		if tail {
+			return &tailCall{fn: fnValue, args: args, frame: newFrame(call)}
+		}
+		return e.evalFn(fnValue, args, newFrame(call))
 	case *object.BuiltIn:
-		return evalBuiltIn(call, fnValue, env)
+		args, err := e.evalExpressions(call.Arguments, env)
+		if err != nil {
+			return err
+		}
+		return e.callBuiltIn(fnValue, args, newFrame(call))
 	default:
-		return object.NativeNull
+		return newError("%s %s", notFunctionErrStr, fnOrBuiltIn.Type())
+	}
+}
+
+// evalExpressions evaluate the elements of an array literal or the arguments of a call from left to right,
+// a SpreadExpression is expanded into the elements of the array it evaluates to.
+func (e *Evaluator) evalExpressions(exprs []ast.Expression, env *object.Environment) ([]object.Object, *object.Error) {
+	objs := make([]object.Object, 0, len(exprs))
+	for _, expr := range exprs {
+		spread, ok := expr.(*ast.SpreadExpression)
+		if !ok {
+			obj := e.Eval(expr, env)
+			if obj.Type() == object.ObjError {
+				return nil, obj.(*object.Error)
+			}
+			objs = append(objs, obj)
+			continue
+		}
+
+		obj := e.Eval(spread.Value, env)
+		if obj.Type() == object.ObjError {
+			return nil, obj.(*object.Error)
+		}
+		array, ok := obj.(*object.Array)
+		if !ok {
+			return nil, newError("%s %s", cannotSpreadErrStr, obj.Type())
+		}
+		objs = append(objs, array.Elements()...)
 	}
+	return objs, nil
 }
 
 func evalStringLiteral(stringLiteral *ast.StringLiteral) object.Object {
@@ -226,25 +356,42 @@ func evalStringLiteral(stringLiteral *ast.StringLiteral) object.Object {
 	}
 }
 
-func evalArrayLiteral(al *ast.ArrayLiteral, environment *object.Environment) object.Object {
-	array := &object.Array{Elements: make([]object.Object, 0)}
-	for _, element := range al.Elements {
-		obj := Eval(element, environment)
-		if obj.Type() == object.ObjError {
-			return obj
+func (e *Evaluator) evalArrayLiteral(al *ast.ArrayLiteral, environment *object.Environment) object.Object {
+	elements, err := e.evalExpressions(al.Elements, environment)
+	if err != nil {
+		return err
+	}
+	return e.allocate(object.NewArray(elements))
+}
+
+func (e *Evaluator) evalSetLiteral(sl *ast.SetLiteral, environment *object.Environment) object.Object {
+	elements, err := e.evalExpressions(sl.Elements, environment)
+	if err != nil {
+		return err
+	}
+	set := object.NewSet()
+	for _, element := range elements {
+		hashable, ok := object.AsHashable(element)
+		if !ok {
+			return newError("%s type = [%s]", hashableNotImplementError, element.Type())
 		}
-		array.Elements = append(array.Elements, obj)
+		set.Insert(hashable)
 	}
-	return array
+	return e.allocate(set)
 }
 
-func evalIndexExpression(ie *ast.IndexExpression, environment *object.Environment) object.Object {
-	lhs := Eval(ie.Lhs, environment)
+func (e *Evaluator) evalIndexExpression(ie *ast.IndexExpression, environment *object.Environment) object.Object {
+	lhs := e.Eval(ie.Lhs, environment)
 	if lhs.Type() == object.ObjError {
 		return lhs
 	}
 
-	index := Eval(ie.Index, environment)
+	// short-circuit lhs?[index] and lhs?.name, the index is not evaluated at all
+	if ie.Optional && lhs == object.NativeNull {
+		return object.NativeNull
+	}
+
+	index := e.Eval(ie.Index, environment)
 	if index.Type() == object.ObjError {
 		return index
 	}
@@ -257,39 +404,169 @@ func evalIndexExpression(ie *ast.IndexExpression, environment *object.Environmen
 	return array.Index(index)
 }
 
-func evalHash(expr *ast.HashExpression, environment *object.Environment) object.Object {
-	hash := &object.Hash{Pairs: map[object.HashKey]*object.HashPair{}}
-	for k, v := range expr.Pairs {
-		key := Eval(k, environment)
+func (e *Evaluator) evalHash(expr *ast.HashExpression, environment *object.Environment) object.Object {
+	hash := object.NewHash()
+	for _, pair := range expr.Pairs {
+		if pair.Spread != nil {
+			obj := e.Eval(pair.Spread.Value, environment)
+			if obj.Type() == object.ObjError {
+				return obj
+			}
+			other, ok := obj.(*object.Hash)
+			if !ok {
+				return newError("%s %s", cannotSpreadErrStr, obj.Type())
+			}
+			hash.Merge(other)
+			continue
+		}
+
+		key := e.Eval(pair.Key, environment)
 		if key.Type() == object.ObjError {
 			return key
 		}
-		value := Eval(v, environment)
+		value := e.Eval(pair.Value, environment)
 		if value.Type() == object.ObjError {
 			return value
 		}
 
-		hashable, ok := key.(object.Hashable)
+		hashable, ok := object.AsHashable(key)
 		if !ok {
 			return newError("%s type = [%s]", hashableNotImplementError, key.Type())
 		}
-		hash.Pairs[hashable.HashKey()] = &object.HashPair{
-			Key:   key,
-			Value: value,
+		hash.Set(hashable, value)
+	}
+	return e.allocate(hash)
+}
+
+func (e *Evaluator) evalArrayComprehension(ac *ast.ArrayComprehension, env *object.Environment) object.Object {
+	array := object.NewArray(nil)
+	err := e.evalComprehensionClause(ac.Clause, env, func(scope *object.Environment) *object.Error {
+		element := e.Eval(ac.Element, scope)
+		if element.Type() == object.ObjError {
+			return element.(*object.Error)
+		}
+		if err := e.budget.Allocate(1); err != nil {
+			return e.budgetError(err)
 		}
+		array.Append(element)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return array
+}
+
+func (e *Evaluator) evalHashComprehension(hc *ast.HashComprehension, env *object.Environment) object.Object {
+	hash := object.NewHash()
+	err := e.evalComprehensionClause(hc.Clause, env, func(scope *object.Environment) *object.Error {
+		key := e.Eval(hc.Key, scope)
+		if key.Type() == object.ObjError {
+			return key.(*object.Error)
+		}
+		value := e.Eval(hc.Value, scope)
+		if value.Type() == object.ObjError {
+			return value.(*object.Error)
+		}
+		hashable, ok := object.AsHashable(key)
+		if !ok {
+			return newError("%s type = [%s]", hashableNotImplementError, key.Type())
+		}
+		if err := e.budget.Allocate(1); err != nil {
+			return e.budgetError(err)
+		}
+		hash.Set(hashable, value)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 	return hash
 }
 
+// evalComprehensionClause loop over the iterable with a plain Go loop, so that long comprehensions don't consume
+// any call depth, and call body for every element satisfying the condition.
+// Every iteration binds the targets in a new environment, so closures created by the body capture their own element.
+func (e *Evaluator) evalComprehensionClause(clause *ast.ComprehensionClause, env *object.Environment, body func(scope *object.Environment) *object.Error) *object.Error {
+	obj := e.Eval(clause.Iterable, env)
+	if obj.Type() == object.ObjError {
+		return obj.(*object.Error)
+	}
+	iterable, ok := obj.(object.Iterable)
+	if !ok {
+		return newError("%s %s", notIterableErrStr, obj.Type())
+	}
+
+	iterator := iterable.Iterator()
+	for element, ok := iterator.Next(e.budget); ok; element, ok = iterator.Next(e.budget) {
+		if err, isError := element.(*object.Error); isError {
+			return err
+		}
+		scope := object.NewFrame(env, clause.Locals())
+		err := bindComprehensionTargets(clause, scope, element)
+		if err != nil {
+			return err
+		}
+
+		if clause.Condition != nil {
+			condition := e.Eval(clause.Condition, scope)
+			if condition.Type() == object.ObjError {
+				return condition.(*object.Error)
+			}
+			if !isTruthyObject(condition) {
+				continue
+			}
+		}
+
+		err = body(scope)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindComprehensionTargets bind the element to the single target, or destructure it into [k, v],
+// the targets exceeding the length of the element are bound to null
+func bindComprehensionTargets(clause *ast.ComprehensionClause, scope *object.Environment, element object.Object) *object.Error {
+	if !clause.Destructure {
+		bind(scope, clause.Targets[0], element)
+		return nil
+	}
+
+	array, ok := element.(*object.Array)
+	if !ok {
+		return newError("%s %s", cannotDestructureErrStr, element.Type())
+	}
+	for i, target := range clause.Targets {
+		var value object.Object = object.NativeNull
+		if i < array.Size() {
+			value = array.Get(i)
+		}
+		bind(scope, target, value)
+	}
+	return nil
+}
+
 func evalFnLiteral(fnLiteral *ast.FnLiteral, env *object.Environment) *object.Fn {
 	return &object.Fn{
 		Params: fnLiteral.Parameters,
 		Body:   fnLiteral.Body,
 		Env:    env,
+		Locals: fnLiteral.Locals(),
+
+		Generator: fnLiteral.Generator,
 	}
 }
 
+// evalIdentifier a resolved identifier is read from its slot, an identifier whose slot is not set yet,
+// like a binding declared by a let statement which is not evaluated, falls back to the lookup by its name
 func evalIdentifier(identifier *ast.Identifier, env *object.Environment) object.Object {
+	if depth, slot, ok := identifier.Binding(); ok {
+		if value := env.Slot(depth, slot); value != nil {
+			return value
+		}
+	}
 	value, ok := env.Get(identifier.Value)
 	if !ok {
 		return newError("%s %s", identifierNotFoundErrStr, identifier.Value)
@@ -297,16 +574,16 @@ func evalIdentifier(identifier *ast.Identifier, env *object.Environment) object.
 	return value
 }
 
-func evalReturnStatement(returnStmt *ast.ReturnStatement, env *object.Environment) object.Object {
+func (e *Evaluator) evalReturnStatement(returnStmt *ast.ReturnStatement, env *object.Environment) object.Object {
 	return &object.Return{
-		Object: Eval(returnStmt.ReturnValue, env),
+		Object: e.Eval(returnStmt.ReturnValue, env),
 	}
 }
 
-func evalStatements(stmts []ast.Statement, env *object.Environment, wrapReturn bool) object.Object {
+func (e *Evaluator) evalStatements(stmts []ast.Statement, env *object.Environment, wrapReturn bool) object.Object {
 	var result object.Object
 	for _, stmt := range stmts {
-		result = Eval(stmt, env)
+		result = e.Eval(stmt, env)
 		if result == nil {
 			continue
 		}
@@ -327,14 +604,17 @@ func evalStatements(stmts []ast.Statement, env *object.Environment, wrapReturn b
 	return result
 }
 
-func evalIfExpression(ifStmt *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ifStmt.Condition, env)
+func (e *Evaluator) evalIfExpression(ifStmt *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ifStmt.Condition, env)
+	if condition.Type() == object.ObjError {
+		return condition
+	}
 	if isTruthyObject(condition) {
-		return Eval(ifStmt.Consequence, env)
+		return e.Eval(ifStmt.Consequence, env)
 	}
 
 	if ifStmt.Alternative != nil {
-		return Eval(ifStmt.Alternative, env)
+		return e.Eval(ifStmt.Alternative, env)
 	} else {
 		return object.NativeNull
 	}
@@ -369,23 +649,25 @@ func newError(format string, a ...any) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-func evalBuiltIn(call *ast.CallExpression, builtIn *object.BuiltIn, env *object.Environment) object.Object {
-	args := make([]object.Object, 0)
-	for _, argument := range call.Arguments {
-		argValue := Eval(argument, env)
-		args = append(args, argValue)
+// callBuiltIn call the built-in function in its own frame
+func (e *Evaluator) callBuiltIn(builtIn *object.BuiltIn, args []object.Object, frame object.Frame) object.Object {
+	if err := e.pushFrame(frame); err != nil {
+		return err
 	}
-	return builtIn.BuiltInFn(args...)
+	defer e.popFrame()
+	return e.attachStack(e.allocate(builtIn.Call(e.budget, args...)))
 }
 
 //func evalArguments(call *ast.CallExpression, env *object.Environment) object.Object {
 //
 //}
 
-func evalFn(call *ast.CallExpression, fn *object.Fn, callEnv *object.Environment) object.Object {
-	if len(call.Arguments) != len(fn.Params) {
-		return newError("%s expected [%d], got [%d]", paramsNumberMismatchErrStr, len(call.Arguments), len(fn.Params))
+// evalFn call the function in a new frame of the call stack, the error produced by the call gets the call stack
+func (e *Evaluator) evalFn(fn *object.Fn, args []object.Object, frame object.Frame) object.Object {
+	if err := e.pushFrame(frame); err != nil {
+		return err
 	}
+	defer e.popFrame()
 
 	// there are two distinct environments associated with a function
 	// 1. call environment : the environment when the function is called;
@@ -396,18 +678,92 @@ func evalFn(call *ast.CallExpression, fn *object.Fn, callEnv *object.Environment
 	// the fn.Env contains environment: call env -> ...
 	// so what we should do is initiate the args, and use fn.Env as its parent env.
 
-	// env for arguments
-	argumentsEnv := object.NewEnvironment(fn.Env)
-	for i, arg := range call.Arguments {
-		value := Eval(arg, callEnv)
-		if value.Type() == object.ObjError {
-			return value
+	// a call in tail position is returned by evalTail instead of being evaluated, we call it in the loop
+	// so that a tail recursion, which is the only way to loop, doesn't grow the Go stack
+	for {
+		if len(args) != len(fn.Params) {
+			return e.attachStack(newError("%s expected [%d], got [%d]", paramsNumberMismatchErrStr, len(fn.Params), len(args)))
+		}
+
+		// env for arguments, it's the frame of the call
+		argumentsEnv := object.NewFrame(fn.Env, fn.Locals)
+		for i, value := range args {
+			// bind argument value to params
+			bind(argumentsEnv, fn.Params[i], value)
+		}
+		if fn.Generator {
+			return e.newGenerator(fn, argumentsEnv)
+		}
+		fnEvalResult := unwrapReturnValue(e.evalTail(fn.Body, argumentsEnv, true))
+
+		call, ok := fnEvalResult.(*tailCall)
+		if !ok {
+			return e.attachStack(fnEvalResult)
+		}
+		// the tail call replaces the frame of its caller
+		fn, args = call.fn, call.args
+		e.stack[len(e.stack)-1] = call.frame
+	}
+}
+
+// tailCall a call in tail position of a function body, which is called by the loop of evalFn
+type tailCall struct {
+	fn    *object.Fn
+	args  []object.Object
+	frame object.Frame
+}
+
+func (t *tailCall) Type() object.ObjType {
+	return objTailCall
+}
+
+func (t *tailCall) Inspect() string {
+	return fmt.Sprintf("tail call of %s", t.fn.Inspect())
+}
+
+// evalTail evaluate a node of a function body like Eval, except that the calls in tail position are returned
+// as tailCall instead of being evaluated. A call is in tail position if its value is the value of the function:
+// the value of a return statement, or the last expression of the body, including the branches of an if
+// expression there. The last reports whether the node is the last expression of the body.
+func (e *Evaluator) evalTail(node ast.Node, env *object.Environment, last bool) object.Object {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		var result object.Object
+		for i, stmt := range node.Statements {
+			result = e.evalTail(stmt, env, last && i == len(node.Statements)-1)
+			if result == nil {
+				continue
+			}
+			if result.Type() == object.ObjReturn || result.Type() == object.ObjError {
+				return result
+			}
+		}
+		return result
+	case *ast.ExpressionStatement:
+		return e.evalTail(node.Expr, env, last)
+	case *ast.ReturnStatement:
+		// the statements after a return are never evaluated, so the value of the return is always in tail position
+		return &object.Return{Object: e.evalTail(node.ReturnValue, env, true)}
+	case *ast.IfExpression:
+		condition := e.Eval(node.Condition, env)
+		if condition.Type() == object.ObjError {
+			return condition
+		}
+		if isTruthyObject(condition) {
+			return e.evalTail(node.Consequence, env, last)
+		}
+		if node.Alternative != nil {
+			return e.evalTail(node.Alternative, env, last)
+		}
+		return object.NativeNull
+	case *ast.CallExpression:
+		return e.evalCallExpression(node, env, last)
+	case *ast.InfixExpression:
+		if node.IsUserDefined() {
+			return e.evalCallExpression(node.LowerToCall(), env, last)
 		}
-		// bind argument value to params
-		argumentsEnv.Set(fn.Params[i].String(), value)
 	}
-	fnEvalResult := Eval(fn.Body, argumentsEnv)
-	return unwrapReturnValue(fnEvalResult)
+	return e.Eval(node, env)
 }
 
 //func getFnOrBuiltIn(call *ast.CallExpression, env *object.Environment) (object.Object, *object.Error) {
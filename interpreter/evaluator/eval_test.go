@@ -1,11 +1,19 @@
 package evaluator
 
 import (
+	"0x822a5b87/monkey/interpreter/ast"
+	"0x822a5b87/monkey/interpreter/common"
 	"0x822a5b87/monkey/interpreter/lexer"
 	"0x822a5b87/monkey/interpreter/object"
 	"0x822a5b87/monkey/interpreter/parser"
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"runtime/debug"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvalInteger(t *testing.T) {
@@ -57,6 +65,33 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"!true", false},
+		{"!false", true},
+		{"!!5", true},
+		{"!null", true},
+		{"!fn() { 1 }", false},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" < "b"`, true},
+		{`"ab" > "a"`, true},
+		{`"b" < "ab"`, false},
+		{"[1, [2, 3]] == [1, [2, 3]]", true},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 2] < [1, 2, 0]", true},
+		{`[true, "b"] > [true, "a"]`, true},
+		{"[] < []", false},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{"1 == true", false},
+		{`1 != "1"`, true},
+		{"null == null", true},
+		{"[null] == [false]", false},
+		{"let f = fn() { 1 }; f == f", true},
+		{"fn() { 1 } == fn() { 1 }", false},
+		{"len == len", true},
+		{"len == first", false},
 	}
 
 	for _, tt := range tests {
@@ -192,6 +227,78 @@ func TestErrorHandling(t *testing.T) {
 			`"Hello" - "World"`,
 			"unknown operator: STRING - STRING",
 		},
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"let f = fn(x) { x / 0 }; f(1) + 1",
+			"division by zero",
+		},
+		{
+			"9223372036854775808 / 0",
+			"division by zero",
+		},
+		{
+			"if (1 / 0) { 1 }",
+			"division by zero",
+		},
+		{
+			"-true",
+			"unknown operator: -BOOLEAN",
+		},
+		{
+			`-"a"`,
+			"unknown operator: -STRING",
+		},
+		{
+			"-null",
+			"unknown operator: -NULL",
+		},
+		{
+			"1[0]",
+			"unknown operator:not an index expression : INTEGER",
+		},
+		{
+			"null[0]",
+			"unknown operator:not an index expression : NULL",
+		},
+		{
+			"{1: 1}[[{}]]",
+			"unusable as hash key: ARRAY",
+		},
+		{
+			"1()",
+			"not a function: INTEGER",
+		},
+		{
+			"fn(a) { a }()",
+			"number of parameters mismatch: expected [1], got [0]",
+		},
+		{
+			"fn() { 1 }(1)",
+			"number of parameters mismatch: expected [0], got [1]",
+		},
+		{
+			"fn(a) { a }(...[1, 2])",
+			"number of parameters mismatch: expected [1], got [2]",
+		},
+		{
+			`"a" < 1`,
+			"type mismatch: STRING < INTEGER",
+		},
+		{
+			`[1, 2] < [1, "a"]`,
+			"type mismatch: INTEGER < STRING",
+		},
+		{
+			"[true] > [false]",
+			"unknown operator: BOOLEAN > BOOLEAN",
+		},
+		{
+			`{"a": 1} < {"a": 2}`,
+			"unknown operator: HASH < HASH",
+		},
 		{
 			"if (10 > 1) { true + false; }",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -220,6 +327,34 @@ func TestErrorHandling(t *testing.T) {
 			`999[1]`,
 			"unknown operator:not an index expression : INTEGER",
 		},
+		{
+			`[...1]`,
+			"cannot spread: INTEGER",
+		},
+		{
+			`{...[1]}`,
+			"cannot spread: ARRAY",
+		},
+		{
+			`let f = fn(a) { a }; f(...{})`,
+			"cannot spread: HASH",
+		},
+		{
+			`let f = fn(a) { a }; f(...[1, 2])`,
+			"number of parameters mismatch: expected [1], got [2]",
+		},
+		{
+			`[x for x in 1]`,
+			"not iterable: INTEGER",
+		},
+		{
+			`[k for [k, v] in [1]]`,
+			"cannot destructure: INTEGER",
+		},
+		{
+			`[x for x in [1, 2] if x + true]`,
+			"type mismatch: INTEGER + BOOLEAN",
+		},
 	}
 
 	for _, tt := range tests {
@@ -239,6 +374,40 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		big      bool
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808", true},
+		{"-9223372036854775807 - 2", "-9223372036854775809", true},
+		{"4294967296 * 4294967296", "18446744073709551616", true},
+		{"-9223372036854775807 - 1", "-9223372036854775808", false},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808", true},
+		{"(-9223372036854775807 - 1) / -1", "9223372036854775808", true},
+		{"(9223372036854775807 + 1) - 1", "9223372036854775807", false},
+		{"100000000000000000000 / 10", "10000000000000000000", true},
+		{"-100000000000000000000 / 100", "-1000000000000000000", false},
+		{"let f = fn(n) { if (n < 2) { 1 } else { n * f(n - 1) } }; f(25)", "15511210043330985984000000", true},
+		{"9223372036854775808 > 9223372036854775807", "true", false},
+		{"9223372036854775808 == 9223372036854775807 + 1", "true", false},
+		{"9223372036854775808 == 9223372036854775808 - 1", "false", false},
+		{"{9223372036854775807: 1}[9223372036854775808 - 1]", "1", false},
+		{"{9223372036854775808: 1}[9223372036854775807 + 1]", "1", false},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("test case [%d] expected [%s], got [%s]", i, tt.expected, evaluated.Inspect())
+		}
+		if _, ok := evaluated.(*object.BigInteger); ok != tt.big {
+			t.Errorf("test case [%d] expected a big integer [%t], got [%T]", i, tt.big, evaluated)
+		}
+	}
+}
+
 func TestLetStatement(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -402,14 +571,14 @@ func TestArrayLiterals(t *testing.T) {
 		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	if len(result.Elements) != 3 {
+	if result.Size() != 3 {
 		t.Fatalf("array has wrong num of elements. got=%d",
-			len(result.Elements))
+			result.Size())
 	}
 
-	testIntegerObject(t, 0, result.Elements[0], 1)
-	testIntegerObject(t, 0, result.Elements[1], 4)
-	testIntegerObject(t, 0, result.Elements[2], 6)
+	testIntegerObject(t, 0, result.Get(0), 1)
+	testIntegerObject(t, 0, result.Get(1), 4)
+	testIntegerObject(t, 0, result.Get(2), 6)
 }
 
 func TestArrayIndexExpressions(t *testing.T) {
@@ -533,21 +702,21 @@ func TestHashLiterals(t *testing.T) {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	expected := map[object.HashKey]int64{
-		(&object.StringObj{Value: "one"}).HashKey():   1,
-		(&object.StringObj{Value: "two"}).HashKey():   2,
-		(&object.StringObj{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():         4,
-		object.NativeTrue.HashKey():                   5,
-		object.NativeFalse.HashKey():                  6,
+	expected := map[object.Hashable]int64{
+		&object.StringObj{Value: "one"}:   1,
+		&object.StringObj{Value: "two"}:   2,
+		&object.StringObj{Value: "three"}: 3,
+		&object.Integer{Value: 4}:         4,
+		object.NativeTrue:                 5,
+		object.NativeFalse:                6,
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
 	}
 
 	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+		pair, ok := result.Get(expectedKey)
 		if !ok {
 			t.Errorf("no pair for given key in Pairs")
 		}
@@ -556,6 +725,117 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestHashInsertionOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: 3, true: 4}`, `{b:1, a:2, 3:3, true:4}`},
+		{`{"b": 1, "a": 2, "b": 3}`, `{b:3, a:2}`},
+		{`let h = {"b": 1, "a": 2}; {"c": 0, ...h, "b": 3}`, `{c:0, b:3, a:2}`},
+		{`let h = {"b": 1, "a": 2}; {"b": 0, ...h}`, `{b:1, a:2}`},
+		{`let h = {"z": 1, "y": 2, "x": 3}; [k for [k, v] in h]`, `[z, y, x]`},
+		{`{k: v for [k, v] in [["z", 1], ["y", 2], ["x", 3]]}`, `{z:1, y:2, x:3}`},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("tests[%d] expected=%q, got=%q", i, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestPersistentCollections(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let a = [1, 2, 3]; let b = push(a, 4); [a, b]`, `[[1, 2, 3], [1, 2, 3, 4]]`},
+		{`let a = [1, 2, 3]; let b = rest(a); [a, b, rest(rest(b)), rest([])]`, `[[1, 2, 3], [2, 3], [], null]`},
+		{`let a = [1, 2, 3]; let b = assoc(a, 1, 0); [a, b, assoc(a, 3, 4)]`, `[[1, 2, 3], [1, 0, 3], [1, 2, 3, 4]]`},
+		{`assoc([1], 2, 0)`, `array index out of range: 2`},
+		{`assoc([1], -1, 0)`, `array index out of range: -1`},
+		{`assoc([1], "a", 0)`, `array index must be an INTEGER, got STRING`},
+		{`assoc([1], 99999999999999999999, 0)`, `array index out of range: 99999999999999999999`},
+		{`assoc([1], -99999999999999999999, 0)`, `array index out of range: -99999999999999999999`},
+		{`let h = {"a": 1}; let g = assoc(h, "b", 2); [h, g, assoc(g, "a", 0)]`, `[{a:1}, {a:1, b:2}, {a:0, b:2}]`},
+		{`let h = {"a": 1, "b": 2, "c": 3}; let g = dissoc(h, "b"); [h, g, dissoc(g, "x"), assoc(g, "b", 4)]`,
+			`[{a:1, b:2, c:3}, {a:1, c:3}, {a:1, c:3}, {a:1, c:3, b:4}]`},
+		{`dissoc({"a": 1}, [{}])`, `unusable as hash key: ARRAY`},
+		{`dissoc([1], 0)`, "argument to `dissoc` not supported, got ARRAY"},
+		{`let build = fn(a, n) { if (n == 0) { a } else { build(push(a, n), n - 1) } };
+		let a = build([], 100);
+		let drop = fn(a, n) { if (n == 0) { a } else { drop(rest(a), n - 1) } };
+		[len(a), a[0], a[99], first(drop(a, 98)), len(drop(a, 98)), assoc(a, 64, 0)[64], a[64]]`,
+			`[100, 100, 1, 2, 2, 0, 36]`},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("tests[%d] expected=%q, got=%q", i, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestArrayKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let grid = {[0, 0]: "a", [0, 1]: "b"}; [grid[[0, 0]], grid[[0, 1]], grid[[1, 0]]]`, `[a, b, null]`},
+		{`let k = [1, [2, "x"]]; let h = {k: 1}; h[[1, [2, "x"]]]`, `1`},
+		{`#{[1, 2], [1, 2], [2, 1]}`, `#{[1, 2], [2, 1]}`},
+		{`[[1, 2] in #{[1, 2]}, [2] in #{[1, 2]}, [1] in {[1]: 0}]`, `[true, false, true]`},
+		{`let h = assoc({}, [1], 1); [h, dissoc(h, [1])]`, `[{[1]:1}, {}]`},
+		{`{[1, 2]: 1} == {[1, 2]: 1}`, `true`},
+		{`{[1, fn() {}]: 1}`, `hashable not implement: type = [ARRAY]`},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("tests[%d] expected=%q, got=%q", i, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestSets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`#{}`, `#{}`},
+		{`#{3, 1, 2, 1, 3}`, `#{3, 1, 2}`},
+		{`let xs = [2, 3]; #{1, ...xs, 2}`, `#{1, 2, 3}`},
+		{`len(#{"a", "b", "a"})`, `2`},
+		{`[2 in #{1, 2}, 3 in #{1, 2}, "a" in {"a": 1}, 1 in [0, 1], [1] in [[1]], 1 in []]`,
+			`[true, false, true, true, true, false]`},
+		{`1 + 1 in #{2} == true`, `true`},
+		{`let s = #{1, 2}; let t = add(s, 3); [s, t, add(t, 1), remove(t, 1), remove(s, 5)]`,
+			`[#{1, 2}, #{1, 2, 3}, #{1, 2, 3}, #{2, 3}, #{1, 2}]`},
+		{`[contains(#{1}, 1), contains({"a": 1}, "b"), contains([1], 1)]`, `[true, false, true]`},
+		{`let a = #{1, 2, 3}; let b = #{3, 4, 2}; [union(a, b), intersection(a, b), difference(a, b), difference(b, a)]`,
+			`[#{1, 2, 3, 4}, #{2, 3}, #{1}, #{4}]`},
+		{`#{1, 2} == #{2, 1}`, `true`},
+		{`#{1, 2} == #{1}`, `false`},
+		{`[x * 2 for x in #{1, 2, 1}]`, `[2, 4]`},
+		{`#{[1, {}]}`, `hashable not implement: type = [ARRAY]`},
+		{`[fn() {}] in #{}`, `unusable as hash key: ARRAY`},
+		{`1 in 1`, `unknown operator: INTEGER in INTEGER`},
+		{`add([1], 1)`, "argument to `add` not supported, got ARRAY"},
+		{`union(#{1}, [1])`, "argument to `union` not supported, got ARRAY"},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("tests[%d] expected=%q, got=%q", i, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -602,6 +882,457 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestNullSafety(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null", nil},
+		{"null ?? 1", 1},
+		{"2 ?? 1", 2},
+		{"false ?? 1", false},
+		{"null ?? null ?? 3", 3},
+		{`{"a": 1}["b"] ?? 5`, 5},
+		{`let user = null; user?.name`, nil},
+		{`let user = {"name": "monkey"}; user?.name`, "monkey"},
+		{`let user = {"name": "monkey"}; user?.age ?? 18`, 18},
+		{`let xs = null; xs?[0]`, nil},
+		{`let xs = [1, 2]; xs?[1]`, 2},
+		{`let xs = null; xs?[undefined]`, nil},
+		{`let ys = [[1], null]; ys[1]?[0] ?? ys[0]?[0]`, 1},
+		{"null == null", true},
+		{"null != null", false},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, i, evaluated, int64(expected))
+		case string:
+			testStringObj(t, i, evaluated, expected)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestSpread(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = [1, 2]; len([...a, 3, ...a])`, 5},
+		{`let a = [1, 2]; [...a, 3, ...a][3]`, 1},
+		{`let a = [1, 2]; [0, ...a][2]`, 2},
+		{`len([...[], ...[]])`, 0},
+		{`let a = [1]; let b = [...a]; len(push(b, 2)) + len(a)`, 3},
+		{`let defaults = {"k": 1, "j": 2}; {...defaults, "k": 3}["k"]`, 3},
+		{`let defaults = {"k": 1, "j": 2}; {...defaults, "k": 3}["j"]`, 2},
+		{`let a = {"k": 1}; let b = {"k": 2}; {...a, ...b}["k"]`, 2},
+		{`let h = {"k": 2}; {"k": 1, ...h}["k"]`, 2},
+		{`let h = {"k": 2}; {"k": 1, ...h, "k": 3}["k"]`, 3},
+		{`let add = fn(a, b, c) { a + b + c }; let args = [1, 2]; add(...args, 3)`, 6},
+		{`let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])`, 6},
+		{`let forward = fn(f, args) { f(...args) }; forward(fn(a, b) { a * b }, [3, 4])`, 12},
+		{`len(...["monkey"])`, 6},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, i, evaluated, int64(tt.expected.(int)))
+	}
+}
+
+func TestComprehensions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`[x * 2 for x in [1, 2, 3]][2]`, 6},
+		{`len([x for x in [1, -2, 3, -4] if x > 0])`, 2},
+		{`len([x for x in []])`, 0},
+		{`let x = [1, 2]; [x * 10 for x in x][1]`, 20},
+		{`let xs = [1, 2]; let y = 3; [x + y for x in xs][0]`, 4},
+		{`let f = fn(xs, n) { [x * n for x in xs if x != n] }; f([1, 2, 3], 2)[1]`, 6},
+		{`[len(row) for row in [[x, x] for x in [1, 2, 3]]][2]`, 2},
+		{`[v for [k, v] in {"a": 1}][0]`, 1},
+		{`[b for [a, b] in [[1]]][0]`, nil},
+		{`let fs = [fn() { x } for x in [1, 2, 3]]; fs[0]() + fs[2]()`, 4},
+		{`let x = 1; [x for x in [2]]; x`, 1},
+		{`{k: v * 2 for [k, v] in [["a", 1], ["b", 2]] if v > 1}["b"]`, 4},
+		{`{k: v * 2 for [k, v] in [["a", 1], ["b", 2]] if v > 1}["a"]`, nil},
+		{`let h = {"a": 1, "b": 2}; {k: v + 1 for [k, v] in h}["b"]`, 3},
+	}
+
+	for i, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, i, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestComprehensionDoesNotRecurse(t *testing.T) {
+	// builds an array of 10 ^ 5 elements, which would be far too deep for a recursive implementation
+	names := []string{"a", "b", "c", "d", "e"}
+	input := "let a = [1, 1, 1, 1, 1, 1, 1, 1, 1, 1];"
+	for i := 1; i < len(names); i++ {
+		input += fmt.Sprintf("let %s = [%s];", names[i], strings.TrimSuffix(strings.Repeat("..."+names[i-1]+", ", 10), ", "))
+	}
+	input += "len([x * 2 for x in e if x > 0])"
+
+	testIntegerObject(t, 0, testEval(input), 100000)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let g = fn() { yield 1; yield 2 }; [x for x in g()]`, "[1, 2]"},
+		{`let g = fn(n) { yield n; yield n * 2 }; let it = g(3); next(it); next(it)`, "{value:6, done:false}"},
+		{`let g = fn() { yield 1 }; let it = g(); next(it); next(it)`, "{value:null, done:true}"},
+		{`let g = fn() { yield ..."ab"; yield ...[1, 2]; yield 3 }; [x for x in g()]`, "[a, b, 1, 2, 3]"},
+		{`let g = fn(xs) { [x for x in xs] }; g(iter(#{1}))`, "[1]"},
+		// a string is iterated by characters rather than bytes
+		{`[c for c in "héllo"]`, "[h, é, l, l, o]"},
+		{`let g = fn() { yield ..."日本" }; [c for c in g()]`, "[日, 本]"},
+		{`let f = fn(n) { if (n < 3) { yield n; yield ...f(n + 1) } }; [x for x in f(0)]`, "[0, 1, 2]"},
+		// a generator is lazy, only the elements asked for are computed
+		{`let count = fn(n) { yield n; yield ...count(n + 1) }; let it = count(0); next(it); next(it)["value"]`, "1"},
+		{`next(iter([]))`, "{value:null, done:true}"},
+		{`let g = fn() { yield 1; 1 / 0 }; [x for x in g()]`, "division by zero"},
+		{`let g = fn() { yield ...1 }; [x for x in g()]`, "not iterable: INTEGER"},
+		// a generator asking for the next element of its own iterator fails instead of waiting for itself
+		{`let g = fn() { yield 1; yield next(it)["value"] }; let it = g(); [x for x in it]`, "generator already executing"},
+		{`let g = fn() { yield 1; yield ...[x for x in it] }; let it = g(); [x for x in it]`, "generator already executing"},
+	}
+
+	for i, tt := range tests {
+		actual := testEval(tt.input)
+		if err, ok := actual.(*object.Error); ok {
+			actual = &object.StringObj{Value: err.Message}
+		}
+		if actual.Inspect() != tt.expected {
+			t.Errorf("tests[%d] expected=%q, got=%q", i, tt.expected, actual.Inspect())
+		}
+	}
+}
+
+func TestGeneratorDelegationDoesNotRecurse(t *testing.T) {
+	input := `let count = fn(n) { if (n > 0) { yield n; yield ...count(n - 1) } }; len([x for x in count(10000)])`
+
+	testIntegerObject(t, 0, testEval(input), 10000)
+}
+
+func TestOperatorOverloading(t *testing.T) {
+	vec := `let plus = fn(a, b) { {...a, "x": a["x"] + b["x"], "y": a["y"] + b["y"]} };
+let scale = fn(a, k) { {...a, "x": a["x"] * k, "y": a["y"] * k} };
+let same = fn(a, b) { [a["x"], a["y"]] == [b["x"], b["y"]] };
+let vec = fn(x, y) { {"x": x, "y": y, "__add__": plus, "__mul__": scale, "__eq__": same} };
+`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{vec + `(vec(1, 2) + vec(3, 4))["y"]`, "6"},
+		{vec + `(vec(1, 2) * 3)["x"]`, "3"},
+		// the method of the rhs is called when the lhs has none
+		{`let cents = {"__add__": fn(a, b) { a + b["value"] }, "value": 5}; 1 + cents`, "6"},
+		{vec + `vec(1, 2) == vec(1, 2)`, "true"},
+		{vec + `vec(1, 2) != vec(1, 2)`, "false"},
+		{vec + `vec(1, 2) != vec(2, 1)`, "true"},
+		{`let money = {"__lt__": fn(a, b) { a["cents"] < b["cents"] }, "cents": 1}; money < {"cents": 2}`, "true"},
+		{`{"__eq__": contains, "a": 1} == "a"`, "true"},
+		// the value of a comparison is converted to a Boolean by its truthiness
+		{`{"__eq__": fn(a, b) { "yes" }} == 2`, "true"},
+		{`{"__eq__": fn(a, b) { "yes" }} != 2`, "false"},
+		{`{"__eq__": fn(a, b) {}} == 2`, "false"},
+		{`{"__eq__": dissoc} == "a"`, "true"},
+		{`{"__eq__": dissoc} != "a"`, "false"},
+		{`{"__lt__": fn(a, b) { null }} < 1`, "false"},
+		{`{"__gt__": fn(a, b) { 1 }} > 1`, "true"},
+		{`{"__add__": fn(a, b) { "sum" }} + 1`, "sum"},
+		// a hash without the method of the operator is not a user-defined value for it
+		{`{"__add__": 1} == {"__add__": 1}`, "true"},
+		{`{"__eq__": fn(a, b) { 1 / 0 }} == 1`, "division by zero"},
+		{`{"__add__": 1} + 1`, "not a function: INTEGER"},
+	}
+
+	for i, tt := range tests {
+		actual := testEval(tt.input)
+		if err, ok := actual.(*object.Error); ok {
+			actual = &object.StringObj{Value: err.Message}
+		}
+		if actual.Inspect() != tt.expected {
+			t.Errorf("tests[%d] expected=%q, got=%q", i, tt.expected, actual.Inspect())
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// the last expression of the body, and the branches of an if expression there
+		{"let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } }; count(10, 0)", 10},
+		// a return statement anywhere in the body
+		{"let count = fn(n, acc) { if (n == 0) { return acc; }; return count(n - 1, acc + 1); }; count(10, 0)", 10},
+		{"let count = fn(n, acc) { if (n > 0) { return count(n - 1, acc + 1); }; acc }; count(10, 0)", 10},
+		// mutual recursion and calls of other functions in tail position
+		{`let even = fn(n) { if (n == 0) { 1 } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { 0 } else { even(n - 1) } };
+even(10) + odd(7)`, 2},
+		{"let f = fn(x) { x * 2 }; let g = fn(x) { f(x + 1) }; g(2)", 6},
+		// user-defined operators are calls too
+		{"infix 45 <+> (a, b) => a + b\nlet sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc <+> n) } }\nsum(10, 0)", 55},
+		// calls which are not in tail position are evaluated as usual
+		{"let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; fact(5)", 120},
+		{"let f = fn(x) { let y = len([x]); y + x }; f(1)", 2},
+		{"let id = fn(x) { x }; let f = fn() { id(1); id(2); }; f()", 2},
+	}
+
+	for i, tt := range tests {
+		testIntegerObject(t, i, testEval(tt.input), tt.expected)
+	}
+
+	obj := testEval("let f = fn(x) { x }; let g = fn() { f(1, 2) }; g()")
+	if err, ok := obj.(*object.Error); !ok || !strings.HasPrefix(err.Message, paramsNumberMismatchErrStr) {
+		t.Fatalf("expected a mismatch of the number of parameters, got [%s]", obj.Inspect())
+	}
+}
+
+func TestTailCallsRunInConstantStack(t *testing.T) {
+	// the Go stack of a recursive evaluation of 10 ^ 6 calls is far beyond the limit
+	defer debug.SetMaxStack(debug.SetMaxStack(64 << 20))
+
+	names := []string{"a", "b", "c", "d", "e", "f"}
+	input := "let a = [1, 1, 1, 1, 1, 1, 1, 1, 1, 1];"
+	for i := 1; i < len(names); i++ {
+		input += fmt.Sprintf("let %s = [%s];", names[i], strings.TrimSuffix(strings.Repeat("..."+names[i-1]+", ", 10), ", "))
+	}
+	input += `
+let sum = fn(xs, i, acc) {
+	if (i == len(xs)) {
+		return acc;
+	}
+	sum(xs, i + 1, acc + xs[i])
+};
+sum(f, 0, 0)`
+
+	testIntegerObject(t, 0, testEval(input), 1000000)
+}
+
+func TestErrorCallStack(t *testing.T) {
+	tests := []struct {
+		input    string
+		message  string
+		expected []object.Frame
+	}{
+		{
+			"let inner = fn(x) { x + y }\nlet outer = fn(x) { let r = inner(x); r }\nouter(1)",
+			"identifier not found: y",
+			[]object.Frame{{Function: "outer", Line: 3, Column: 6}, {Function: "inner", Line: 2, Column: 34}},
+		},
+		{
+			"let f = fn(x) { len(x) }\nf(1)",
+			"argument to `len` not supported, got INTEGER",
+			[]object.Frame{{Function: "f", Line: 2, Column: 2}, {Function: "len", Line: 1, Column: 20}},
+		},
+		{
+			"let f = fn(x) { x }\nlet g = fn() { 1 + f(1, 2) }\ng()",
+			"number of parameters mismatch: expected [1], got [2]",
+			[]object.Frame{{Function: "g", Line: 3, Column: 2}, {Function: "f", Line: 2, Column: 21}},
+		},
+		{
+			// a call in tail position replaces the frame of its caller
+			"let f = fn(x) { -x }\nlet g = fn() { f(true) }\ng()",
+			"unknown operator: -BOOLEAN",
+			[]object.Frame{{Function: "f", Line: 2, Column: 17}},
+		},
+		{
+			"let h = {\"f\": fn() { a }}\nh[\"f\"]()",
+			"identifier not found: a",
+			[]object.Frame{{Function: "(h[f])", Line: 2, Column: 7}},
+		},
+		{
+			"missing",
+			"identifier not found: missing",
+			nil,
+		},
+	}
+
+	for i, tt := range tests {
+		err, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Fatalf("test case [%d] expected an error", i)
+		}
+		if err.Message != tt.message {
+			t.Errorf("test case [%d] expected message [%s], got [%s]", i, tt.message, err.Message)
+		}
+		if !reflect.DeepEqual(err.Stack, tt.expected) {
+			t.Errorf("test case [%d] expected stack %v, got %v", i, tt.expected, err.Stack)
+		}
+	}
+
+	err := testEval("let f = fn() { 1 + g() }\nlet g = fn() { x }\nf()").(*object.Error)
+	expected := `Traceback (most recent call last):
+  at f (line 3, column 2)
+  at g (line 1, column 21)
+identifier not found: x`
+	if err.Traceback() != expected {
+		t.Fatalf("expected traceback:\n%s\ngot:\n%s", expected, err.Traceback())
+	}
+
+	// the consecutive identical frames of a recursion are folded
+	err = testEval("let f = fn(n) { if (n == 0) { x } else { 1 + f(n - 1) } }\nf(10)").(*object.Error)
+	expected = `Traceback (most recent call last):
+  at f (line 2, column 2)
+  at f (line 1, column 47)
+  at f (line 1, column 47)
+  at f (line 1, column 47)
+  ... previous frame repeated 7 more times
+identifier not found: x`
+	if err.Traceback() != expected {
+		t.Fatalf("expected traceback:\n%s\ngot:\n%s", expected, err.Traceback())
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	evalWithLimits := func(input string, limits common.Limits) object.Object {
+		program := parser.NewParser(*lexer.NewLexer(input)).ParseProgram()
+		return EvalWithContext(context.Background(), program, object.NewEnvironment(nil), limits)
+	}
+
+	obj := evalWithLimits("let f = fn(n) { 1 + f(n + 1) };\nf(0)", common.Limits{MaxCallDepth: 100})
+	err, ok := obj.(*object.Error)
+	if !ok || !errors.Is(err, common.ErrCallDepthExceeded) {
+		t.Fatalf("expected a stack overflow error, got [%s]", obj.Inspect())
+	}
+	if err.Message != "stack overflow: max call depth [100] exceeded" {
+		t.Fatalf("unexpected message [%s]", err.Message)
+	}
+	if len(err.Stack) != 100 {
+		t.Fatalf("expected a stack of [100] frames, got [%d]", len(err.Stack))
+	}
+
+	// the default max call depth is far below the depth which exhausts the Go stack
+	defer debug.SetMaxStack(debug.SetMaxStack(256 << 20))
+	obj = testEval("let f = fn(n) { 1 + f(n + 1) }; f(0)")
+	if err, ok := obj.(*object.Error); !ok || !errors.Is(err, common.ErrCallDepthExceeded) {
+		t.Fatalf("expected a stack overflow error, got [%s]", obj.Inspect())
+	}
+
+	// the calls in tail position don't count
+	obj = evalWithLimits(`
+let count = fn(n) { if (n == 0) { 0 } else { count(n - 1) } };
+count(1000)`, common.Limits{MaxCallDepth: 10})
+	testIntegerObject(t, 0, obj, 0)
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   common.Limits
+		expected error
+	}{
+		{"let loop = fn() { loop() }; loop()", common.Limits{MaxSteps: 10000}, common.ErrStepLimitExceeded},
+		{"let f = fn(n) { f(n + 1) + 1 }; f(0)", common.Limits{MaxCallDepth: 5}, common.ErrCallDepthExceeded},
+		{"let grow = fn(a) { grow([...a, ...a]) }; grow([1])", common.Limits{MaxAllocations: 1000}, common.ErrAllocationLimitExceeded},
+		{"let grow = fn(s) { grow(s + s) }; grow(\"a\")", common.Limits{MaxAllocations: 1000}, common.ErrAllocationLimitExceeded},
+		{"let a = [1, 2, 3, 4, 5]; [x * 2 for x in a]", common.Limits{MaxAllocations: 8}, common.ErrAllocationLimitExceeded},
+		{"{1: 1, 2: 2, 3: 3}", common.Limits{MaxAllocations: 2}, common.ErrAllocationLimitExceeded},
+		{"push([1, 2], 3)", common.Limits{MaxAllocations: 4}, common.ErrAllocationLimitExceeded},
+	}
+
+	for i, tt := range tests {
+		program := parser.NewParser(*lexer.NewLexer(tt.input)).ParseProgram()
+		obj := EvalWithContext(context.Background(), program, object.NewEnvironment(nil), tt.limits)
+		err, ok := obj.(*object.Error)
+		if !ok || !errors.Is(err, tt.expected) {
+			t.Fatalf("test case [%d] expected error [%v], got [%s]", i, tt.expected, obj.Inspect())
+		}
+	}
+
+	// the limits which are not exceeded don't change the result
+	program := parser.NewParser(*lexer.NewLexer(`
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(10)`)).ParseProgram()
+	obj := EvalWithContext(context.Background(), program, object.NewEnvironment(nil),
+		common.Limits{MaxSteps: 100000, MaxCallDepth: 20, MaxAllocations: 10})
+	testIntegerObject(t, 0, obj, 55)
+}
+
+func TestGeneratorRunsUnderTheLimitsOfTheConsumer(t *testing.T) {
+	e := New()
+	env := object.NewEnvironment(nil)
+	evalWithLimits := func(input string, limits common.Limits) object.Object {
+		program := parser.NewParser(*lexer.NewLexer(input)).ParseProgram()
+		return e.EvalWithContext(context.Background(), program, env, limits)
+	}
+
+	// the generator is created by an evaluation with a tight budget, and drained by one with a larger budget
+	evalWithLimits(`let count = fn(n) { if (n > 0) { yield n; yield ...count(n - 1) } }; let it = count(1000)`,
+		common.Limits{MaxSteps: 100})
+	testIntegerObject(t, 0, evalWithLimits("len([x for x in it])", common.Limits{MaxSteps: 100000}), 1000)
+
+	// and the other way around
+	evalWithLimits("let it = count(1000)", common.Limits{})
+	obj := evalWithLimits("len([x for x in it])", common.Limits{MaxSteps: 1000})
+	if err, ok := obj.(*object.Error); !ok || !errors.Is(err, common.ErrStepLimitExceeded) {
+		t.Fatalf("expected a step limit error, got [%s]", obj.Inspect())
+	}
+	evalWithLimits("let it = count(1000)", common.Limits{})
+	obj = evalWithLimits("next(it); next(it)", common.Limits{MaxSteps: 10})
+	if err, ok := obj.(*object.Error); !ok || !errors.Is(err, common.ErrStepLimitExceeded) {
+		t.Fatalf("expected a step limit error, got [%s]", obj.Inspect())
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	program := parser.NewParser(*lexer.NewLexer("let loop = fn() { loop() }; loop()")).ParseProgram()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	obj := EvalWithContext(ctx, program, object.NewEnvironment(nil), common.Limits{})
+	err, ok := obj.(*object.Error)
+	if !ok || !errors.Is(err, common.ErrCancelled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a cancelled error, got [%s]", obj.Inspect())
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	obj = EvalWithContext(ctx, program, object.NewEnvironment(nil), common.Limits{})
+	if err, ok := obj.(*object.Error); !ok || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a cancelled error, got [%s]", obj.Inspect())
+	}
+}
+
+func TestUserDefinedInfixOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"infix 45 <+> (a, b) => a * 10 + b\n1 <+> 2", 12},
+		{"infix 45 <+> (a, b) => a * 10 + b\n1 <+> 2 <+> 3", 123},
+		{"infixr 45 <+> (a, b) => a * 10 + b\n1 <+> 2 <+> 3", 33},
+		{"infix 45 <+> (a, b) => a * 10 + b\n1 + 2 <+> 3 * 2", 27},
+		{"infix 15 |> (x, f) => f(x)\nlet double = fn(x) { x * 2 }\n3 |> double |> double", 12},
+		{"let n = 100\ninfix 45 %% (a, b) => a + b + n\nlet f = fn(x) { x %% 1 }\nf(1)", 102},
+	}
+
+	for i, tt := range tests {
+		testIntegerObject(t, i, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestFibonacci(t *testing.T) {
 	input := `
 let fibonacci = fn(x) {
@@ -685,3 +1416,94 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func TestResolvedBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// a let statement which is not evaluated leaves its slot unset, the name falls back to the global
+		{"let x = 1; let f = fn(c) { if (c) { let x = 2; }; x }; f(false) * 10 + f(true)", 12},
+		// a binding used before its let statement refers to it once it's set
+		{"let x = 1; let f = fn() { let g = fn() { x }; let a = g(); let x = 2; a * 10 + g() }; f()", 12},
+		{"let f = fn() { let x = 0; fn() { let g = fn() { x }; let x = 1; g() }() }; f()", 1},
+		{"let f = fn() { let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; if (even(10)) { 1 } else { 0 } }; f()", 1},
+		// the closures capture the frames of their calls and iterations
+		{"let adder = fn(a) { fn(b) { a + b } }; let addTwo = adder(2); let addThree = adder(3); addTwo(1) * 10 + addThree(1)", 34},
+		{"let fs = [fn() { x * y } for [x, y] in [[1, 2], [3, 4]]]; fs[0]() * 100 + fs[1]()", 212},
+		{"let f = fn(x) { [x + y for y in [x, x * 2] if y > 1] }; let a = f(2); a[0] * 10 + a[1]", 46},
+		{"let f = fn(x) { let s = [if (y > 1) { let z = y * x; z } else { 0 } for y in [1, 2]]; s[1] }; f(3)", 6},
+		{"let f = fn(a, a) { a }; f(1, 2)", 2},
+		{"let x = 5; let f = fn() { let x = x + 1; x }; f() * 10 + x", 65},
+	}
+
+	for i, tt := range tests {
+		testIntegerObject(t, i, testEval(tt.input), tt.expected)
+	}
+
+	err, ok := testEval("let f = fn(c) { if (c) { let y = 1; }; y }; f(false)").(*object.Error)
+	if !ok || err.Message != "identifier not found: y" {
+		t.Fatalf("expected identifier not found, got [%v]", err)
+	}
+}
+
+func TestEvalDoesNotResolveTheProgram(t *testing.T) {
+	// let f = fn(x) { x }; f(1), built without the parser so that it's not resolved
+	x := &ast.Identifier{Value: "x"}
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.LetStatement{Name: &ast.Identifier{Value: "f"}, Value: &ast.FnLiteral{
+			Parameters: []*ast.Identifier{{Value: "x"}},
+			Body:       &ast.BlockStatement{Statements: []ast.Statement{&ast.ExpressionStatement{Expr: x}}},
+		}},
+		&ast.ExpressionStatement{Expr: &ast.CallExpression{
+			Fn:        &ast.Identifier{Value: "f"},
+			Arguments: []ast.Expression{&ast.IntegerLiteral{Value: 1}},
+		}},
+	}}
+
+	obj := EvalWithContext(context.Background(), program, object.NewEnvironment(nil), common.Limits{})
+	testIntegerObject(t, 0, obj, 1)
+	if _, _, ok := x.Binding(); ok {
+		t.Fatalf("expected the program of the caller to be left unresolved")
+	}
+}
+
+func TestConcurrentEvaluationsOfOneProgram(t *testing.T) {
+	program, err := parser.Parse("let f = fn(n) { let g = fn(m) { n + m }; [g(x) for x in [1, 2]] }; f(10)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan object.Object)
+	for i := 0; i < 8; i++ {
+		go func() {
+			results <- EvalWithContext(context.Background(), program, object.NewEnvironment(nil), common.Limits{})
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if obj := <-results; obj.Inspect() != "[11, 12]" {
+			t.Fatalf("expected [11, 12], got [%s]", obj.Inspect())
+		}
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	program := parser.NewParser(*lexer.NewLexer(`
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(30)`)).ParseProgram()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment(nil))
+	}
+}
+
+// BenchmarkPush pushing n elements one by one is linear now that the arrays are persistent
+func BenchmarkPush(b *testing.B) {
+	program := parser.NewParser(*lexer.NewLexer(`
+let build = fn(a, n) { if (n == 0) { a } else { build(push(a, n), n - 1) } };
+len(build([], 10000))`)).ParseProgram()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Eval(program, object.NewEnvironment(nil))
+	}
+}
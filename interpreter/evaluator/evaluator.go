@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"0x822a5b87/monkey/interpreter/ast"
+	"0x822a5b87/monkey/interpreter/common"
+	"0x822a5b87/monkey/interpreter/object"
+	"context"
+)
+
+// DefaultMaxCallDepth the max depth of the call stack when the limits don't set one,
+// it's far below the depth which exhausts the Go stack
+const DefaultMaxCallDepth = 10000
+
+// Evaluator a tree-walking evaluator, it keeps the call stack of the functions being evaluated
+// so that an error can tell which calls produced it, see object.Error.Traceback
+type Evaluator struct {
+	stack []object.Frame
+	// budget the budget of the evaluation in progress
+	budget *common.Budget
+	// generator the generator whose body is evaluated, it's nil unless the evaluator runs the body of a generator
+	generator *generator
+}
+
+func New() *Evaluator {
+	return &Evaluator{}
+}
+
+// Eval evaluate the node with a new Evaluator
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// EvalWithContext evaluate the node with a new Evaluator, see Evaluator.EvalWithContext
+func EvalWithContext(ctx context.Context, node ast.Node, env *object.Environment, limits common.Limits) object.Object {
+	return New().EvalWithContext(ctx, node, env, limits)
+}
+
+// EvalWithContext evaluate the node until it completes, exceeds one of the limits or the context is done.
+// An aborted evaluation returns an *object.Error wrapping one of the errors common.ErrStepLimitExceeded,
+// common.ErrCallDepthExceeded, common.ErrAllocationLimitExceeded and common.ErrCancelled, which can be told apart
+// with errors.Is.
+func (e *Evaluator) EvalWithContext(ctx context.Context, node ast.Node, env *object.Environment, limits common.Limits) object.Object {
+	e.budget = common.NewBudget(ctx, limits)
+	defer func() {
+		e.budget = nil
+	}()
+	if err := e.budget.Check(); err != nil {
+		return e.budgetError(err)
+	}
+	return e.Eval(node, env)
+}
+
+// CallWithContext call the function with the arguments like EvalWithContext, the function is an *object.Fn or
+// an *object.BuiltIn, and the name is the name of its frame in the call stack
+func (e *Evaluator) CallWithContext(ctx context.Context, name string, fn object.Object, args []object.Object, limits common.Limits) object.Object {
+	e.budget = common.NewBudget(ctx, limits)
+	defer func() {
+		e.budget = nil
+	}()
+	if err := e.budget.Check(); err != nil {
+		return e.budgetError(err)
+	}
+
+	frame := object.Frame{Function: name}
+	switch fn := fn.(type) {
+	case *object.Fn:
+		return e.evalFn(fn, args, frame)
+	case *object.BuiltIn:
+		return e.callBuiltIn(fn, args, frame)
+	default:
+		return newError("%s from %s to %s", typeMismatchErrStr, fn.Type(), object.ObjFunction)
+	}
+}
+
+// pushFrame push the frame of a call, it fails if the call stack is already as deep as the limits allow
+func (e *Evaluator) pushFrame(frame object.Frame) *object.Error {
+	if maxDepth := e.budget.MaxCallDepth(DefaultMaxCallDepth); len(e.stack) >= maxDepth {
+		return e.budgetError(common.NewErrCallDepthExceeded(maxDepth))
+	}
+	e.stack = append(e.stack, frame)
+	return nil
+}
+
+func (e *Evaluator) popFrame() {
+	e.stack = e.stack[:len(e.stack)-1]
+}
+
+// callStack a copy of the call stack
+func (e *Evaluator) callStack() []object.Frame {
+	return append([]object.Frame(nil), e.stack...)
+}
+
+// attachStack attach the call stack to the error produced by the innermost call,
+// the outer calls which the error propagates through keep it
+func (e *Evaluator) attachStack(obj object.Object) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Stack == nil {
+		err.Stack = e.callStack()
+	}
+	return obj
+}
+
+// allocate charge the budget for the elements of the new object, see common.SizeOf
+func (e *Evaluator) allocate(obj object.Object) object.Object {
+	if err := e.budget.Allocate(common.SizeOf(obj)); err != nil {
+		return e.budgetError(err)
+	}
+	return obj
+}
+
+// budgetError the error of an evaluation aborted by its budget, with the call stack where it's aborted
+func (e *Evaluator) budgetError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Stack: e.callStack(), Err: err}
+}
+
+// newFrame the frame of the call, which is named by the callee expression
+func newFrame(call *ast.CallExpression) object.Frame {
+	return object.Frame{Function: call.Fn.String(), Line: call.Token.Line, Column: call.Token.Column}
+}
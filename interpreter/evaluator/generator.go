@@ -0,0 +1,143 @@
+package evaluator
+
+import (
+	"0x822a5b87/monkey/interpreter/ast"
+	"0x822a5b87/monkey/interpreter/common"
+	"0x822a5b87/monkey/interpreter/object"
+	"runtime"
+)
+
+// generator the body of a call of a generator function, it runs on a goroutine of its own which takes turns with
+// the consumer of the iterator: the body runs from a resume until its next yield while the consumer waits for the
+// element, so only one of them is running at any time, and the body runs under the budget of the consumer.
+type generator struct {
+	// resume let the body run until its next yield, it's closed if the iterator is abandoned before the end
+	resume chan struct{}
+	// elements the yielded elements, it's closed once the body is done
+	elements chan object.Object
+	// tail the iterator the body hands over to at its end, see ast.YieldStatement.Tail
+	tail *object.Iterator
+	// running the body is running, the consumer waiting for its element, so the body asking for the next element
+	// of its own iterator must fail instead of waiting for itself
+	running bool
+}
+
+// consumer the state of the iterator of a generator, which is only reachable from the iterator, so that it's
+// finalized along with an abandoned iterator, and its finalizer stops the body suspended by a yield
+type consumer struct {
+	g       *generator
+	started bool
+	done    bool
+}
+
+// errGeneratorAbandoned unwind the body of a generator whose iterator is abandoned, it's never seen by the program
+var errGeneratorAbandoned = &object.Error{Message: "generator abandoned"}
+
+// newGenerator an iterator over the values yielded by the body of the generator function, the body starts
+// running when the first element is asked for, in the environment of the call.
+// The call stack of the body starts with the frame of the call, which is the innermost one of the stack, the
+// frames of its callers are left out since the body outlives them, and a generator creating another one, like
+// a recursive one, would otherwise pile them up.
+func (e *Evaluator) newGenerator(fn *object.Fn, env *object.Environment) *object.Iterator {
+	g := &generator{resume: make(chan struct{}), elements: make(chan object.Object)}
+	stack := append([]object.Frame(nil), e.stack[len(e.stack)-1:]...)
+	body := &Evaluator{stack: stack, budget: e.budget, generator: g}
+	c := &consumer{g: g}
+
+	var iterator *object.Iterator
+	iterator = object.NewLazyIterator(func(budget object.Budget) (object.Object, bool) {
+		if c.done {
+			return nil, false
+		}
+		if c.g.running {
+			return &object.Error{Message: common.ErrGeneratorRunning.Error(), Err: common.ErrGeneratorRunning}, true
+		}
+		if !c.started {
+			c.started = true
+			go body.runGenerator(fn.Body, env)
+			runtime.SetFinalizer(c, func(c *consumer) {
+				close(c.g.resume)
+			})
+		}
+
+		// the body is suspended until the resume, so it's safe to hand it the budget of the consumer
+		if budget, ok := budget.(*common.Budget); ok {
+			body.budget = budget
+		}
+		c.g.running = true
+		c.g.resume <- struct{}{}
+		element, ok := <-c.g.elements
+		c.g.running = false
+		if !ok {
+			c.done = true
+			if c.g.tail != nil {
+				iterator.Delegate(c.g.tail)
+			}
+			return nil, false
+		}
+		// an error is the last element, the body is done after it
+		_, c.done = element.(*object.Error)
+		return element, true
+	})
+	return iterator
+}
+
+// runGenerator evaluate the body of the generator once it's resumed the first time, the error which stops it is
+// sent as the last element
+func (e *Evaluator) runGenerator(body *ast.BlockStatement, env *object.Environment) {
+	g := e.generator
+	defer close(g.elements)
+	if _, ok := <-g.resume; !ok {
+		return
+	}
+	result := e.Eval(body, env)
+	if err, ok := result.(*object.Error); ok && err != errGeneratorAbandoned {
+		g.elements <- e.attachStack(err)
+	}
+}
+
+// yield hand the element over to the consumer, and wait until the next element is asked for
+func (g *generator) yield(element object.Object) *object.Error {
+	g.elements <- element
+	if _, ok := <-g.resume; !ok {
+		return errGeneratorAbandoned
+	}
+	return nil
+}
+
+// evalYieldStatement yield the value, or every element of the iterable of a spread, a spread in tail position
+// hands the iterator of the generator over to the iterable and ends the body instead
+func (e *Evaluator) evalYieldStatement(yield *ast.YieldStatement, env *object.Environment) object.Object {
+	if e.generator == nil {
+		return newError("%s", yieldOutsideGeneratorErrStr)
+	}
+	value := e.Eval(yield.Value, env)
+	if value.Type() == object.ObjError {
+		return value
+	}
+	if !yield.Spread {
+		if err := e.generator.yield(value); err != nil {
+			return err
+		}
+		return object.NativeNull
+	}
+
+	iterable, ok := value.(object.Iterable)
+	if !ok {
+		return newError("%s %s", notIterableErrStr, value.Type())
+	}
+	iterator := iterable.Iterator()
+	if yield.Tail {
+		e.generator.tail = iterator
+		return &object.Return{Object: object.NativeNull}
+	}
+	for element, ok := iterator.Next(e.budget); ok; element, ok = iterator.Next(e.budget) {
+		if element.Type() == object.ObjError {
+			return element
+		}
+		if err := e.generator.yield(element); err != nil {
+			return err
+		}
+	}
+	return object.NativeNull
+}
@@ -4,20 +4,69 @@ import (
 	"0x822a5b87/monkey/interpreter/object"
 	"0x822a5b87/monkey/interpreter/token"
 	"bytes"
+	"errors"
 	"fmt"
-	"reflect"
 )
 
 const (
-	typeMismatchErrStr         = "type mismatch:"
-	unknownOperatorErrStr      = "unknown operator:"
-	identifierNotFoundErrStr   = "identifier not found:"
-	paramsNumberMismatchErrStr = "number of parameters mismatch:"
-	hashableNotImplementError  = "hashable not implement:"
+	typeMismatchErrStr          = "type mismatch:"
+	unknownOperatorErrStr       = "unknown operator:"
+	identifierNotFoundErrStr    = "identifier not found:"
+	paramsNumberMismatchErrStr  = "number of parameters mismatch:"
+	hashableNotImplementError   = "hashable not implement:"
+	cannotSpreadErrStr          = "cannot spread:"
+	notIterableErrStr           = "not iterable:"
+	cannotDestructureErrStr     = "cannot destructure:"
+	notFunctionErrStr           = "not a function:"
+	yieldOutsideGeneratorErrStr = "yield outside of a generator"
 )
 
-var infixOperatorTypes map[string]any
-var prefixOperatorTypes map[string]any
+// objTailCall the type of tailCall, which never escapes from evalFn
+const objTailCall object.ObjType = "TAIL_CALL"
+
+// operandCheck tells if an object implements the operation of an operator, see the interfaces in object/fn.go
+type operandCheck func(object.Object) bool
+
+var infixOperatorTypes map[string]operandCheck
+var prefixOperatorTypes map[string]operandCheck
+
+// operatorMethods the names of the methods overloading the infix operators, != is the negation of __eq__
+var operatorMethods = map[string]string{
+	string(token.PLUS):     "__add__",
+	string(token.SUB):      "__sub__",
+	string(token.ASTERISK): "__mul__",
+	string(token.SLASH):    "__div__",
+	string(token.GT):       "__gt__",
+	string(token.LT):       "__lt__",
+	string(token.EQ):       "__eq__",
+	string(token.NotEq):    "__eq__",
+}
+
+// implements the operandCheck of the interface T
+func implements[T any](o object.Object) bool {
+	_, ok := o.(T)
+	return ok
+}
+
+// OperatorMethod the method overloading the infix operator for the operands, a user-defined value is a hash
+// with the method under its name, like {"__add__": fn(a, b) { ... }}. The method of the lhs is preferred over
+// the method of the rhs, and either way it is called with the operands in their order.
+func OperatorMethod(operator string, lhs, rhs object.Object) (object.Object, bool) {
+	name, ok := operatorMethods[operator]
+	if !ok || lhs.Type() == object.ObjError || rhs.Type() == object.ObjError {
+		return nil, false
+	}
+	for _, operand := range []object.Object{lhs, rhs} {
+		hash, isHash := operand.(*object.Hash)
+		if !isHash {
+			continue
+		}
+		if pair, found := hash.Get(&object.StringObj{Value: name}); found {
+			return pair.Value, true
+		}
+	}
+	return nil, false
+}
 
 func InfixExpressionTypeCheck(operator string, lhs, rhs object.Object) *object.Error {
 
@@ -29,7 +78,20 @@ func InfixExpressionTypeCheck(operator string, lhs, rhs object.Object) *object.E
 		return rhs.(*object.Error)
 	}
 
-	interfaceValue, ok := infixOperatorTypes[operator]
+	// every object is equatable, by identity if not by its value, and the objects of different types are not equal
+	if operator == string(token.EQ) || operator == string(token.NotEq) {
+		return nil
+	}
+
+	// the operands of in are an element and a collection, so they are of different types
+	if operator == token.InOperator {
+		if !implements[object.Container](rhs) {
+			return newInfixUnknownOperatorError(operator, lhs, rhs)
+		}
+		return nil
+	}
+
+	check, ok := infixOperatorTypes[operator]
 	if !ok {
 		return &object.Error{Message: fmt.Sprintf("unknown operator %s", operator)}
 	}
@@ -39,7 +101,7 @@ func InfixExpressionTypeCheck(operator string, lhs, rhs object.Object) *object.E
 		return typeMismatchErr
 	}
 
-	unknownOperatorErr := check4UnknownOperator(operator, interfaceValue, lhs, rhs)
+	unknownOperatorErr := check4UnknownOperator(operator, check, lhs, rhs)
 	if unknownOperatorErr != nil {
 		return unknownOperatorErr
 	}
@@ -51,13 +113,12 @@ func PrefixExpressionTypeCheck(operator string, operand object.Object) *object.E
 		return operand.(*object.Error)
 	}
 
-	typeMismatchErr := checkForTypeMismatchOperator(operator, operand)
-	if typeMismatchErr != nil {
-		return typeMismatchErr
+	// ! applies to any object
+	check, ok := prefixOperatorTypes[operator]
+	if !ok {
+		return nil
 	}
-
-	interfaceValue := prefixOperatorTypes[operator]
-	unknownOperatorErr := check4UnknownOperator(operator, interfaceValue, operand)
+	unknownOperatorErr := check4UnknownOperator(operator, check, operand)
 	if unknownOperatorErr != nil {
 		return unknownOperatorErr
 	}
@@ -68,10 +129,10 @@ func checkForTypeMismatchOperator(operator string, objects ...object.Object) *ob
 	if len(objects) == 0 {
 		return nil
 	}
-	basicType := reflect.TypeOf(objects[0])
+	// compared by the types of the objects rather than their Go types, an Integer and a BigInteger are both INTEGER
+	basicType := objects[0].Type()
 	for _, o := range objects {
-		curType := reflect.TypeOf(o)
-		if basicType != curType {
+		if o.Type() != basicType {
 			return newTypeMismatchError(operator, objects...)
 		}
 	}
@@ -79,21 +140,32 @@ func checkForTypeMismatchOperator(operator string, objects ...object.Object) *ob
 }
 
 // check4UnknownOperator 检查objects是否都实现了接口
-func check4UnknownOperator(operator string, i any, objects ...object.Object) *object.Error {
-	interfaceType := reflect.TypeOf(i).Elem()
+func check4UnknownOperator(operator string, check operandCheck, objects ...object.Object) *object.Error {
 	for _, o := range objects {
-		objType := reflect.TypeOf(o)
-		if interfaceType.Kind() != reflect.Interface {
-			panic("The first argument must be an interface type")
-		}
-		implements := objType.Implements(interfaceType)
-		if !implements {
+		if !check(o) {
 			return newUnknownOperatorError(operator, objects...)
 		}
 	}
 	return nil
 }
 
+// Compare order lhs and rhs for the operator < or >, a pair which can't be ordered, which may be elements of lhs and
+// rhs, is a type mismatch if their types are different, or an unknown operator otherwise
+func Compare(operator string, lhs, rhs object.Object) (int, *object.Error) {
+	c, err := object.Compare(lhs, rhs)
+	if err == nil {
+		return c, nil
+	}
+	var notComparable *object.NotComparableError
+	if !errors.As(err, &notComparable) {
+		return 0, newError(err.Error())
+	}
+	if notComparable.Lhs.Type() != notComparable.Rhs.Type() {
+		return 0, newTypeMismatchError(operator, notComparable.Lhs, notComparable.Rhs)
+	}
+	return 0, newUnknownOperatorError(operator, notComparable.Lhs, notComparable.Rhs)
+}
+
 func newTypeMismatchError(operator string, objects ...object.Object) *object.Error {
 	buffer := bytes.Buffer{}
 	buffer.WriteString(typeMismatchErrStr)
@@ -136,16 +208,16 @@ func newPrefixUnknownOperatorError(operator string, o object.Object) *object.Err
 }
 
 func init() {
-	infixOperatorTypes = make(map[string]any)
-	infixOperatorTypes[string(token.PLUS)] = (*object.Add)(nil)
-	infixOperatorTypes[string(token.SUB)] = (*object.Subtract)(nil)
-	infixOperatorTypes[string(token.ASTERISK)] = (*object.Multiply)(nil)
-	infixOperatorTypes[string(token.SLASH)] = (*object.Divide)(nil)
-	infixOperatorTypes[string(token.GT)] = (*object.Comparable)(nil)
-	infixOperatorTypes[string(token.LT)] = (*object.Comparable)(nil)
-	infixOperatorTypes[string(token.EQ)] = (*object.Equatable)(nil)
-	infixOperatorTypes[string(token.NotEq)] = (*object.Equatable)(nil)
-
-	prefixOperatorTypes = make(map[string]any)
-	prefixOperatorTypes[string(token.SUB)] = (*object.Negative)(nil)
+	infixOperatorTypes = make(map[string]operandCheck)
+	infixOperatorTypes[string(token.PLUS)] = implements[object.Add]
+	infixOperatorTypes[string(token.SUB)] = implements[object.Subtract]
+	infixOperatorTypes[string(token.ASTERISK)] = implements[object.Multiply]
+	infixOperatorTypes[string(token.SLASH)] = implements[object.Divide]
+	infixOperatorTypes[string(token.GT)] = implements[object.Comparable]
+	infixOperatorTypes[string(token.LT)] = implements[object.Comparable]
+	infixOperatorTypes[string(token.EQ)] = implements[object.Equatable]
+	infixOperatorTypes[string(token.NotEq)] = implements[object.Equatable]
+
+	prefixOperatorTypes = make(map[string]operandCheck)
+	prefixOperatorTypes[string(token.SUB)] = implements[object.Negative]
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"0x822a5b87/monkey/interpreter/format"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const stdinName = "<standard input>"
+
+// formatCommand rewrites the files with the canonical format, or formats the standard input to the standard output
+// if no file is given. With -l or -d, the files are only checked: -l lists the files whose formatting differs,
+// and -d prints the diffs. The exit code is 2 if any file doesn't parse or can't be written.
+func formatCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	list := flags.Bool("l", false, "list files whose formatting differs from the canonical format")
+	showDiff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "usage: monkey fmt [-l] [-d] [file ...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	exitCode := 0
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(stdin)
+		if err == nil {
+			err = formatFile(stdinName, string(source), *list, *showDiff, stdout)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s: %s\n", stdinName, err)
+			exitCode = 2
+		}
+		return exitCode
+	}
+
+	for _, name := range flags.Args() {
+		source, err := os.ReadFile(name)
+		if err == nil {
+			err = formatFile(name, string(source), *list, *showDiff, stdout)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "%s: %s\n", name, err)
+			exitCode = 2
+		}
+	}
+	return exitCode
+}
+
+func formatFile(name, source string, list, showDiff bool, stdout io.Writer) error {
+	formatted, err := format.Source(source)
+	if err != nil {
+		return err
+	}
+
+	if !list && !showDiff {
+		if name == stdinName {
+			_, err = io.WriteString(stdout, formatted)
+			return err
+		}
+		if formatted == source {
+			return nil
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(name, []byte(formatted), info.Mode().Perm())
+	}
+
+	if formatted == source {
+		return nil
+	}
+	if list {
+		if _, err = fmt.Fprintln(stdout, name); err != nil {
+			return err
+		}
+	}
+	if showDiff {
+		_, err = io.WriteString(stdout, diff(name, source, formatted))
+	}
+	return err
+}
+
+// diffContext the number of unchanged lines around the changes of a hunk
+const diffContext = 3
+
+type edit struct {
+	op   byte // ' ', '-' or '+'
+	line string
+	// a and b the 0-based line numbers in the old and the new text before the edit
+	a, b int
+}
+
+// diff a unified diff of the lines of source and formatted, the edits are computed by the longest common subsequence
+// which is good enough for the source files we format
+func diff(name, source, formatted string) string {
+	x, y := splitLines(source), splitLines(formatted)
+
+	// lcs[i][j] the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	edits := make([]edit, 0, len(x)+len(y))
+	for i, j := 0, 0; i < len(x) || j < len(y); {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			edits = append(edits, edit{op: ' ', line: x[i], a: i, b: j})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{op: '-', line: x[i], a: i, b: j})
+			i++
+		default:
+			edits = append(edits, edit{op: '+', line: y[j], a: i, b: j})
+			j++
+		}
+	}
+
+	buffer := strings.Builder{}
+	buffer.WriteString(fmt.Sprintf("--- %s.orig\n+++ %s\n", name, name))
+	for start := 0; start < len(edits); {
+		for start < len(edits) && edits[start].op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+
+		// the changes separated by no more than 2*diffContext unchanged lines are in the same hunk
+		last := start
+		for k := start; k < len(edits) && k-last <= 2*diffContext+1; k++ {
+			if edits[k].op != ' ' {
+				last = k
+			}
+		}
+		from, to := max(start-diffContext, 0), min(last+diffContext+1, len(edits))
+
+		oldCount, newCount := 0, 0
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		buffer.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(edits[from].a, oldCount), hunkRange(edits[from].b, newCount)))
+		for _, e := range edits[from:to] {
+			buffer.WriteByte(e.op)
+			buffer.WriteString(e.line)
+			buffer.WriteByte('\n')
+		}
+		start = to
+	}
+	return buffer.String()
+}
+
+// hunkRange the range of a hunk starting at the 0-based line, an empty range starts at the line before it
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+	return fmt.Sprintf("%d,%d", line+1, count)
+}
+
+// splitLines split the text into lines, a last line without a line break is marked like diff does,
+// so that it differs from the same line with a line break
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if !strings.HasSuffix(s, "\n") {
+		lines[len(lines)-1] += "\n\\ No newline at end of file"
+	}
+	return lines
+}
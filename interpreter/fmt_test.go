@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatFile(t *testing.T) {
+	testCases := []struct {
+		source   string
+		list     bool
+		showDiff bool
+		// expectedOutput the output, in which {name} is replaced by the name of the file
+		expectedOutput string
+		expectedSource string
+	}{
+		{"let a=1", false, false, "", "let a = 1\n"},
+		{"let a = 1\n", false, false, "", "let a = 1\n"},
+		{"let a=1", true, false, "{name}\n", "let a=1"},
+		{"let a = 1\n", true, false, "", "let a = 1\n"},
+		{
+			"let a=1\nlet b = 2\n", false, true,
+			"--- {name}.orig\n+++ {name}\n@@ -1,2 +1,2 @@\n-let a=1\n+let a = 1\n let b = 2\n",
+			"let a=1\nlet b = 2\n",
+		},
+		{
+			"let a=1\n", true, true,
+			"{name}\n--- {name}.orig\n+++ {name}\n@@ -1,1 +1,1 @@\n-let a=1\n+let a = 1\n",
+			"let a=1\n",
+		},
+		{"let a = 1\n", true, true, "", "let a = 1\n"},
+	}
+
+	for i, testCase := range testCases {
+		name := filepath.Join(t.TempDir(), "test.monkey")
+		if err := os.WriteFile(name, []byte(testCase.source), 0o640); err != nil {
+			t.Fatal(err)
+		}
+
+		stdout := bytes.Buffer{}
+		if err := formatFile(name, testCase.source, testCase.list, testCase.showDiff, &stdout); err != nil {
+			t.Fatalf("test case [%d] error: %s", i, err)
+		}
+		expectedOutput := strings.ReplaceAll(testCase.expectedOutput, "{name}", name)
+		if stdout.String() != expectedOutput {
+			t.Fatalf("test case [%d] expected output:\n%s\nactual:\n%s", i, expectedOutput, stdout.String())
+		}
+
+		source, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(source) != testCase.expectedSource {
+			t.Fatalf("test case [%d] expected source:\n%s\nactual:\n%s", i, testCase.expectedSource, source)
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o640 {
+			t.Fatalf("test case [%d] expected the permissions [%o], got [%o]", i, 0o640, info.Mode().Perm())
+		}
+	}
+}
+
+func TestFormatStandardInput(t *testing.T) {
+	stdout := bytes.Buffer{}
+	if err := formatFile(stdinName, "let a=1", false, false, &stdout); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "let a = 1\n" {
+		t.Fatalf("expected the formatted source, got:\n%s", stdout.String())
+	}
+}
+
+func TestFormatCommand(t *testing.T) {
+	dir := t.TempDir()
+	valid, invalid := filepath.Join(dir, "valid.monkey"), filepath.Join(dir, "invalid.monkey")
+	if err := os.WriteFile(valid, []byte("let a=1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(invalid, []byte("let a ="), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	exitCode := formatCommand([]string{"-l", invalid, valid, filepath.Join(dir, "missing.monkey")}, nil, &stdout, &stderr)
+	if exitCode != 2 {
+		t.Fatalf("expected the exit code [2], got [%d]", exitCode)
+	}
+	if stdout.String() != valid+"\n" {
+		t.Fatalf("expected the valid file to be listed, got:\n%s", stdout.String())
+	}
+	if lines := strings.Split(strings.TrimSuffix(stderr.String(), "\n"), "\n"); len(lines) != 2 ||
+		!strings.HasPrefix(lines[0], invalid+": ") || !strings.HasPrefix(lines[1], filepath.Join(dir, "missing.monkey")+": ") {
+		t.Fatalf("expected an error for the invalid and the missing files, got:\n%s", stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if exitCode = formatCommand(nil, strings.NewReader("let b=2"), &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("expected the exit code [0], got [%d]: %s", exitCode, stderr.String())
+	}
+	if stdout.String() != "let b = 2\n" {
+		t.Fatalf("expected the formatted standard input, got:\n%s", stdout.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	testCases := []struct {
+		source    string
+		formatted string
+		expected  string
+	}{
+		{"a\nb\nc\n", "a\nB\nc\n", "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"a\n", "a\nb\n", "@@ -1,1 +1,2 @@\n a\n+b\n"},
+		{"a\n\n", "a\n", "@@ -1,2 +1,1 @@\n a\n-\n"},
+		{"", "a\n", "@@ -0,0 +1,1 @@\n+a\n"},
+		{"\n", "", "@@ -1,1 +0,0 @@\n-\n"},
+		{"a", "a\n", "@@ -1,1 +1,1 @@\n-a\n\\ No newline at end of file\n+a\n"},
+		{
+			// the changes separated by 6 unchanged lines are in one hunk
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\neleven\n12\n",
+			"@@ -1,12 +1,12 @@\n 1\n 2\n 3\n-4\n+four\n 5\n 6\n 7\n 8\n 9\n 10\n-11\n+eleven\n 12\n",
+		},
+		{
+			// the changes separated by 7 unchanged lines are in two hunks
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n",
+			"1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n11\ntwelve\n13\n",
+			"@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-4\n+four\n 5\n 6\n 7\n" +
+				"@@ -9,5 +9,5 @@\n 9\n 10\n 11\n-12\n+twelve\n 13\n",
+		},
+	}
+
+	for i, testCase := range testCases {
+		expected := "--- a.monkey.orig\n+++ a.monkey\n" + testCase.expected
+		if actual := diff("a.monkey", testCase.source, testCase.formatted); actual != expected {
+			t.Fatalf("test case [%d] expected:\n%s\nactual:\n%s", i, expected, actual)
+		}
+	}
+}
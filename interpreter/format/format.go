@@ -0,0 +1,484 @@
+// Package format prints a program as canonical monkey source code, like gofmt does for go.
+//
+// The output only depends on the program and its comments: the expressions are printed with the minimal
+// parentheses, the statements are terminated by line breaks instead of semicolons, a list which doesn't fit
+// in MaxWidth or has comments between its elements is broken into one element per line, and at most one empty line is kept between statements.
+// A block is kept on a single line only if it is written on a single line and contains a single expression,
+// so that formatting the output again produces the same output.
+package format
+
+import (
+	"0x822a5b87/monkey/interpreter/ast"
+	"0x822a5b87/monkey/interpreter/parser"
+	"0x822a5b87/monkey/interpreter/token"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxWidth the width beyond which a list is broken into lines
+	MaxWidth = 80
+	// Indent the indentation of a nested block or a broken list
+	Indent = "  "
+)
+
+// builtInPrecedences the precedences of the built-in infix operators, they mirror the precedences table of the parser
+var builtInPrecedences = map[string]parser.Precedence{
+	string(token.NullCoalescing): parser.NullCoalescingPrecedence,
+	string(token.EQ):             parser.EqualsPrecedence,
+	string(token.NotEq):          parser.EqualsPrecedence,
+	string(token.LT):             parser.LessGreaterPrecedence,
+	string(token.GT):             parser.LessGreaterPrecedence,
+	token.InOperator:             parser.LessGreaterPrecedence,
+	string(token.PLUS):           parser.SumPrecedence,
+	string(token.SUB):            parser.SumPrecedence,
+	string(token.ASTERISK):       parser.ProductPrecedence,
+	string(token.SLASH):          parser.ProductPrecedence,
+}
+
+// Source format the source code, it fails only if the source code doesn't parse
+func Source(sourceCode string) (string, error) {
+	program, err := parser.Parse(sourceCode)
+	if err != nil {
+		return "", err
+	}
+	return Program(program), nil
+}
+
+// Program print the program and its comments as canonical source code
+func Program(program *ast.Program) string {
+	p := &printer{
+		comments:         program.Comments,
+		precedences:      make(map[string]parser.Precedence),
+		rightAssociative: make(map[string]bool),
+	}
+	for operator, precedence := range builtInPrecedences {
+		p.precedences[operator] = precedence
+	}
+
+	lines := p.statements(program.Statements, nil, 0)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+type printer struct {
+	comments []*ast.Comment
+	// next the index of the first comment which is not printed yet
+	next int
+
+	// precedences the precedence of every infix operator, the user-defined ones are added by their declarations
+	precedences      map[string]parser.Precedence
+	rightAssociative map[string]bool
+
+	// flat the lists are printed on a single line while trying to fit the enclosing list in a single line
+	flat bool
+}
+
+// statements print the statements of a program or a block, and the comments before end,
+// every element of the result is a statement or a comment indented by the level, or an empty line
+func (p *printer) statements(statements []ast.Statement, end *token.Token, level int) []string {
+	lines := make([]string, 0)
+	for _, stmt := range statements {
+		start := statementToken(stmt)
+		lines = p.flushComments(lines, &start, level)
+		if start.BlankLine && len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, indent(level)+p.statement(stmt, level, width(indent(level))))
+	}
+	return p.flushComments(lines, end, level)
+}
+
+// flushComments append the comments before the token, or all the comments if the token is nil.
+// A comment following some code on the same line stays at the end of the line.
+func (p *printer) flushComments(lines []string, before *token.Token, level int) []string {
+	for ; p.next < len(p.comments); p.next++ {
+		comment := p.comments[p.next].Token
+		if before != nil && !isBefore(comment, *before) {
+			break
+		}
+		last := len(lines) - 1
+		if !comment.NewLine && last >= 0 && lines[last] != "" {
+			lines[last] += " " + comment.Literal
+			continue
+		}
+		if comment.BlankLine && last >= 0 && lines[last] != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, indent(level)+comment.Literal)
+	}
+	return lines
+}
+
+// hasCommentsBefore reports whether there is any comment left before the token
+func (p *printer) hasCommentsBefore(tok token.Token) bool {
+	return p.next < len(p.comments) && isBefore(p.comments[p.next].Token, tok)
+}
+
+// statement print the statement starting at column col, the following lines are indented by the level
+func (p *printer) statement(stmt ast.Statement, level, col int) string {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		prefix := stmt.Name.Value + " = "
+		// `x = 1` is parsed as a let statement whose token is the identifier
+		if stmt.Token.Type == token.LET {
+			prefix = "let " + prefix
+		}
+		return prefix + p.expression(stmt.Value, level, col+width(prefix))
+	case *ast.ReturnStatement:
+		return "return " + p.expression(stmt.ReturnValue, level, col+width("return "))
+	case *ast.YieldStatement:
+		prefix := "yield "
+		if stmt.Spread {
+			prefix += "..."
+		}
+		return prefix + p.expression(stmt.Value, level, col+width(prefix))
+	case *ast.ExpressionStatement:
+		return p.expression(stmt.Expr, level, col)
+	case *ast.InfixDeclaration:
+		p.precedences[stmt.Operator] = parser.Precedence(stmt.Precedence)
+		p.rightAssociative[stmt.Operator] = stmt.RightAssociative
+		prefix := fmt.Sprintf("%s %d %s (%s, %s) => ",
+			stmt.Token.Literal, stmt.Precedence, stmt.Operator, stmt.Params[0].Value, stmt.Params[1].Value)
+		return prefix + p.expression(stmt.Body, level, col+width(prefix))
+	default:
+		return stmt.String()
+	}
+}
+
+// expression print the expression starting at column col, the following lines are indented by the level
+func (p *printer) expression(expr ast.Expression, level, col int) string {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.Value
+	case *ast.IntegerLiteral:
+		return strconv.FormatInt(expr.Value, 10)
+	case *ast.BigIntegerLiteral:
+		return expr.Value.String()
+	case *ast.BooleanExpression:
+		return strconv.FormatBool(expr.Value)
+	case *ast.NullLiteral:
+		return "null"
+	case *ast.StringLiteral:
+		return quote(expr.Literal)
+	case *ast.PrefixExpression:
+		parens := false
+		switch right := expr.Right.(type) {
+		case *ast.InfixExpression:
+			parens = true
+		case *ast.PrefixExpression:
+			// --x must not be read as a user-defined operator --
+			_, parens = p.precedences[expr.Operator+right.Operator]
+		}
+		return expr.Operator + p.operand(expr.Right, parens, level, col+width(expr.Operator))
+	case *ast.InfixExpression:
+		return p.infix(expr, level, col)
+	case *ast.SpreadExpression:
+		return "..." + p.expression(expr.Value, level, col+width("..."))
+	case *ast.CallExpression:
+		fn := p.operand(expr.Fn, needsParens(expr.Fn), level, col)
+		return fn + p.list("(", ")", expressionTokens(expr.Arguments), expr.End, func(i, level, col int) string {
+			return p.expression(expr.Arguments[i], level, col)
+		}, level, end(col, fn))
+	case *ast.IndexExpression:
+		lhs := p.operand(expr.Lhs, needsParens(expr.Lhs), level, col)
+		if expr.Token.Type == token.OptionalChaining {
+			return lhs + "?." + expr.Index.(*ast.StringLiteral).Literal
+		}
+		open := "["
+		if expr.Optional {
+			open = "?["
+		}
+		return lhs + open + p.expression(expr.Index, level, end(col, lhs)+width(open)) + "]"
+	case *ast.ArrayLiteral:
+		return p.list("[", "]", expressionTokens(expr.Elements), expr.End, func(i, level, col int) string {
+			return p.expression(expr.Elements[i], level, col)
+		}, level, col)
+	case *ast.SetLiteral:
+		return p.list("#{", "}", expressionTokens(expr.Elements), expr.End, func(i, level, col int) string {
+			return p.expression(expr.Elements[i], level, col)
+		}, level, col)
+	case *ast.HashExpression:
+		return p.list("{", "}", pairTokens(expr.Pairs), expr.End, func(i, level, col int) string {
+			pair := expr.Pairs[i]
+			if pair.Spread != nil {
+				return p.expression(pair.Spread, level, col)
+			}
+			key := p.expression(pair.Key, level, col) + ": "
+			return key + p.expression(pair.Value, level, end(col, key))
+		}, level, col)
+	case *ast.ArrayComprehension:
+		element := "[" + p.expression(expr.Element, level, col+1)
+		return element + p.clause(expr.Clause, level, end(col, element)) + "]"
+	case *ast.HashComprehension:
+		key := "{" + p.expression(expr.Key, level, col+1) + ": "
+		value := key + p.expression(expr.Value, level, end(col, key))
+		return value + p.clause(expr.Clause, level, end(col, value)) + "}"
+	case *ast.IfExpression:
+		condition := "if (" + p.expression(expr.Condition, level, col+width("if (")) + ") "
+		consequence := condition + p.block(expr.Consequence, level, end(col, condition))
+		if expr.Alternative == nil {
+			return consequence
+		}
+		alternative := consequence + " else "
+		return alternative + p.block(expr.Alternative, level, end(col, alternative))
+	case *ast.FnLiteral:
+		params := make([]string, 0, len(expr.Parameters))
+		for _, param := range expr.Parameters {
+			params = append(params, param.Value)
+		}
+		signature := "fn(" + strings.Join(params, ", ") + ") "
+		return signature + p.block(expr.Body, level, end(col, signature))
+	default:
+		return expr.String()
+	}
+}
+
+// infix print the operands with the minimal parentheses, which depend on how the parser absorbs the operators:
+// the rhs of an operator of precedence P is parsed with P, and an operator is absorbed into the rhs only if its
+// precedence is greater, or equal and it is right associative.
+func (p *printer) infix(expr *ast.InfixExpression, level, col int) string {
+	precedence := p.precedences[expr.Operator]
+
+	lhsParens := false
+	if lhs, ok := expr.Lhs.(*ast.InfixExpression); ok {
+		lhsPrecedence := p.precedences[lhs.Operator]
+		lhsParens = precedence > lhsPrecedence || (precedence == lhsPrecedence && p.rightAssociative[expr.Operator])
+	}
+	rhsParens := false
+	if rhs, ok := expr.Rhs.(*ast.InfixExpression); ok {
+		rhsPrecedence := p.precedences[rhs.Operator]
+		rhsParens = rhsPrecedence < precedence || (rhsPrecedence == precedence && !p.rightAssociative[rhs.Operator])
+	}
+
+	lhs := p.operand(expr.Lhs, lhsParens, level, col) + " " + expr.Operator + " "
+	return lhs + p.operand(expr.Rhs, rhsParens, level, end(col, lhs))
+}
+
+// operand print an operand of an operator, a call or an index expression
+func (p *printer) operand(expr ast.Expression, parens bool, level, col int) string {
+	if parens {
+		return "(" + p.expression(expr, level, col+1) + ")"
+	}
+	return p.expression(expr, level, col)
+}
+
+// needsParens an infix or prefix expression must be grouped to be called or indexed,
+// since the call and the index bind tighter than any operator
+func needsParens(expr ast.Expression) bool {
+	switch expr.(type) {
+	case *ast.InfixExpression, *ast.PrefixExpression:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *printer) clause(clause *ast.ComprehensionClause, level, col int) string {
+	targets := make([]string, 0, len(clause.Targets))
+	for _, target := range clause.Targets {
+		targets = append(targets, target.Value)
+	}
+	target := strings.Join(targets, ", ")
+	if clause.Destructure {
+		target = "[" + target + "]"
+	}
+
+	iterable := " for " + target + " in "
+	iterable += p.expression(clause.Iterable, level, col+width(iterable))
+	if clause.Condition == nil {
+		return iterable
+	}
+	condition := iterable + " if "
+	return condition + p.expression(clause.Condition, level, end(col, condition))
+}
+
+// list print the elements on a single line if it fits in MaxWidth, otherwise one element per line.
+// A list with comments between its elements is always broken, and the comments stay after the elements they follow,
+// the starts are the first tokens of the elements.
+func (p *printer) list(open, close string, starts []token.Token, closing token.Token,
+	element func(i, level, col int) string, level, col int) string {
+	if len(starts) == 0 && !p.hasCommentsBefore(closing) {
+		return open + close
+	}
+
+	// the enclosing list is broken before the nested lists, and the comments inside the elements are printed again
+	// if the list is broken
+	next, flat := p.next, p.flat
+	p.flat = true
+	buffer := strings.Builder{}
+	buffer.WriteString(open)
+	for i := range starts {
+		if i > 0 {
+			buffer.WriteString(", ")
+		}
+		buffer.WriteString(element(i, level, end(col, buffer.String())))
+	}
+	buffer.WriteString(close)
+	p.flat = flat
+	// the comments between the elements are left by the elements
+	if !p.hasCommentsBefore(closing) && (flat || fits(col, buffer.String())) {
+		return buffer.String()
+	}
+
+	p.next = next
+	p.flat = false
+	lines := []string{open}
+	for i := range starts {
+		lines = p.flushComments(lines, &starts[i], level+1)
+		lines = append(lines, indent(level+1)+element(i, level+1, width(indent(level+1)))+",")
+	}
+	lines = p.flushComments(lines, &closing, level+1)
+	p.flat = flat
+	return strings.Join(lines, "\n") + "\n" + indent(level) + close
+}
+
+// block print the block on a single line if it is written on a single line and contains a single expression,
+// otherwise one statement per line
+func (p *printer) block(block *ast.BlockStatement, level, col int) string {
+	if len(block.Statements) == 0 && !p.hasCommentsBefore(block.End) {
+		return "{}"
+	}
+
+	if len(block.Statements) == 1 && block.Token.Line == block.End.Line && !p.hasCommentsBefore(block.End) {
+		switch block.Statements[0].(type) {
+		case *ast.ExpressionStatement, *ast.ReturnStatement, *ast.YieldStatement:
+			next := p.next
+			single := "{ " + p.statement(block.Statements[0], level, col+2) + " }"
+			if !strings.Contains(single, "\n") && fits(col, single) {
+				return single
+			}
+			p.next = next
+		}
+	}
+
+	// the lists of the statements are printed on their own lines
+	flat := p.flat
+	p.flat = false
+	lines := p.statements(block.Statements, &block.End, level+1)
+	p.flat = flat
+	return "{\n" + strings.Join(lines, "\n") + "\n" + indent(level) + "}"
+}
+
+// expressionTokens the first tokens of the expressions
+func expressionTokens(expressions []ast.Expression) []token.Token {
+	tokens := make([]token.Token, 0, len(expressions))
+	for _, expr := range expressions {
+		tokens = append(tokens, expressionToken(expr))
+	}
+	return tokens
+}
+
+// pairTokens the first tokens of the pairs of a hash
+func pairTokens(pairs []*ast.HashPair) []token.Token {
+	tokens := make([]token.Token, 0, len(pairs))
+	for _, pair := range pairs {
+		if pair.Spread != nil {
+			tokens = append(tokens, pair.Spread.Token)
+		} else {
+			tokens = append(tokens, expressionToken(pair.Key))
+		}
+	}
+	return tokens
+}
+
+// expressionToken the first token of the expression, the token of an infix, a call or an index expression is the one
+// following its first operand
+func expressionToken(expr ast.Expression) token.Token {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		return expr.Token
+	case *ast.IntegerLiteral:
+		return expr.Token
+	case *ast.BigIntegerLiteral:
+		return expr.Token
+	case *ast.BooleanExpression:
+		return expr.Token
+	case *ast.NullLiteral:
+		return expr.Token
+	case *ast.StringLiteral:
+		return expr.Token
+	case *ast.PrefixExpression:
+		return expr.Token
+	case *ast.InfixExpression:
+		return expressionToken(expr.Lhs)
+	case *ast.SpreadExpression:
+		return expr.Token
+	case *ast.CallExpression:
+		return expressionToken(expr.Fn)
+	case *ast.IndexExpression:
+		return expressionToken(expr.Lhs)
+	case *ast.ArrayLiteral:
+		return expr.Token
+	case *ast.SetLiteral:
+		return expr.Token
+	case *ast.HashExpression:
+		return expr.Token
+	case *ast.ArrayComprehension:
+		return expr.Token
+	case *ast.HashComprehension:
+		return expr.Token
+	case *ast.IfExpression:
+		return expr.Token
+	case *ast.FnLiteral:
+		return expr.Token
+	default:
+		return token.Token{}
+	}
+}
+
+func statementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.YieldStatement:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	case *ast.InfixDeclaration:
+		return stmt.Token
+	default:
+		return token.Token{}
+	}
+}
+
+// isBefore reports whether the token a is before the token b in the source code
+func isBefore(a, b token.Token) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// quote the lexer reads a backslash and the char following it as the char, so only " and \ are escaped
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+func indent(level int) string {
+	return strings.Repeat(Indent, level)
+}
+
+func width(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// end the column following s when s is printed at column col
+func end(col int, s string) int {
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return width(s[i+1:])
+	}
+	return col + width(s)
+}
+
+// fits reports whether s printed at column col fits in MaxWidth, only the first and the last lines are checked
+// since the lines between them belong to nested blocks and lists, which are already broken if necessary
+func fits(col int, s string) bool {
+	lines := strings.Split(s, "\n")
+	return col+width(lines[0]) <= MaxWidth && end(col, s) <= MaxWidth
+}
@@ -0,0 +1,169 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"let   a=1;let b = [1,2,3];", "let a = 1\nlet b = [1, 2, 3]\n"},
+		{"x = 1; return x", "x = 1\nreturn x\n"},
+		{`"a\"b\\c"`, `"a\"b\\c"` + "\n"},
+		{"((a + b) * c)", "(a + b) * c\n"},
+		{"(a - b) - (c - d)", "a - b - (c - d)\n"},
+		{"a * (b * c)", "a * (b * c)\n"},
+		{"(a < b) < (1 == 2); (a == b) == (1 < 2)", "a < b < (1 == 2)\na == b == 1 < 2\n"},
+		{"a ?? (b ?? c)", "a ?? (b ?? c)\n"},
+		{"-(a + b)", "-(a + b)\n"},
+		{"!(!true); -(-1); (-a) * b", "!!true\n--1\n-a * b\n"},
+		{"(a + b)(1)[0]; (-a)[0]; x?.name; x?[0]", "(a + b)(1)[0]\n(-a)[0]\nx?.name\nx?[0]\n"},
+		{"{...a,   1:2}; [...b]; f(...c)", "{...a, 1: 2}\n[...b]\nf(...c)\n"},
+		{"[x*2 for x in xs if x>1]; {k:v for [k,v] in h}", "[x * 2 for x in xs if x > 1]\n{k: v for [k, v] in h}\n"},
+		{"let g = fn(xs){yield 1;yield   ...xs}", "let g = fn(xs) {\n  yield 1\n  yield ...xs\n}\n"},
+		{"#{1,2,  ...a}; (a in b) == (1 + 2 in c); a in (b in c)", "#{1, 2, ...a}\na in b == 1 + 2 in c\na in (b in c)\n"},
+		{
+			"infixr 45 <+> (a,b) => a - b; 1 <+> (2 <+> 3); (1 <+> 2) <+> 3; (1 <+> 2) + 3",
+			"infixr 45 <+> (a, b) => a - b\n1 <+> 2 <+> 3\n(1 <+> 2) <+> 3\n1 <+> 2 + 3\n",
+		},
+		{
+			"infixr 45 <+> (a,b) => a - b; infix 45 <-> (a,b) => a - b; (1 <-> 2) <+> 3; 1 <-> (2 <+> 3); (1 <+> 2) <-> 3; 1 <+> (2 <-> 3)",
+			"infixr 45 <+> (a, b) => a - b\ninfix 45 <-> (a, b) => a - b\n(1 <-> 2) <+> 3\n1 <-> 2 <+> 3\n1 <+> 2 <-> 3\n1 <+> (2 <-> 3)\n",
+		},
+		{
+			"let f = fn(x, y) { x + y }; let g = fn(x) { return x }; let h = fn() {}",
+			"let f = fn(x, y) { x + y }\nlet g = fn(x) { return x }\nlet h = fn() {}\n",
+		},
+		{
+			"let f = fn(x) { let y = x; y }",
+			"let f = fn(x) {\n  let y = x\n  y\n}\n",
+		},
+		{
+			"let f = fn(x) {\n x }",
+			"let f = fn(x) {\n  x\n}\n",
+		},
+		{
+			"if (a > b) { a } else { if (c) {\nb\n} }",
+			"if (a > b) { a } else {\n  if (c) {\n    b\n  }\n}\n",
+		},
+	}
+
+	for i, testCase := range testCases {
+		testFormat(t, i, testCase.input, testCase.expected)
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	input := `// leading
+let a = 1 // trailing
+
+
+// after blank lines
+let f = fn(x) {
+  // inside
+  x // tail
+
+  // before the end
+}
+let b = [
+  1, // in a list
+  2,
+]
+// at the end
+`
+	expected := `// leading
+let a = 1 // trailing
+
+// after blank lines
+let f = fn(x) {
+  // inside
+  x // tail
+
+  // before the end
+}
+let b = [
+  1, // in a list
+  2,
+]
+// at the end
+`
+	testFormat(t, 0, input, expected)
+	testFormat(t, 1, "// only comments\n\n// here\n", "// only comments\n\n// here\n")
+	testFormat(t, 2, "let f = fn() { 1 } // a one-line block", "let f = fn() { 1 } // a one-line block\n")
+	testFormat(t, 3, "let f = fn() { // not a one-line block\n 1 }", "let f = fn() {\n  // not a one-line block\n  1\n}\n")
+}
+
+func TestFormatCommentsInLists(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1, 2 // two\n]", "let a = [\n  1,\n  2, // two\n]\n"},
+		{"let a = [1, // one\n2 // two\n]", "let a = [\n  1, // one\n  2, // two\n]\n"},
+		{"let a = [\n// first\n1,\n\n// second\n2]", "let a = [\n  // first\n  1,\n\n  // second\n  2,\n]\n"},
+		{"let a = [ // none\n]", "let a = [ // none\n]\n"},
+		{"let h = {\"a\": 1, // one\n...b}", "let h = {\n  \"a\": 1, // one\n  ...b,\n}\n"},
+		{"f(a, // a\nb + c)", "f(\n  a, // a\n  b + c,\n)\n"},
+		{"puts([1, // one\n2])", "puts([\n  1, // one\n  2,\n])\n"},
+		{"each(xs, fn(x) {\n// inside\nx })", "each(xs, fn(x) {\n  // inside\n  x\n})\n"},
+	}
+
+	for i, testCase := range testCases {
+		testFormat(t, i, testCase.input, testCase.expected)
+	}
+}
+
+func TestFormatLineBreaking(t *testing.T) {
+	input := `let config = {"host": "localhost", "port": 8080, "users": ["alice", "bob", "carol"], "debug": true}
+each(config, fn(k, v) { puts(someVeryLongFunctionName(argumentNumberOne, argumentNumberTwo, k, v)) })
+let short = add(1, 2)
+`
+	expected := `let config = {
+  "host": "localhost",
+  "port": 8080,
+  "users": ["alice", "bob", "carol"],
+  "debug": true,
+}
+each(config, fn(k, v) {
+  puts(someVeryLongFunctionName(argumentNumberOne, argumentNumberTwo, k, v))
+})
+let short = add(1, 2)
+`
+	testFormat(t, 0, input, expected)
+
+	for i, line := range strings.Split(expected, "\n") {
+		if len(line) > MaxWidth {
+			t.Errorf("line [%d] is wider than [%d]: %s", i, MaxWidth, line)
+		}
+	}
+}
+
+func TestFormatSyntaxError(t *testing.T) {
+	if _, err := Source("let a = "); err == nil {
+		t.Fatalf("expected a syntax error")
+	}
+}
+
+// testFormat format the input, and check that formatting the output again doesn't change it
+func testFormat(t *testing.T, caseIndex int, input, expected string) {
+	t.Helper()
+
+	actual, err := Source(input)
+	if err != nil {
+		t.Fatalf("test case [%d] format error: %s", caseIndex, err)
+	}
+	if actual != expected {
+		t.Fatalf("test case [%d] expected:\n%s\nactual:\n%s", caseIndex, expected, actual)
+	}
+
+	again, err := Source(actual)
+	if err != nil {
+		t.Fatalf("test case [%d] the output doesn't parse: %s", caseIndex, err)
+	}
+	if again != actual {
+		t.Fatalf("test case [%d] not idempotent, expected:\n%s\nactual:\n%s", caseIndex, actual, again)
+	}
+}
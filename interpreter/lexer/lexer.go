@@ -4,6 +4,7 @@ import (
 	"0x822a5b87/monkey/interpreter/common"
 	"0x822a5b87/monkey/interpreter/token"
 	"bytes"
+	"strings"
 )
 
 const LiteralEof byte = 0
@@ -20,13 +21,20 @@ type Lexer struct {
 	readPosition int  // current reading position in input(after current char)
 	ch           byte // current char under examination
 	Info         Info
+
+	// operators the user-defined infix operators declared so far, see readOperatorDeclaration
+	operators map[string]bool
+	// history the types of the last two tokens, which tell whether the next token is the operator of a declaration
+	history [2]token.TokenType
+	// comments the line comments skipped so far, in source order
+	comments []token.Token
 }
 
 func NewLexer(source string) *Lexer {
 	l := &Lexer{sourceCode: source, Info: Info{
 		RowNum: 0,
 		ColNum: 0,
-	}}
+	}, operators: make(map[string]bool)}
 	// init lexer
 	l.readChar()
 	return l
@@ -37,8 +45,28 @@ func NewLexer(source string) *Lexer {
 // for further info please read my blog:
 // https://0x822a5b87.github.io/2024/07/26/%E5%85%B3%E4%BA%8Egolang%E7%9A%84%E7%B1%BB%E5%9E%8B%E6%8E%A8%E5%AF%BC%E3%80%81%E9%9A%90%E5%BC%8F%E7%B1%BB%E5%9E%8B%E8%BD%AC%E6%8D%A2%E7%9A%84%E4%B8%80%E4%BA%9B%E6%80%9D%E8%80%83/
 func (l *Lexer) NextToken() (token.Token, error) {
-	// before we parse token, we should skip the whitespace
-	l.skipWhitespace()
+	// before we parse token, we should skip the whitespace,
+	// the parser needs to know whether the token starts a new line to terminate statements without semicolon
+	newLines := l.skipWhitespace()
+	line, column := l.Info.RowNum+1, l.Info.ColNum
+
+	tok, err := l.readToken()
+	tok.NewLine = newLines > 0
+	tok.BlankLine = newLines > 1
+	tok.Line, tok.Column = line, column
+	l.history = [2]token.TokenType{l.history[1], tok.Type}
+	return tok, err
+}
+
+func (l *Lexer) readToken() (token.Token, error) {
+	// `infix 45 <+>` the run of symbols following the precedence of a declaration is always a single operator
+	if (l.history[0] == token.INFIX || l.history[0] == token.INFIXR) && l.history[1] == token.INT {
+		return l.readOperatorDeclaration()
+	}
+
+	if tok, ok := l.readDeclaredOperator(); ok {
+		return tok, nil
+	}
 
 	var tok token.Token
 	var err error
@@ -50,6 +78,10 @@ func (l *Lexer) NextToken() (token.Token, error) {
 			ch := l.ch
 			l.readChar()
 			tok, err = newTokenForBinary(token.EQ, ch, l.ch)
+		} else if l.peakChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok, err = newTokenForBinary(token.ARROW, ch, l.ch)
 		} else {
 			tok, err = newToken(token.ASSIGN, l.ch)
 		}
@@ -91,6 +123,33 @@ func (l *Lexer) NextToken() (token.Token, error) {
 		tok, err = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok, err = newToken(token.COLON, l.ch)
+	case '.':
+		tok, err = l.readEllipsis()
+	case '?':
+		switch l.peakChar() {
+		case '?':
+			ch := l.ch
+			l.readChar()
+			tok, err = newTokenForBinary(token.NullCoalescing, ch, l.ch)
+		case '.':
+			ch := l.ch
+			l.readChar()
+			tok, err = newTokenForBinary(token.OptionalChaining, ch, l.ch)
+		case '[':
+			ch := l.ch
+			l.readChar()
+			tok, err = newTokenForBinary(token.OptionalIndex, ch, l.ch)
+		default:
+			tok, err = token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}, common.ErrUnknownToken
+		}
+	case '#':
+		if l.peakChar() == '{' {
+			ch := l.ch
+			l.readChar()
+			tok, err = newTokenForBinary(token.SetLBrace, ch, l.ch)
+		} else {
+			tok, err = token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}, common.ErrUnknownToken
+		}
 	case '"':
 		str := l.readString()
 		tok, err = newStrToken(str)
@@ -114,6 +173,85 @@ func (l *Lexer) NextToken() (token.Token, error) {
 	return tok, err
 }
 
+// builtInOperators the operators which already have a meaning and cannot be declared by users
+var builtInOperators = map[string]bool{
+	"=": true, "==": true, "!=": true, "!": true, "+": true, "-": true, "*": true, "/": true, "<": true, ">": true,
+	":": true, "...": true, "??": true, "?.": true, "=>": true,
+}
+
+func isOperatorChar(ch byte) bool {
+	switch ch {
+	case '+', '-', '*', '/', '<', '>', '=', '!', '&', '|', '^', '%', '~', '@', '$', '#', '.', '?', ':':
+		return true
+	default:
+		return false
+	}
+}
+
+// operatorRunEnd returns the end position of the run of operator chars starting at the current char
+func (l *Lexer) operatorRunEnd() int {
+	end := l.position
+	for end < len(l.sourceCode) && isOperatorChar(l.sourceCode[end]) {
+		end++
+	}
+	return end
+}
+
+// readOperatorDeclaration read the operator of `infix 45 <+> (a, b) => ...` and register it,
+// so that the following occurrences of the operator are read as a single token.OPERATOR
+func (l *Lexer) readOperatorDeclaration() (token.Token, error) {
+	end := l.operatorRunEnd()
+	literal := l.sourceCode[l.position:end]
+	if literal == "" || builtInOperators[literal] {
+		return token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}, common.ErrUnknownToken
+	}
+	for l.position < end {
+		l.readChar()
+	}
+	l.operators[literal] = true
+	return token.Token{Type: token.OPERATOR, Literal: literal}, nil
+}
+
+// readDeclaredOperator read the longest declared operator at the current char, if any
+func (l *Lexer) readDeclaredOperator() (token.Token, bool) {
+	if len(l.operators) == 0 {
+		return token.Token{}, false
+	}
+	for end := l.operatorRunEnd(); end > l.position; end-- {
+		literal := l.sourceCode[l.position:end]
+		if l.operators[literal] {
+			for l.position < end {
+				l.readChar()
+			}
+			return token.Token{Type: token.OPERATOR, Literal: literal}, true
+		}
+	}
+	return token.Token{}, false
+}
+
+// readEllipsis the only token starting with a dot is the spread operator "..."
+func (l *Lexer) readEllipsis() (token.Token, error) {
+	for i := 0; i < 2; i++ {
+		if l.peakChar() != '.' {
+			return token.Token{Type: token.ILLEGAL, Literal: string(l.ch)}, common.ErrUnknownToken
+		}
+		l.readChar()
+	}
+	return token.Token{Type: token.ELLIPSIS, Literal: string(token.ELLIPSIS)}, nil
+}
+
+// Comments the comments skipped by the lexer so far, they are not tokens of the program
+// but tools like the formatter need them to reproduce the source code
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// DeclareOperator declare a user-defined operator of the sources read before, like the previous inputs of the REPL,
+// see readOperatorDeclaration
+func (l *Lexer) DeclareOperator(operator string) {
+	l.operators[operator] = true
+}
+
 func (l *Lexer) CurInfo() Info {
 	return l.Info
 }
@@ -198,10 +336,42 @@ func (l *Lexer) hasNextChar() bool {
 	return l.readPosition < len(l.sourceCode)
 }
 
-func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\n' || l.ch == '\t' || l.ch == '\r' {
+// skipWhitespace skip the whitespace and the comments before next token,
+// and return the number of line breaks since the previous token or comment
+func (l *Lexer) skipWhitespace() int {
+	newLines := 0
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '\n':
+			newLines++
+			l.readChar()
+		case l.ch == '/' && l.peakChar() == '/':
+			l.readComment(newLines)
+			// a comment always runs to the end of line, so the next token is still preceded by a line break
+			newLines = 0
+		default:
+			return newLines
+		}
+	}
+}
+
+// readComment read a comment which runs from // to the end of line
+func (l *Lexer) readComment(newLines int) {
+	comment := token.Token{
+		Type:      token.COMMENT,
+		NewLine:   newLines > 0,
+		BlankLine: newLines > 1,
+		Line:      l.Info.RowNum + 1,
+		Column:    l.Info.ColNum,
+	}
+	cur := l.position
+	for l.ch != '\n' && l.ch != LiteralEof {
 		l.readChar()
 	}
+	comment.Literal = strings.TrimRight(l.sourceCode[cur:l.position], " \t\r")
+	l.comments = append(l.comments, comment)
 }
 
 func (l *Lexer) readString() string {
@@ -240,9 +410,10 @@ func (l *Lexer) curStr() string {
 }
 
 func (l *Lexer) incInfo() {
-	if l.ch == '\n' || l.ch == '\r' {
+	// l.ch is the char we are leaving, so the first char of the next line is at column 1
+	if l.ch == '\n' {
 		l.Info.RowNum++
-		l.Info.ColNum = 0
+		l.Info.ColNum = 1
 		return
 	}
 
@@ -215,7 +215,7 @@ let y = "this is a sentence for testing! I want to say \"Hello World\"!";
 	for i, expectedToken := range expectedTokens {
 		nextToken, err := l.NextToken()
 		if err != nil {
-			t.Fatalf("tests[%d] - error get token, error = [%s], ch = [%s], token = [%q]", i, err.Error(), string(l.ch), nextToken)
+			t.Fatalf("tests[%d] - error get token, error = [%s], ch = [%s], token = [%+v]", i, err.Error(), string(l.ch), nextToken)
 		}
 
 		if nextToken.Type != expectedToken.expectedType {
@@ -232,3 +232,208 @@ type expectedToken struct {
 	expectedType    token.TokenType
 	expectedLiteral string
 }
+
+func TestNextTokenNullSafety(t *testing.T) {
+	input := `let a = null ?? b?.c?[0];`
+
+	expectedTokens := []expectedToken{
+		{token.LET, "let"},
+		{token.IDENTIFIER, "a"},
+		{token.ASSIGN, "="},
+		{token.NULL, "null"},
+		{token.NullCoalescing, "??"},
+		{token.IDENTIFIER, "b"},
+		{token.OptionalChaining, "?."},
+		{token.IDENTIFIER, "c"},
+		{token.OptionalIndex, "?["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, string(LiteralEof)},
+	}
+
+	testTokens(t, input, expectedTokens)
+}
+
+func TestNextTokenSpread(t *testing.T) {
+	input := `[...a, 1]; f(...args);`
+
+	expectedTokens := []expectedToken{
+		{token.LBRACKET, "["},
+		{token.ELLIPSIS, "..."},
+		{token.IDENTIFIER, "a"},
+		{token.COMMA, ","},
+		{token.INT, "1"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "f"},
+		{token.LPAREN, "("},
+		{token.ELLIPSIS, "..."},
+		{token.IDENTIFIER, "args"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, string(LiteralEof)},
+	}
+
+	testTokens(t, input, expectedTokens)
+}
+
+func TestNextTokenComprehension(t *testing.T) {
+	input := `[x for x in xs if x]`
+
+	expectedTokens := []expectedToken{
+		{token.LBRACKET, "["},
+		{token.IDENTIFIER, "x"},
+		{token.FOR, "for"},
+		{token.IDENTIFIER, "x"},
+		{token.IN, "in"},
+		{token.IDENTIFIER, "xs"},
+		{token.IF, "if"},
+		{token.IDENTIFIER, "x"},
+		{token.RBRACKET, "]"},
+		{token.EOF, string(LiteralEof)},
+	}
+
+	testTokens(t, input, expectedTokens)
+}
+
+func TestNextTokenSet(t *testing.T) {
+	input := `#{1, x}`
+
+	expectedTokens := []expectedToken{
+		{token.SetLBrace, "#{"},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.IDENTIFIER, "x"},
+		{token.RBRACE, "}"},
+		{token.EOF, string(LiteralEof)},
+	}
+
+	testTokens(t, input, expectedTokens)
+}
+
+func TestNextTokenInfixDeclaration(t *testing.T) {
+	input := `infix 45 <+> (a, b) => a + b; 1 <+> 2<+>-3 < 4`
+
+	expectedTokens := []expectedToken{
+		{token.INFIX, "infix"},
+		{token.INT, "45"},
+		{token.OPERATOR, "<+>"},
+		{token.LPAREN, "("},
+		{token.IDENTIFIER, "a"},
+		{token.COMMA, ","},
+		{token.IDENTIFIER, "b"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "=>"},
+		{token.IDENTIFIER, "a"},
+		{token.PLUS, "+"},
+		{token.IDENTIFIER, "b"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "1"},
+		{token.OPERATOR, "<+>"},
+		{token.INT, "2"},
+		{token.OPERATOR, "<+>"},
+		{token.SUB, "-"},
+		{token.INT, "3"},
+		{token.LT, "<"},
+		{token.INT, "4"},
+		{token.EOF, string(LiteralEof)},
+	}
+
+	testTokens(t, input, expectedTokens)
+}
+
+func TestNextTokenInfixDeclarationOfBuiltInOperator(t *testing.T) {
+	l := NewLexer(`infixr 45 + (a, b) => a`)
+	for i := 0; i < 2; i++ {
+		_, _ = l.NextToken()
+	}
+	tok, err := l.NextToken()
+	if err == nil || tok.Type != token.ILLEGAL {
+		t.Fatalf("expected ILLEGAL token, got [%+v]", tok)
+	}
+}
+
+func TestNextTokenComments(t *testing.T) {
+	input := `// leading
+let a = 10 / 2 // trailing
+
+"http://x"`
+
+	expectedTokens := []expectedToken{
+		{token.LET, "let"},
+		{token.IDENTIFIER, "a"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.String, "http://x"},
+		{token.EOF, string(LiteralEof)},
+	}
+
+	testTokens(t, input, expectedTokens)
+
+	l := NewLexer(input)
+	for tok, _ := l.NextToken(); tok.Type != token.EOF; tok, _ = l.NextToken() {
+	}
+	expectedComments := []token.Token{
+		{Type: token.COMMENT, Literal: "// leading", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "// trailing", Line: 2, Column: 16},
+	}
+	if len(l.Comments()) != len(expectedComments) {
+		t.Fatalf("expected [%d] comments, got [%d]", len(expectedComments), len(l.Comments()))
+	}
+	for i, comment := range l.Comments() {
+		if comment != expectedComments[i] {
+			t.Errorf("comment [%d] expected = [%+v], got = [%+v]", i, expectedComments[i], comment)
+		}
+	}
+}
+
+func TestNextTokenPosition(t *testing.T) {
+	l := NewLexer("let a = 1\n\n  a + 2")
+
+	expected := []struct {
+		literal   string
+		line      int
+		column    int
+		newLine   bool
+		blankLine bool
+	}{
+		{"let", 1, 1, false, false},
+		{"a", 1, 5, false, false},
+		{"=", 1, 7, false, false},
+		{"1", 1, 9, false, false},
+		{"a", 3, 3, true, true},
+		{"+", 3, 5, false, false},
+		{"2", 3, 7, false, false},
+	}
+	for i, e := range expected {
+		tok, _ := l.NextToken()
+		if tok.Literal != e.literal || tok.Line != e.line || tok.Column != e.column ||
+			tok.NewLine != e.newLine || tok.BlankLine != e.blankLine {
+			t.Errorf("token [%d] expected = [%+v], got = [%+v]", i, e, tok)
+		}
+	}
+}
+
+func testTokens(t *testing.T, input string, expectedTokens []expectedToken) {
+	t.Helper()
+
+	l := NewLexer(input)
+
+	for i, expectedToken := range expectedTokens {
+		nextToken, err := l.NextToken()
+		if err != nil {
+			t.Fatalf("tests[%d] - error get token, error = [%s], ch = [%s], token = [%+v]", i, err.Error(), string(l.ch), nextToken)
+		}
+
+		if nextToken.Type != expectedToken.expectedType {
+			t.Fatalf("tests[%d] - type wrong, expected = %q, got = %q", i, expectedToken.expectedType, nextToken.Type)
+		}
+
+		if nextToken.Literal != expectedToken.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong, expected = %q, got = %q", i, expectedToken.expectedLiteral, nextToken.Literal)
+		}
+	}
+}
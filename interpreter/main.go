@@ -8,6 +8,15 @@ import (
 )
 
 func main() {
+	// monkey fmt [-l] [-d] [file ...]
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(formatCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+	// monkey ast [-dot] [file]
+	if len(os.Args) > 1 && os.Args[1] == "ast" {
+		os.Exit(astCommand(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	u, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,109 @@
+// Package monkey embeds the Monkey programming language in Go programs.
+//
+//	m := monkey.New(monkey.Options{Engine: monkey.Compiler})
+//	err := m.RegisterFunc("now", func() int64 { return time.Now().Unix() })
+//	err = m.Set("limit", 10)
+//	_, err = m.Eval(`let allowed = fn(count) { count < limit }`)
+//	allowed, err := m.Call("allowed", 3)
+//
+// The Go values passed to Set and Call, and the arguments and the results of the Go functions, are converted
+// by object.FromGo and object.ToGo.
+//
+// Every Runtime is isolated from the others, see engine.Runtime.
+package monkey
+
+import (
+	"0x822a5b87/monkey/interpreter/common"
+	"0x822a5b87/monkey/interpreter/engine"
+	"0x822a5b87/monkey/interpreter/object"
+	"context"
+	"fmt"
+)
+
+// Engine the engine which runs the programs
+type Engine = engine.Kind
+
+const (
+	Interpreter = engine.Interpreter // Interpreter the tree-walking evaluator, it's the default engine
+	Compiler    = engine.Compiler    // Compiler the bytecode compiler and the vm
+)
+
+type Options struct {
+	Engine Engine
+	// Limits the limits of every Eval and Call, see common.Limits
+	Limits common.Limits
+}
+
+// Runtime an instance of the language, the bindings defined by Eval, Set and RegisterFunc are kept
+// until the Runtime is dropped. A Runtime must be used by one goroutine at a time.
+type Runtime struct {
+	runtime *engine.Runtime
+}
+
+func New(opts Options) *Runtime {
+	if opts.Engine == "" {
+		opts.Engine = Interpreter
+	}
+	runtime := engine.New(opts.Engine)
+	runtime.Limits = opts.Limits
+	return &Runtime{runtime: runtime}
+}
+
+// Eval run the source code and return the value of its last statement
+func (r *Runtime) Eval(src string) (object.Object, error) {
+	return r.EvalContext(context.Background(), src)
+}
+
+// EvalContext run the source code like Eval until the context is done
+func (r *Runtime) EvalContext(ctx context.Context, src string) (object.Object, error) {
+	program, err := r.runtime.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return r.runtime.Run(ctx, program)
+}
+
+// Call call the global function with the arguments converted by object.FromGo and return its value
+func (r *Runtime) Call(fnName string, args ...any) (object.Object, error) {
+	return r.CallContext(context.Background(), fnName, args...)
+}
+
+// CallContext call the global function like Call until the context is done
+func (r *Runtime) CallContext(ctx context.Context, fnName string, args ...any) (object.Object, error) {
+	objs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := object.FromGo(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of [%s]: %w", i+1, fnName, err)
+		}
+		objs[i] = obj
+	}
+	return r.runtime.Call(ctx, fnName, objs...)
+}
+
+// Set bind the value converted by object.FromGo to the global name
+func (r *Runtime) Set(name string, value any) error {
+	obj, err := object.FromGo(value)
+	if err != nil {
+		return err
+	}
+	r.runtime.Set(name, obj)
+	return nil
+}
+
+// Get the value bound to the global name
+func (r *Runtime) Get(name string) (object.Object, bool) {
+	return r.runtime.Get(name)
+}
+
+// RegisterFunc bind the Go function to the global name, the programs call it like a built-in function.
+// The function has any signature supported by object.NewBuiltIn, and it fails the call by returning an error,
+// or an *object.Error if it's an object.BuiltInFunction.
+func (r *Runtime) RegisterFunc(name string, goFunc any) error {
+	builtIn, err := object.NewBuiltIn(name, goFunc)
+	if err != nil {
+		return err
+	}
+	r.runtime.Set(name, builtIn)
+	return nil
+}
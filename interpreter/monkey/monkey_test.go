@@ -0,0 +1,186 @@
+package monkey
+
+import (
+	"0x822a5b87/monkey/interpreter/common"
+	"0x822a5b87/monkey/interpreter/object"
+	"errors"
+	"testing"
+)
+
+var engines = []Engine{Interpreter, Compiler}
+
+func testInteger(t *testing.T, engine Engine, obj object.Object, err error, expected int64) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("[%s] unexpected error [%s]", engine, err)
+	}
+	integer, ok := obj.(*object.Integer)
+	if !ok || integer.Value != expected {
+		t.Fatalf("[%s] expected [%d], got [%s]", engine, expected, obj.Inspect())
+	}
+}
+
+func TestEvalAndCall(t *testing.T) {
+	for _, engine := range engines {
+		m := New(Options{Engine: engine})
+		obj, err := m.Eval("let add = fn(a, b) { a + b }; add(1, 2)")
+		testInteger(t, engine, obj, err, 3)
+
+		obj, err = m.Call("add", &object.Integer{Value: 3}, &object.Integer{Value: 4})
+		testInteger(t, engine, obj, err, 7)
+
+		obj, err = m.Call("len", &object.StringObj{Value: "monkey"})
+		testInteger(t, engine, obj, err, 6)
+
+		if _, err = m.Call("missing"); err == nil {
+			t.Fatalf("[%s] expected an error for an undefined function", engine)
+		}
+		if _, err = m.Eval("let a = "); err == nil {
+			t.Fatalf("[%s] expected a syntax error", engine)
+		}
+	}
+}
+
+func TestEvalOperatorOfPreviousEval(t *testing.T) {
+	for _, engine := range engines {
+		m := New(Options{Engine: engine})
+		_, err := m.Eval("infix 45 <+> (a, b) => a * 10 + b")
+		if err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", engine, err)
+		}
+		obj, err := m.Eval("1 <+> 2")
+		testInteger(t, engine, obj, err, 12)
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	for _, engine := range engines {
+		m := New(Options{Engine: engine})
+		_ = m.Set("limit", &object.Integer{Value: 10})
+		obj, err := m.Eval("let double = limit * 2; double")
+		testInteger(t, engine, obj, err, 20)
+
+		obj, ok := m.Get("double")
+		testInteger(t, engine, obj, nil, 20)
+
+		// a later Set overrides the binding
+		_ = m.Set("limit", &object.Integer{Value: 1})
+		obj, err = m.Eval("limit + 1")
+		testInteger(t, engine, obj, err, 2)
+
+		if _, ok = m.Get("missing"); ok {
+			t.Fatalf("[%s] expected missing to be undefined", engine)
+		}
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	for _, engine := range engines {
+		m := New(Options{Engine: engine})
+		calls := 0
+		_ = m.RegisterFunc("count", func(args ...object.Object) object.Object {
+			calls++
+			return &object.Integer{Value: int64(len(args))}
+		})
+		_ = m.RegisterFunc("fail", func(args ...object.Object) object.Object {
+			return &object.Error{Message: "host failure"}
+		})
+
+		obj, err := m.Eval("let f = fn(x) { count(x, x, x) }; f(1) + count()")
+		testInteger(t, engine, obj, err, 3)
+		obj, err = m.Call("f", &object.Integer{Value: 1})
+		testInteger(t, engine, obj, err, 3)
+		if calls != 3 {
+			t.Fatalf("[%s] expected [3] calls, got [%d]", engine, calls)
+		}
+
+		if _, err = m.Eval("1 + fail()"); err == nil || err.Error() != "host failure" {
+			t.Fatalf("[%s] expected the error of the host function, got [%v]", engine, err)
+		}
+		// the host functions are registered in the runtime only
+		if _, err = New(Options{Engine: engine}).Eval("count()"); err == nil {
+			t.Fatalf("[%s] expected count to be undefined in a new runtime", engine)
+		}
+	}
+}
+
+type order struct {
+	ID    string   `monkey:"id"`
+	Items []string `monkey:"items"`
+	Total int      `monkey:"total"`
+}
+
+func TestGoValues(t *testing.T) {
+	for _, engine := range engines {
+		m := New(Options{Engine: engine})
+		if err := m.RegisterFunc("discount", func(o order, percent int) (int, error) {
+			if percent > 100 {
+				return 0, errors.New("percent over 100")
+			}
+			return o.Total * (100 - percent) / 100, nil
+		}); err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", engine, err)
+		}
+		if err := m.RegisterFunc("tags", func(prefix string, names ...string) []string {
+			for i := range names {
+				names[i] = prefix + names[i]
+			}
+			return names
+		}); err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", engine, err)
+		}
+		if err := m.Set("config", map[string]any{"percent": 20, "vip": []string{"ada"}}); err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", engine, err)
+		}
+
+		_, err := m.Eval(`
+let price = fn(o) { discount(o, config["percent"]) };
+let label = fn(o) { {"id": o["id"], "tags": tags("#", ...o["items"])} };`)
+		if err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", engine, err)
+		}
+
+		o := order{ID: "A1", Items: []string{"book", "pen"}, Total: 50}
+		obj, err := m.Call("price", o)
+		testInteger(t, engine, obj, err, 40)
+
+		obj, err = m.Call("label", o)
+		if err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", engine, err)
+		}
+		var label struct {
+			ID   string   `monkey:"id"`
+			Tags []string `monkey:"tags"`
+		}
+		if err = object.ToGo(obj, &label); err != nil {
+			t.Fatalf("[%s] unexpected error [%s]", engine, err)
+		}
+		if label.ID != "A1" || len(label.Tags) != 2 || label.Tags[1] != "#pen" {
+			t.Fatalf("[%s] unexpected label [%+v]", engine, label)
+		}
+
+		if _, err = m.Eval(`discount({"total": 1}, 200)`); err == nil || err.Error() != "discount: percent over 100" {
+			t.Fatalf("[%s] expected the error of the host function, got [%v]", engine, err)
+		}
+		if _, err = m.Eval(`discount("order", 1)`); err == nil ||
+			err.Error() != "discount: argument 1: cannot convert STRING to monkey.order" {
+			t.Fatalf("[%s] expected a conversion error, got [%v]", engine, err)
+		}
+		if _, err = m.Call("price", 1.5); err == nil {
+			t.Fatalf("[%s] expected an error for a float argument", engine)
+		}
+		if err = m.RegisterFunc("bad", 1); err == nil {
+			t.Fatalf("[%s] expected an error for a non-func", engine)
+		}
+	}
+}
+
+func TestOptionsLimits(t *testing.T) {
+	for _, engine := range engines {
+		m := New(Options{Engine: engine, Limits: common.Limits{MaxSteps: 100}})
+		_, err := m.Eval("let f = fn(f, n) { f(f, n + 1) }; f(f, 0)")
+		if !errors.Is(err, common.ErrStepLimitExceeded) {
+			t.Fatalf("[%s] expected a step limit error, got [%v]", engine, err)
+		}
+	}
+}
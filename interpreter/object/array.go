@@ -2,11 +2,24 @@ package object
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
+	"sync/atomic"
 )
 
+// Array is backed by a persistent vector, so push, rest and assoc return a new array in near constant time
+// and share the elements with the original one, which is never modified by them.
+// Since an array never changes once built, it's usable as a hash key if all of its elements are.
 type Array struct {
-	Elements []Object
+	elements vector[Object]
+	// hash caches the hash of the elements once computed, 0 means not yet, it's accessed atomically like
+	// the hash of a string
+	hash uint64
+}
+
+// NewArray an array of the elements, which are copied
+func NewArray(elements []Object) *Array {
+	return &Array{elements: newVector(elements)}
 }
 
 func (a *Array) Type() ObjType {
@@ -15,8 +28,8 @@ func (a *Array) Type() ObjType {
 
 func (a *Array) Inspect() string {
 	buffer := bytes.Buffer{}
-	elements := make([]string, 0)
-	for _, element := range a.Elements {
+	elements := make([]string, 0, a.Size())
+	for _, element := range a.Elements() {
 		elements = append(elements, element.Inspect())
 	}
 	buffer.WriteString("[")
@@ -25,51 +38,164 @@ func (a *Array) Inspect() string {
 	return buffer.String()
 }
 
-func (a *Array) Index(o Object) Object {
-	other, ok := o.(*Integer)
+// Elements returns a copy of the elements
+func (a *Array) Elements() []Object {
+	return a.elements.slice()
+}
+
+// Size the number of elements
+func (a *Array) Size() int {
+	return a.elements.size()
+}
+
+// Get the element at i, which must be in range
+func (a *Array) Get(i int) Object {
+	return a.elements.get(i)
+}
+
+// Append add obj to the end of the array in place, it's only meant for the arrays being built,
+// like a comprehension, before they are visible to the program
+func (a *Array) Append(obj Object) {
+	a.elements = a.elements.push(obj)
+	atomic.StoreUint64(&a.hash, 0)
+}
+
+// HashKey combine the hashes of the elements in their order, the array must be checked by AsHashable first,
+// an element which is not hashable only counts by its type
+func (a *Array) HashKey() HashKey {
+	key, _ := a.hashKey()
+	return key
+}
+
+// hashKey the hash key of the array, and whether all of its elements are hashable
+func (a *Array) hashKey() (HashKey, bool) {
+	if hash := atomic.LoadUint64(&a.hash); hash != 0 {
+		return HashKey{Type: ObjArray, HashValue: int64(hash)}, true
+	}
+	hash, hashable := uint64(a.Size()), true
+	for i := 0; i < a.Size(); i++ {
+		element, ok := AsHashable(a.Get(i))
+		if !ok {
+			hashable = false
+			hash = (hash ^ mix(HashKey{Type: a.Get(i).Type()})) * 1099511628211
+			continue
+		}
+		hash = (hash ^ hashOf(element)) * 1099511628211
+	}
+	hash |= 1
+	if hashable {
+		atomic.StoreUint64(&a.hash, hash)
+	}
+	return HashKey{Type: ObjArray, HashValue: int64(hash)}, hashable
+}
+
+// Equal the arrays have the same length and their elements are equal one by one
+func (a *Array) Equal(o Object) *Boolean {
+	other, ok := o.(*Array)
+	if !ok || a.Size() != other.Size() {
+		return NativeFalse
+	}
+	for i := 0; i < a.Size(); i++ {
+		if !Equals(a.Get(i), other.Get(i)) {
+			return NativeFalse
+		}
+	}
+	return NativeTrue
+}
+
+func (a *Array) NotEqual(o Object) *Boolean {
+	return NativeBoolean(!a.Equal(o).Value)
+}
+
+// Compare order the arrays lexicographically, by the first pair of elements which are not equal,
+// or by their lengths if one is a prefix of the other
+func (a *Array) Compare(o Object) (int, error) {
+	other, ok := o.(*Array)
 	if !ok {
-		return NativeNull
+		return 0, &NotComparableError{Lhs: a, Rhs: o}
 	}
-	if other.Value >= int64(len(a.Elements)) || other.Value < 0 {
+	for i := 0; i < a.Size() && i < other.Size(); i++ {
+		if !Equals(a.Get(i), other.Get(i)) {
+			return Compare(a.Get(i), other.Get(i))
+		}
+	}
+	return a.Size() - other.Size(), nil
+}
+
+func (a *Array) Index(o Object) Object {
+	i, ok := indexValue(o)
+	if !ok || i >= int64(a.Size()) || i < 0 {
 		return NativeNull
 	}
-	return a.Elements[other.Value]
+	return a.Get(int(i))
+}
+
+// Contains tells if any element is equal to the element
+func (a *Array) Contains(element Object) Object {
+	for i := 0; i < a.Size(); i++ {
+		if Equals(a.Get(i), element) {
+			return NativeTrue
+		}
+	}
+	return NativeFalse
 }
 
 func (a *Array) First() Object {
-	if a.Len().Value == 0 {
+	if a.Size() == 0 {
 		return NativeNull
 	}
-	return a.Index(&Integer{Value: 0})
+	return a.Get(0)
 }
 
 func (a *Array) Last() Object {
-	if a.Len().Value == 0 {
+	if a.Size() == 0 {
 		return NativeNull
 	}
-	return a.Index(&Integer{Value: a.Len().Value - 1})
+	return a.Get(a.Size() - 1)
 }
 
 func (a *Array) Len() Integer {
-	return Integer{Value: int64(len(a.Elements))}
+	return Integer{Value: int64(a.Size())}
 }
 
 func (a *Array) Rest() Object {
-	length := len(a.Elements)
-	if length > 0 {
-		newElements := make([]Object, length-1)
-		copy(newElements, a.Elements[1:length])
-		restArray := &Array{Elements: newElements}
-		return restArray
+	if a.Size() > 0 {
+		return &Array{elements: a.elements.rest()}
 	}
 	return NativeNull
 }
 
 func (a *Array) Push(obj Object) Object {
-	length := len(a.Elements)
-	newElements := make([]Object, length)
-	copy(newElements, a.Elements)
-	newElements = append(newElements, obj)
-	newArray := &Array{Elements: newElements}
-	return newArray
+	return &Array{elements: a.elements.push(obj)}
+}
+
+// Assoc a new array with the element at the index replaced by the value,
+// the index may also be the length of the array, which appends the value
+func (a *Array) Assoc(index, value Object) Object {
+	i, ok := indexValue(index)
+	if !ok {
+		return &Error{Message: fmt.Sprintf("array index must be an INTEGER, got %s", index.Type())}
+	}
+	switch {
+	case i == int64(a.Size()):
+		return a.Push(value)
+	case i < 0 || i > int64(a.Size()):
+		return &Error{Message: fmt.Sprintf("array index out of range: %s", index.Inspect())}
+	}
+	return &Array{elements: a.elements.assoc(int(i), value)}
+}
+
+// indexValue the value of an integer used as an index, a BigInteger out of the range of int64 is -1 since it's out of
+// the range of any array or string, ok is false if the object isn't an integer
+func indexValue(o Object) (value int64, ok bool) {
+	switch o := o.(type) {
+	case *Integer:
+		return o.Value, true
+	case *BigInteger:
+		if o.Value.IsInt64() {
+			return o.Value.Int64(), true
+		}
+		return -1, true
+	}
+	return 0, false
 }
@@ -0,0 +1,114 @@
+package object
+
+import (
+	"hash/maphash"
+	"math/big"
+)
+
+// BigInteger an integer out of the range of int64. The arithmetic of Integer promotes its result to a BigInteger
+// when it overflows, and a result of BigInteger which fits in int64 is demoted back to an Integer by NewBigInteger,
+// so every integer value has only one representation. Both of them are of the type INTEGER.
+type BigInteger struct {
+	Value *big.Int
+}
+
+// NewBigInteger the integer of the value, which is an Integer if the value fits in int64
+func NewBigInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: value}
+}
+
+// bigValue the value of an integer as a big.Int, which must not be modified
+func bigValue(o Object) (*big.Int, bool) {
+	switch o := o.(type) {
+	case *Integer:
+		return big.NewInt(o.Value), true
+	case *BigInteger:
+		return o.Value, true
+	}
+	return nil, false
+}
+
+// isZero tells if the object is the integer 0
+func isZero(o Object) bool {
+	switch o := o.(type) {
+	case *Integer:
+		return o.Value == 0
+	case *BigInteger:
+		return o.Value.Sign() == 0
+	}
+	return false
+}
+
+// bigArithmetic apply the operation of big.Int to two integers, or return null if rhs isn't an integer
+func bigArithmetic(operation func(z, x, y *big.Int) *big.Int, lhs Object, rhs Object) Object {
+	x, _ := bigValue(lhs)
+	y, ok := bigValue(rhs)
+	if !ok {
+		return NativeNull
+	}
+	return NewBigInteger(operation(new(big.Int), x, y))
+}
+
+func (b *BigInteger) Type() ObjType {
+	return ObjInteger
+}
+
+func (b *BigInteger) Inspect() string {
+	return b.Value.String()
+}
+
+// HashKey the key of a value which fits in int64 is the key of the Integer of the same value
+func (b *BigInteger) HashKey() HashKey {
+	if b.Value.IsInt64() {
+		return HashKey{Type: ObjInteger, HashValue: b.Value.Int64()}
+	}
+	var hasher maphash.Hash
+	hasher.SetSeed(hashSeed)
+	hasher.WriteByte(byte(b.Value.Sign() + 1))
+	hasher.Write(b.Value.Bytes())
+	return HashKey{Type: ObjInteger, HashValue: int64(hasher.Sum64())}
+}
+
+func (b *BigInteger) Add(o Object) Object {
+	return bigArithmetic((*big.Int).Add, b, o)
+}
+
+func (b *BigInteger) Sub(o Object) Object {
+	return bigArithmetic((*big.Int).Sub, b, o)
+}
+
+func (b *BigInteger) Mul(o Object) Object {
+	return bigArithmetic((*big.Int).Mul, b, o)
+}
+
+// Divide truncates toward zero like Integer, dividing by zero is an error
+func (b *BigInteger) Divide(o Object) Object {
+	if isZero(o) {
+		return newDivisionByZeroError()
+	}
+	return bigArithmetic((*big.Int).Quo, b, o)
+}
+
+func (b *BigInteger) Equal(o Object) *Boolean {
+	other, ok := bigValue(o)
+	return NativeBoolean(ok && b.Value.Cmp(other) == 0)
+}
+
+func (b *BigInteger) NotEqual(o Object) *Boolean {
+	return NativeBoolean(!b.Equal(o).Value)
+}
+
+func (b *BigInteger) Compare(o Object) (int, error) {
+	other, ok := bigValue(o)
+	if !ok {
+		return 0, &NotComparableError{Lhs: b, Rhs: o}
+	}
+	return b.Value.Cmp(other), nil
+}
+
+func (b *BigInteger) Negative() Object {
+	return NewBigInteger(new(big.Int).Neg(b.Value))
+}
@@ -5,6 +5,17 @@ type BuiltInFunction func(objs ...Object) Object
 type BuiltIn struct {
 	Name      string
 	BuiltInFn BuiltInFunction
+	// BudgetFn the function of a built-in running under the budget of its caller, like next which resumes a
+	// generator, it's called instead of BuiltInFn
+	BudgetFn func(budget Budget, objs ...Object) Object
+}
+
+// Call call the built-in function under the budget of the caller
+func (b *BuiltIn) Call(budget Budget, objs ...Object) Object {
+	if b.BudgetFn != nil {
+		return b.BudgetFn(budget, objs...)
+	}
+	return b.BuiltInFn(objs...)
 }
 
 func (b *BuiltIn) Type() ObjType {
@@ -80,4 +80,145 @@ var BuiltIns = []*BuiltIn{
 			return push.Push(objs[1])
 		},
 	},
+
+	{
+		Name: builtInFnNameAssoc,
+		BuiltInFn: func(objs ...Object) Object {
+			if len(objs) != 3 {
+				return newWrongArgumentSizeError(len(objs), 3)
+			}
+
+			obj := objs[0]
+			assoc, ok := obj.(Assoc)
+			if !ok {
+				return newWrongArgumentTypeError(builtInFnNameAssoc, obj.Type())
+			}
+			return assoc.Assoc(objs[1], objs[2])
+		},
+	},
+
+	{
+		Name: builtInFnNameDissoc,
+		BuiltInFn: func(objs ...Object) Object {
+			if len(objs) != 2 {
+				return newWrongArgumentSizeError(len(objs), 2)
+			}
+
+			obj := objs[0]
+			dissoc, ok := obj.(Dissoc)
+			if !ok {
+				return newWrongArgumentTypeError(builtInFnNameDissoc, obj.Type())
+			}
+			return dissoc.Dissoc(objs[1])
+		},
+	},
+
+	{
+		Name: builtInFnNameAdd,
+		BuiltInFn: func(objs ...Object) Object {
+			if len(objs) != 2 {
+				return newWrongArgumentSizeError(len(objs), 2)
+			}
+
+			set, ok := objs[0].(*Set)
+			if !ok {
+				return newWrongArgumentTypeError(builtInFnNameAdd, objs[0].Type())
+			}
+			return set.Add(objs[1])
+		},
+	},
+
+	{
+		Name: builtInFnNameRemove,
+		BuiltInFn: func(objs ...Object) Object {
+			if len(objs) != 2 {
+				return newWrongArgumentSizeError(len(objs), 2)
+			}
+
+			set, ok := objs[0].(*Set)
+			if !ok {
+				return newWrongArgumentTypeError(builtInFnNameRemove, objs[0].Type())
+			}
+			return set.Remove(objs[1])
+		},
+	},
+
+	{
+		Name: builtInFnNameContains,
+		BuiltInFn: func(objs ...Object) Object {
+			if len(objs) != 2 {
+				return newWrongArgumentSizeError(len(objs), 2)
+			}
+
+			container, ok := objs[0].(Container)
+			if !ok {
+				return newWrongArgumentTypeError(builtInFnNameContains, objs[0].Type())
+			}
+			return container.Contains(objs[1])
+		},
+	},
+
+	{
+		Name:      builtInFnNameUnion,
+		BuiltInFn: setAlgebra(builtInFnNameUnion, (*Set).Union),
+	},
+
+	{
+		Name:      builtInFnNameIntersection,
+		BuiltInFn: setAlgebra(builtInFnNameIntersection, (*Set).Intersection),
+	},
+
+	{
+		Name:      builtInFnNameDifference,
+		BuiltInFn: setAlgebra(builtInFnNameDifference, (*Set).Difference),
+	},
+
+	{
+		Name: builtInFnNameIter,
+		BuiltInFn: func(objs ...Object) Object {
+			if len(objs) != 1 {
+				return newWrongArgumentSizeError(len(objs), 1)
+			}
+
+			iterable, ok := objs[0].(Iterable)
+			if !ok {
+				return newWrongArgumentTypeError(builtInFnNameIter, objs[0].Type())
+			}
+			return iterable.Iterator()
+		},
+	},
+
+	{
+		Name: builtInFnNameNext,
+		BudgetFn: func(budget Budget, objs ...Object) Object {
+			if len(objs) != 1 {
+				return newWrongArgumentSizeError(len(objs), 1)
+			}
+
+			iterator, ok := objs[0].(*Iterator)
+			if !ok {
+				return newWrongArgumentTypeError(builtInFnNameNext, objs[0].Type())
+			}
+			return iterator.step(budget)
+		},
+	},
+}
+
+// setAlgebra the builtin of an operation taking two sets
+func setAlgebra(fnName string, operation func(lhs, rhs *Set) *Set) BuiltInFunction {
+	return func(objs ...Object) Object {
+		if len(objs) != 2 {
+			return newWrongArgumentSizeError(len(objs), 2)
+		}
+
+		var sets [2]*Set
+		for i, obj := range objs {
+			set, ok := obj.(*Set)
+			if !ok {
+				return newWrongArgumentTypeError(fnName, obj.Type())
+			}
+			sets[i] = set
+		}
+		return operation(sets[0], sets[1])
+	}
 }
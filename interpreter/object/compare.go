@@ -0,0 +1,41 @@
+package object
+
+import "fmt"
+
+// NotComparableError the two objects have no order between them, they may be elements of the objects being compared,
+// like 1 and "a" for [1] < ["a"]
+type NotComparableError struct {
+	Lhs Object
+	Rhs Object
+}
+
+func (e *NotComparableError) Error() string {
+	return fmt.Sprintf("%s and %s are not comparable", e.Lhs.Type(), e.Rhs.Type())
+}
+
+// Equals the structural equality of two objects, it's Equal of a if a is Equatable, or the identity otherwise,
+// so functions and builtins are equal to themselves only. Objects of different types are never equal.
+func Equals(a, b Object) bool {
+	if equatable, ok := a.(Equatable); ok {
+		return equatable.Equal(b).Value
+	}
+	return a == b
+}
+
+// Compare returns a negative number, zero or a positive number when a is less than, equal to or greater than b,
+// or a NotComparableError if they can't be ordered
+func Compare(a, b Object) (int, error) {
+	comparable, ok := a.(Comparable)
+	if !ok {
+		return 0, &NotComparableError{Lhs: a, Rhs: b}
+	}
+	return comparable.Compare(b)
+}
+
+// NativeBoolean the shared NativeTrue or NativeFalse
+func NativeBoolean(b bool) *Boolean {
+	if b {
+		return NativeTrue
+	}
+	return NativeFalse
+}
@@ -0,0 +1,563 @@
+package object
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// tagName the struct tag which renames a field, `monkey:"name"`, or skips it, `monkey:"-"`
+const tagName = "monkey"
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf(big.Int{})
+)
+
+// FromGo convert a Go value to an object:
+//   - nil and nil pointers to null, and an Object to itself
+//   - bool to Boolean, the integers to Integer, the integers out of the range of int64 and big.Int to BigInteger,
+//     and string to StringObj
+//   - slices and arrays to Array
+//   - maps to Hash, their keys are sorted since a map has no order
+//   - structs to Hash keyed by the names of their exported fields, or the names in the tag `monkey:"name"`,
+//     and the fields tagged `monkey:"-"` are skipped
+//   - funcs to BuiltIn, see NewBuiltIn
+//
+// The other types, like floats and channels, are not supported, neither are the values which contain themselves.
+func FromGo(v any) (Object, error) {
+	obj, err := fromGo(reflect.ValueOf(v), "", make(map[reference]bool))
+	if err != nil {
+		return nil, fmt.Errorf("object: %w", err)
+	}
+	return obj, nil
+}
+
+// ToGo convert the object to the Go value pointed by target, which is the reverse of FromGo.
+// An object converted to an interface, like any, becomes int64, *big.Int, string, bool, nil, []any or
+// map[string]any, or map[any]any if the hash has a key which is not a string.
+// The keys of a hash which don't match any field of a struct are ignored.
+func ToGo(obj Object, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("object: ToGo target must be a non-nil pointer, got [%T]", target)
+	}
+	if err := toGo(obj, v.Elem(), ""); err != nil {
+		return fmt.Errorf("object: %w", err)
+	}
+	return nil
+}
+
+// NewBuiltIn wrap the Go function as a built-in function whose arguments are converted by ToGo
+// and whose result is converted by FromGo. The function may be variadic, and may return nothing, a value,
+// an error, or a value and an error, a non-nil error fails the call. A function whose parameters or result can't
+// be converted is rejected.
+// A BuiltInFunction is wrapped as it is.
+func NewBuiltIn(name string, fn any) (*BuiltIn, error) {
+	switch fn := fn.(type) {
+	case BuiltInFunction:
+		return &BuiltIn{Name: name, BuiltInFn: fn}, nil
+	case func(...Object) Object:
+		return &BuiltIn{Name: name, BuiltInFn: fn}, nil
+	}
+
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("object: built-in function [%s] must be a func, got [%T]", name, fn)
+	}
+	t := v.Type()
+	if err := checkBuiltInType(t); err != nil {
+		return nil, fmt.Errorf("object: built-in function [%s] %w", name, err)
+	}
+
+	builtInFn := func(args ...Object) Object {
+		in, err := builtInArguments(t, args)
+		if err != nil {
+			return &Error{Message: fmt.Sprintf("%s: %s", name, err)}
+		}
+		obj, err := builtInResult(v.Call(in))
+		if err != nil {
+			return &Error{Message: fmt.Sprintf("%s: %s", name, err)}
+		}
+		return obj
+	}
+	return &BuiltIn{Name: name, BuiltInFn: builtInFn}, nil
+}
+
+// checkBuiltInType check that the parameters of the function are converted by toGo, and its result by fromGo
+func checkBuiltInType(t reflect.Type) error {
+	switch {
+	case t.NumOut() > 2,
+		t.NumOut() == 2 && t.Out(1) != errorType:
+		return fmt.Errorf("must return at most a value and an error, got [%s]", t)
+	}
+	for i := 0; i < t.NumIn(); i++ {
+		if !convertible(t.In(i), false, make(map[reflect.Type]bool)) {
+			return fmt.Errorf("has a parameter of unsupported Go type [%s]", t.In(i))
+		}
+	}
+	if t.NumOut() > 0 && t.Out(0) != errorType && !convertible(t.Out(0), true, make(map[reflect.Type]bool)) {
+		return fmt.Errorf("returns an unsupported Go type [%s]", t.Out(0))
+	}
+	return nil
+}
+
+// convertible reports whether the values of the type are converted by fromGo for a result, or by toGo
+// for a parameter, the types being checked are assumed to be convertible so that a recursive type is accepted
+func convertible(t reflect.Type, result bool, checking map[reflect.Type]bool) bool {
+	if t.Implements(objectType) || t == bigIntType || checking[t] {
+		return true
+	}
+	checking[t] = true
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Float32, reflect.Float64:
+		// an integer is converted to a float, but there is no float object
+		return !result
+	case reflect.Interface:
+		// the dynamic value of a result is converted, an argument is converted to an empty interface only
+		return result || t.NumMethod() == 0
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return convertible(t.Elem(), result, checking)
+	case reflect.Map:
+		return convertible(t.Key(), result, checking) && convertible(t.Elem(), result, checking)
+	case reflect.Struct:
+		for _, field := range structFields(t) {
+			if !convertible(t.FieldByIndex(field.index).Type, result, checking) {
+				return false
+			}
+		}
+		return true
+	case reflect.Func:
+		// a func is converted to a built-in function, but not the other way around
+		return result && checkBuiltInType(t) == nil
+	default:
+		return false
+	}
+}
+
+// builtInArguments convert the arguments to the parameters of the function
+func builtInArguments(t reflect.Type, args []Object) ([]reflect.Value, error) {
+	numIn := t.NumIn()
+	if t.IsVariadic() && len(args) < numIn-1 {
+		return nil, fmt.Errorf("wrong number of arguments, expected at least [%d], got [%d]", numIn-1, len(args))
+	}
+	if !t.IsVariadic() && len(args) != numIn {
+		return nil, fmt.Errorf("wrong number of arguments, expected [%d], got [%d]", numIn, len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		paramType := t.In(min(i, numIn-1))
+		if t.IsVariadic() && i >= numIn-1 {
+			paramType = paramType.Elem()
+		}
+		in[i] = reflect.New(paramType).Elem()
+		if err := toGo(arg, in[i], fmt.Sprintf("argument %d", i+1)); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// builtInResult convert the results of the function to an object
+func builtInResult(out []reflect.Value) (Object, error) {
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err := out[len(out)-1]; !err.IsNil() {
+			return nil, err.Interface().(error)
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return NativeNull, nil
+	}
+	return fromGo(out[0], "result", make(map[reference]bool))
+}
+
+// reference a pointer or a map being converted, the type tells apart a struct from its first field
+type reference struct {
+	pointer uintptr
+	typ     reflect.Type
+}
+
+// fromGo convert the value at the path, visiting the references which contain the value
+func fromGo(v reflect.Value, path string, visiting map[reference]bool) (Object, error) {
+	if !v.IsValid() {
+		return NativeNull, nil
+	}
+	if v.Type().Implements(objectType) {
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return NativeNull, nil
+		}
+		return v.Interface().(Object), nil
+	}
+	if v.Type() == bigIntType {
+		value := reflect.New(bigIntType)
+		value.Elem().Set(v)
+		return NewBigInteger(new(big.Int).Set(value.Interface().(*big.Int))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return NativeTrue, nil
+		}
+		return NativeFalse, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return NewBigInteger(new(big.Int).SetUint64(v.Uint())), nil
+		}
+		return &Integer{Value: int64(v.Uint())}, nil
+	case reflect.String:
+		return &StringObj{Value: v.String()}, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return NativeNull, nil
+		}
+		if v.Kind() == reflect.Pointer {
+			leave, err := visit(v, path, visiting)
+			if err != nil {
+				return nil, err
+			}
+			defer leave()
+		}
+		return fromGo(v.Elem(), path, visiting)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NativeNull, nil
+		}
+		elements := make([]Object, v.Len())
+		for i := range elements {
+			element, err := fromGo(v.Index(i), fmt.Sprintf("%s[%d]", path, i), visiting)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return NewArray(elements), nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NativeNull, nil
+		}
+		leave, err := visit(v, path, visiting)
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+		return mapFromGo(v, path, visiting)
+	case reflect.Struct:
+		hash := NewHash()
+		for _, field := range structFields(v.Type()) {
+			value, err := fromGo(v.FieldByIndex(field.index), fieldPath(path, field.name), visiting)
+			if err != nil {
+				return nil, err
+			}
+			key := &StringObj{Value: field.name}
+			hash.Set(key, value)
+		}
+		return hash, nil
+	case reflect.Func:
+		if v.IsNil() {
+			return NativeNull, nil
+		}
+		return NewBuiltIn(strings.TrimPrefix(path, "."), v.Interface())
+	default:
+		return nil, convertError(path, "unsupported Go type [%s]", v.Type())
+	}
+}
+
+// visit mark the pointer or the map as being converted until leave is called, it fails if the value is already
+// being converted, since the value contains itself
+func visit(v reflect.Value, path string, visiting map[reference]bool) (leave func(), err error) {
+	ref := reference{pointer: v.Pointer(), typ: v.Type()}
+	if visiting[ref] {
+		return nil, convertError(path, "cyclic Go value [%s]", v.Type())
+	}
+	visiting[ref] = true
+	return func() {
+		delete(visiting, ref)
+	}, nil
+}
+
+// mapFromGo the pairs are sorted by their keys, since a map has no order
+func mapFromGo(v reflect.Value, path string, visiting map[reference]bool) (Object, error) {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return lessKey(keys[i], keys[j])
+	})
+
+	hash := NewHash()
+	for _, k := range keys {
+		key, err := fromGo(k, path, visiting)
+		if err != nil {
+			return nil, err
+		}
+		hashable, ok := AsHashable(key)
+		if !ok {
+			return nil, convertError(path, "unusable as hash key: %s", key.Type())
+		}
+		value, err := fromGo(v.MapIndex(k), fmt.Sprintf("%s[%s]", path, key.Inspect()), visiting)
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(hashable, value)
+	}
+	return hash, nil
+}
+
+// lessKey order the integers by their values, and the other keys by their formats
+func lessKey(a, b reflect.Value) bool {
+	switch {
+	case a.CanInt() && b.CanInt():
+		return a.Int() < b.Int()
+	case a.CanUint() && b.CanUint():
+		return a.Uint() < b.Uint()
+	default:
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	}
+}
+
+func toGo(obj Object, v reflect.Value, path string) error {
+	if v.Type().Implements(objectType) && reflect.TypeOf(obj).AssignableTo(v.Type()) {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	if v.Type() == bigIntType {
+		value, ok := bigValue(obj)
+		if !ok {
+			return convertError(path, "cannot convert %s to %s", obj.Type(), v.Type())
+		}
+		v.Addr().Interface().(*big.Int).Set(value)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			break
+		}
+		natural, err := naturalGo(obj, path)
+		if err != nil {
+			return err
+		}
+		if natural == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(natural))
+		}
+		return nil
+	case reflect.Pointer:
+		if obj == NativeNull {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		elem := reflect.New(v.Type().Elem())
+		if err := toGo(obj, elem.Elem(), path); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Bool:
+		if boolean, ok := obj.(*Boolean); ok {
+			v.SetBool(boolean.Value)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if integer, ok := obj.(*Integer); ok {
+			if v.OverflowInt(integer.Value) {
+				return convertError(path, "%d overflows %s", integer.Value, v.Type())
+			}
+			v.SetInt(integer.Value)
+			return nil
+		}
+		if _, ok := obj.(*BigInteger); ok {
+			return convertError(path, "%s overflows %s", obj.Inspect(), v.Type())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if integer, ok := obj.(*Integer); ok {
+			if integer.Value < 0 || v.OverflowUint(uint64(integer.Value)) {
+				return convertError(path, "%d overflows %s", integer.Value, v.Type())
+			}
+			v.SetUint(uint64(integer.Value))
+			return nil
+		}
+		if integer, ok := obj.(*BigInteger); ok {
+			if !integer.Value.IsUint64() || v.OverflowUint(integer.Value.Uint64()) {
+				return convertError(path, "%s overflows %s", obj.Inspect(), v.Type())
+			}
+			v.SetUint(integer.Value.Uint64())
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if integer, ok := obj.(*Integer); ok {
+			v.SetFloat(float64(integer.Value))
+			return nil
+		}
+		if integer, ok := obj.(*BigInteger); ok {
+			f, _ := new(big.Float).SetInt(integer.Value).Float64()
+			v.SetFloat(f)
+			return nil
+		}
+	case reflect.String:
+		if str, ok := obj.(*StringObj); ok {
+			v.SetString(str.Value)
+			return nil
+		}
+	case reflect.Slice, reflect.Array:
+		if obj == NativeNull && v.Kind() == reflect.Slice {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		array, ok := obj.(*Array)
+		if !ok {
+			break
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), array.Size(), array.Size()))
+		} else if array.Size() > v.Len() {
+			return convertError(path, "array of %d elements overflows %s", array.Size(), v.Type())
+		}
+		for i, element := range array.Elements() {
+			if err := toGo(element, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if obj == NativeNull {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		hash, ok := obj.(*Hash)
+		if !ok {
+			break
+		}
+		m := reflect.MakeMapWithSize(v.Type(), hash.Len())
+		for _, pair := range hash.Pairs() {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := toGo(pair.Key, key, path); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := toGo(pair.Value, value, fmt.Sprintf("%s[%s]", path, pair.Key.Inspect())); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		hash, ok := obj.(*Hash)
+		if !ok {
+			break
+		}
+		for _, field := range structFields(v.Type()) {
+			key := &StringObj{Value: field.name}
+			pair, ok := hash.Get(key)
+			if !ok {
+				continue
+			}
+			if err := toGo(pair.Value, v.FieldByIndex(field.index), fieldPath(path, field.name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return convertError(path, "cannot convert %s to %s", obj.Type(), v.Type())
+}
+
+// naturalGo the Go value which the object is converted to for an interface
+func naturalGo(obj Object, path string) (any, error) {
+	switch obj := obj.(type) {
+	case *Null:
+		return nil, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Integer:
+		return obj.Value, nil
+	case *BigInteger:
+		return new(big.Int).Set(obj.Value), nil
+	case *StringObj:
+		return obj.Value, nil
+	case *Array:
+		elements := make([]any, obj.Size())
+		for i, element := range obj.Elements() {
+			natural, err := naturalGo(element, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = natural
+		}
+		return elements, nil
+	case *Hash:
+		stringKeys := make(map[string]any, obj.Len())
+		anyKeys := make(map[any]any, obj.Len())
+		for _, pair := range obj.Pairs() {
+			key, err := naturalGo(pair.Key, path)
+			if err != nil {
+				return nil, err
+			}
+			value, err := naturalGo(pair.Value, fmt.Sprintf("%s[%s]", path, pair.Key.Inspect()))
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := key.(string); ok {
+				stringKeys[s] = value
+			}
+			anyKeys[key] = value
+		}
+		if len(stringKeys) == len(anyKeys) {
+			return stringKeys, nil
+		}
+		return anyKeys, nil
+	default:
+		return nil, convertError(path, "cannot convert %s to a Go value", obj.Type())
+	}
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields the exported fields of the struct in their order, the fields of the embedded structs are not flattened
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup(tagName); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, index: field.Index})
+	}
+	return fields
+}
+
+func fieldPath(path, name string) string {
+	return path + "." + name
+}
+
+// convertError the error of the value at the path, like tags[0] or argument 1.name
+func convertError(path string, format string, a ...any) error {
+	if path == "" {
+		return fmt.Errorf(format, a...)
+	}
+	return fmt.Errorf("%s: "+format, append([]any{strings.TrimPrefix(path, ".")}, a...)...)
+}
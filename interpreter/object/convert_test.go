@@ -0,0 +1,283 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	City string `monkey:"city"`
+	Zip  *int   `monkey:"zip"`
+}
+
+type user struct {
+	Name     string `monkey:"name"`
+	Age      uint8
+	Admin    bool     `monkey:"admin"`
+	Tags     []string `monkey:"tags"`
+	Address  address  `monkey:"address"`
+	Password string   `monkey:"-"`
+	internal int
+}
+
+func TestFromGo(t *testing.T) {
+	zip := 10001
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint16(7), "7"},
+		{true, "true"},
+		{"monkey", "monkey"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{[]any{1, "a", nil}, "[1, a, null]"},
+		{map[string]int{"b": 2, "a": 1}, "{a:1, b:2}"},
+		{map[int]string{10: "x", 2: "y"}, "{2:y, 10:x}"},
+		{(*int)(nil), "null"},
+		{&zip, "10001"},
+		{&Integer{Value: 5}, "5"},
+		{uint64(1 << 63), "9223372036854775808"},
+		{new(big.Int).Lsh(big.NewInt(-1), 70), "-1180591620717411303424"},
+		{*big.NewInt(7), "7"},
+		// a value shared by two fields is not a cycle
+		{struct{ A, B *int }{&zip, &zip}, "{A:10001, B:10001}"},
+		{&node{Value: 1, Next: &node{Value: 2}}, "{Value:1, Next:{Value:2, Next:null}}"},
+		{
+			user{Name: "ada", Age: 36, Tags: []string{"x"}, Address: address{City: "NYC", Zip: &zip}, Password: "secret"},
+			"{name:ada, Age:36, admin:false, tags:[x], address:{city:NYC, zip:10001}}",
+		},
+	}
+
+	for i, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Fatalf("test case [%d] unexpected error [%s]", i, err)
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("test case [%d] expected [%s], got [%s]", i, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+type node struct {
+	Value int
+	Next  *node
+}
+
+// newCycle a list of two nodes pointing to each other
+func newCycle() *node {
+	first := &node{Value: 1}
+	first.Next = &node{Value: 2, Next: first}
+	return first
+}
+
+func selfMap() map[string]any {
+	m := map[string]any{}
+	m["self"] = m
+	return m
+}
+
+func TestFromGoErrors(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{1.5, "object: unsupported Go type [float64]"},
+		{make(chan int), "object: unsupported Go type [chan int]"},
+		{[]any{1, 2.5}, "object: [1]: unsupported Go type [float64]"},
+		{map[string]any{"a": []complex64{1}}, "object: [a][0]: unsupported Go type [complex64]"},
+		{struct{ Score float32 }{}, "object: Score: unsupported Go type [float32]"},
+		{newCycle(), "object: Next.Next: cyclic Go value [*object.node]"},
+		{selfMap(), "object: [self]: cyclic Go value [map[string]interface {}]"},
+	}
+
+	for i, tt := range tests {
+		_, err := FromGo(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("test case [%d] expected error [%s], got [%v]", i, tt.expected, err)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	zip := 10001
+	u := user{Name: "ada", Age: 36, Admin: true, Tags: []string{"x", "y"}, Address: address{City: "NYC", Zip: &zip}}
+	obj, err := FromGo(u)
+	if err != nil {
+		t.Fatalf("unexpected error [%s]", err)
+	}
+	var actual user
+	if err = ToGo(obj, &actual); err != nil {
+		t.Fatalf("unexpected error [%s]", err)
+	}
+	if !reflect.DeepEqual(actual, u) {
+		t.Fatalf("expected [%+v], got [%+v]", u, actual)
+	}
+
+	var natural any
+	obj, _ = FromGo(map[string]any{"a": []int{1}, "b": nil, "c": "s"})
+	if err = ToGo(obj, &natural); err != nil {
+		t.Fatalf("unexpected error [%s]", err)
+	}
+	expected := map[string]any{"a": []any{int64(1)}, "b": nil, "c": "s"}
+	if !reflect.DeepEqual(natural, expected) {
+		t.Fatalf("expected [%#v], got [%#v]", expected, natural)
+	}
+
+	obj, _ = FromGo(map[int]bool{1: true})
+	if err = ToGo(obj, &natural); err != nil || !reflect.DeepEqual(natural, map[any]any{int64(1): true}) {
+		t.Fatalf("expected a map with int64 keys, got [%#v] [%v]", natural, err)
+	}
+
+	var counts map[string]int
+	obj, _ = FromGo(map[string]int{"a": 1})
+	if err = ToGo(obj, &counts); err != nil || counts["a"] != 1 {
+		t.Fatalf("expected [map[a:1]], got [%v] [%v]", counts, err)
+	}
+
+	var u64 uint64
+	if err = ToGo(mustFromGo(t, uint64(1<<64-1)), &u64); err != nil || u64 != 1<<64-1 {
+		t.Fatalf("expected [%d], got [%d] [%v]", uint64(1<<64-1), u64, err)
+	}
+	huge := new(big.Int).Lsh(big.NewInt(1), 100)
+	var b *big.Int
+	if err = ToGo(mustFromGo(t, huge), &b); err != nil || b.Cmp(huge) != 0 {
+		t.Fatalf("expected [%s], got [%s] [%v]", huge, b, err)
+	}
+	if err = ToGo(mustFromGo(t, huge), &natural); err != nil || natural.(*big.Int).Cmp(huge) != 0 {
+		t.Fatalf("expected [%s], got [%v] [%v]", huge, natural, err)
+	}
+
+	var integer *Integer
+	if err = ToGo(&Integer{Value: 3}, &integer); err != nil || integer.Value != 3 {
+		t.Fatalf("expected the object itself, got [%v] [%v]", integer, err)
+	}
+}
+
+func TestToGoErrors(t *testing.T) {
+	var i8 int8
+	var u uint
+	var s string
+	var ints []int
+	var usr user
+	tests := []struct {
+		obj      Object
+		target   any
+		expected string
+	}{
+		{&Integer{Value: 1}, s, "object: ToGo target must be a non-nil pointer, got [string]"},
+		{&Integer{Value: 300}, &i8, "object: 300 overflows int8"},
+		{&Integer{Value: -1}, &u, "object: -1 overflows uint"},
+		{mustFromGo(t, uint64(1<<63)), &i8, "object: 9223372036854775808 overflows int8"},
+		{&Integer{Value: 1}, &s, "object: cannot convert INTEGER to string"},
+		{NewArray([]Object{&Integer{Value: 1}, NativeTrue}), &ints, "object: [1]: cannot convert BOOLEAN to int"},
+		{mustFromGo(t, map[string]any{"tags": []any{1}}), &usr, "object: tags[0]: cannot convert INTEGER to string"},
+	}
+
+	for i, tt := range tests {
+		err := ToGo(tt.obj, tt.target)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("test case [%d] expected error [%s], got [%v]", i, tt.expected, err)
+		}
+	}
+}
+
+func TestNewBuiltIn(t *testing.T) {
+	join := func(sep string, parts ...string) string {
+		return strings.Join(parts, sep)
+	}
+	divide := func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	}
+	greet := func(u user) map[string]any {
+		return map[string]any{"greeting": "hello " + u.Name, "admin": u.Admin}
+	}
+	tests := []struct {
+		fn       any
+		args     []Object
+		expected string
+	}{
+		{join, []Object{&StringObj{Value: "-"}, &StringObj{Value: "a"}, &StringObj{Value: "b"}}, "a-b"},
+		{join, []Object{&StringObj{Value: "-"}}, ""},
+		{join, []Object{}, "join: wrong number of arguments, expected at least [1], got [0]"},
+		{divide, []Object{&Integer{Value: 7}, &Integer{Value: 2}}, "3"},
+		{divide, []Object{&Integer{Value: 7}, &Integer{Value: 0}}, "divide: division by zero"},
+		{divide, []Object{&Integer{Value: 7}}, "divide: wrong number of arguments, expected [2], got [1]"},
+		{divide, []Object{&Integer{Value: 7}, NativeNull}, "divide: argument 2: cannot convert NULL to int"},
+		{greet, []Object{mustFromGo(t, user{Name: "ada", Admin: true})}, "{admin:true, greeting:hello ada}"},
+		{func() {}, nil, "null"},
+		{func(args ...Object) Object { return &Integer{Value: int64(len(args))} }, []Object{NativeNull}, "1"},
+	}
+
+	names := []string{"join", "join", "join", "divide", "divide", "divide", "divide", "greet", "nothing", "count"}
+	for i, tt := range tests {
+		builtIn, err := NewBuiltIn(names[i], tt.fn)
+		if err != nil {
+			t.Fatalf("test case [%d] unexpected error [%s]", i, err)
+		}
+		obj := builtIn.BuiltInFn(tt.args...)
+		if obj.Inspect() != tt.expected {
+			t.Errorf("test case [%d] expected [%s], got [%s]", i, tt.expected, obj.Inspect())
+		}
+	}
+
+	if _, err := NewBuiltIn("bad", 1); err == nil {
+		t.Errorf("expected an error for a non-func")
+	}
+	if _, err := NewBuiltIn("bad", func() (int, int) { return 0, 0 }); err == nil {
+		t.Errorf("expected an error for a func returning two values")
+	}
+
+	// the types which can't be converted are rejected when the function is registered
+	unsupported := []struct {
+		fn       any
+		expected string
+	}{
+		{func() float64 { return 0 }, "object: built-in function [bad] returns an unsupported Go type [float64]"},
+		{func(ch chan int) {}, "object: built-in function [bad] has a parameter of unsupported Go type [chan int]"},
+		{func(f func()) {}, "object: built-in function [bad] has a parameter of unsupported Go type [func()]"},
+		{func() ([]float32, error) { return nil, nil }, "object: built-in function [bad] returns an unsupported Go type [[]float32]"},
+		{func(xs ...complex64) {}, "object: built-in function [bad] has a parameter of unsupported Go type [[]complex64]"},
+		{func() struct{ C chan int } { return struct{ C chan int }{} }, "object: built-in function [bad] returns an unsupported Go type [struct { C chan int }]"},
+		{func() func() float64 { return nil }, "object: built-in function [bad] returns an unsupported Go type [func() float64]"},
+	}
+	for i, tt := range unsupported {
+		_, err := NewBuiltIn("bad", tt.fn)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("test case [%d] expected error [%s], got [%v]", i, tt.expected, err)
+		}
+	}
+
+	// the supported types include the recursive ones, the floats of the parameters and the funcs of the results
+	supported := []any{
+		func(n *node) *node { return n },
+		func(x float64) int64 { return int64(x) },
+		func() func(int) int { return nil },
+		func(v any) fmt.Stringer { return nil },
+		func() error { return nil },
+	}
+	for i, fn := range supported {
+		if _, err := NewBuiltIn("good", fn); err != nil {
+			t.Errorf("test case [%d] unexpected error [%s]", i, err)
+		}
+	}
+}
+
+func mustFromGo(t *testing.T, v any) Object {
+	t.Helper()
+	obj, err := FromGo(v)
+	if err != nil {
+		t.Fatalf("unexpected error [%s]", err)
+	}
+	return obj
+}
@@ -1,36 +1,72 @@
 package object
 
 const (
-	builtInFnNameLen   = "len"
-	builtInFnNameFirst = "first"
-	builtInFnNameLast  = "last"
-	builtInFnNameRest  = "rest"
-	builtInFnNamePush  = "push"
-)
+	builtInFnNameLen    = "len"
+	builtInFnNameFirst  = "first"
+	builtInFnNameLast   = "last"
+	builtInFnNameRest   = "rest"
+	builtInFnNamePush   = "push"
+	builtInFnNameAssoc  = "assoc"
+	builtInFnNameDissoc = "dissoc"
 
-var id int
+	builtInFnNameAdd          = "add"
+	builtInFnNameRemove       = "remove"
+	builtInFnNameContains     = "contains"
+	builtInFnNameUnion        = "union"
+	builtInFnNameIntersection = "intersection"
+	builtInFnNameDifference   = "difference"
 
-var globalEnv *Environment
+	builtInFnNameIter = "iter"
+	builtInFnNameNext = "next"
+)
 
+// NewEnvironment a nested environment of the parent, or the top level environment of a new program if the parent is nil.
+// Every program has its own global environment holding the builtins, and its own counter of the environments,
+// so that two programs never share any state and can run in parallel.
 func NewEnvironment(parent *Environment) *Environment {
-	id++
 	if parent == nil {
-		parent = globalEnv
+		parent = newGlobalEnvironment()
+	}
+	*parent.counter++
+	return &Environment{
+		name:    *parent.counter,
+		store:   make(map[string]Object),
+		parent:  parent,
+		counter: parent.counter,
 	}
+}
+
+// NewFrame a frame of a function call or an iteration of a comprehension, whose bindings are kept in slots
+// named by the names, see ast.Resolve
+func NewFrame(parent *Environment, names []string) *Environment {
+	*parent.counter++
 	return &Environment{
-		name:   id,
-		store:  make(map[string]Object),
-		parent: parent,
+		name:    *parent.counter,
+		names:   names,
+		slots:   make([]Object, len(names)),
+		parent:  parent,
+		counter: parent.counter,
 	}
 }
 
 type Environment struct {
-	name   int
-	store  map[string]Object
+	name  int
+	store map[string]Object
+	// names and slots the bindings of a frame, a slot is nil until its binding is set
+	names  []string
+	slots  []Object
 	parent *Environment
+	// counter the number of environments created for the program, shared by all its environments
+	counter *int
 }
 
+// Get the value bound to the name in the environment or its ancestors, it's slower than Slot
 func (env *Environment) Get(name string) (Object, bool) {
+	for i, n := range env.names {
+		if n == name && env.slots[i] != nil {
+			return env.slots[i], true
+		}
+	}
 	obj, ok := env.store[name]
 	if !ok && env.parent != nil {
 		obj, ok = env.parent.Get(name)
@@ -38,18 +74,52 @@ func (env *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// Set bind the value to the name, in its slot if the environment is a frame holding the name
 func (env *Environment) Set(name string, obj Object) {
+	for i, n := range env.names {
+		if n == name {
+			env.slots[i] = obj
+			return
+		}
+	}
+	if env.store == nil {
+		env.store = make(map[string]Object)
+	}
 	env.store[name] = obj
 }
 
-func init() {
-	globalEnv = &Environment{
-		name:   0,
-		store:  make(map[string]Object),
-		parent: nil,
+// Slot the value in the slot of the frame which is depth frames above the environment,
+// it's nil if the slot is not set or doesn't exist
+func (env *Environment) Slot(depth, slot int) Object {
+	for ; depth > 0 && env != nil; depth-- {
+		env = env.parent
+	}
+	if env == nil || slot >= len(env.slots) {
+		return nil
+	}
+	return env.slots[slot]
+}
+
+// SetSlot set the value of the slot of the frame, it reports false if the slot doesn't exist
+func (env *Environment) SetSlot(slot int, obj Object) bool {
+	if slot >= len(env.slots) {
+		return false
+	}
+	env.slots[slot] = obj
+	return true
+}
+
+// newGlobalEnvironment the environment holding the builtins, which is the root of all the environments of a program
+func newGlobalEnvironment() *Environment {
+	globalEnv := &Environment{
+		name:    0,
+		store:   make(map[string]Object),
+		parent:  nil,
+		counter: new(int),
 	}
 
 	for _, builtIn := range BuiltIns {
 		globalEnv.Set(builtIn.Name, builtIn)
 	}
+	return globalEnv
 }
@@ -1,6 +1,56 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
+
+// Frame a frame of the call stack, which is the function being called and where it is called
+type Frame struct {
+	// Function the name the function is called by, like fib for fib(10), or the callee expression
+	Function string
+	// Line and Column the position of the call
+	Line   int
+	Column int
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s (line %d, column %d)", f.Function, f.Line, f.Column)
+}
+
+// maxRepeatedFrames the number of the consecutive identical frames shown by a traceback, the following ones are
+// folded into a single line, so that a runaway recursion doesn't print thousands of lines
+const maxRepeatedFrames = 3
+
+// Traceback the message of the error followed by its call stack, the innermost call last
+func (e *Error) Traceback() string {
+	if len(e.Stack) == 0 {
+		return e.Message
+	}
+	buffer := strings.Builder{}
+	buffer.WriteString("Traceback (most recent call last):\n")
+	for i := 0; i < len(e.Stack); {
+		repeated := 1
+		for i+repeated < len(e.Stack) && e.Stack[i+repeated] == e.Stack[i] {
+			repeated++
+		}
+		for j := 0; j < min(repeated, maxRepeatedFrames); j++ {
+			buffer.WriteString("  at ")
+			buffer.WriteString(e.Stack[i].String())
+			buffer.WriteString("\n")
+		}
+		if repeated > maxRepeatedFrames {
+			buffer.WriteString(fmt.Sprintf("  ... previous frame repeated %d more times\n", repeated-maxRepeatedFrames))
+		}
+		i += repeated
+	}
+	buffer.WriteString(e.Message)
+	return buffer.String()
+}
+
+func newDivisionByZeroError() *Error {
+	return &Error{Message: "division by zero"}
+}
 
 func newWrongArgumentSizeError(actualArgumentSize, expectedArgumentSize int) Object {
 	return &Error{
@@ -13,3 +63,7 @@ func newWrongArgumentTypeError(fnName string, actualTypeName ObjType) Object {
 		Message: fmt.Sprintf("argument to `%s` not supported, got %s", fnName, actualTypeName),
 	}
 }
+
+func newUnusableHashKeyError(key Object) *Error {
+	return &Error{Message: fmt.Sprintf("unusable as hash key: %s", key.Type())}
+}
@@ -24,16 +24,17 @@ type Divide interface {
 	Divide(object Object) Object
 }
 
+// Equatable the operation of the infix operators == and !=, an object of another type is never equal
 type Equatable interface {
 	Object
 	Equal(Object) *Boolean
 	NotEqual(Object) *Boolean
 }
 
+// Comparable the operation of the infix operators < and >, see Compare
 type Comparable interface {
 	Object
-	GreaterThan(Object) *Boolean
-	LessThan(Object) *Boolean
+	Compare(Object) (int, error)
 }
 
 type Negative interface {
@@ -66,3 +67,21 @@ type List interface {
 	First() Object
 	Last() Object
 }
+
+// Assoc is implemented by the collections which can be updated by a key, returning a new collection
+type Assoc interface {
+	Object
+	Assoc(key, value Object) Object
+}
+
+// Dissoc is implemented by the collections which can remove a key, returning a new collection
+type Dissoc interface {
+	Object
+	Dissoc(key Object) Object
+}
+
+// Container is implemented by the collections which support the operator in
+type Container interface {
+	Object
+	Contains(element Object) Object
+}
@@ -0,0 +1,196 @@
+package object
+
+import "math/bits"
+
+const (
+	hamtBits = 5
+	hamtMask = 1<<hamtBits - 1
+)
+
+// hamt a persistent hash array mapped trie from the keys to ints, every node holds up to 32 entries
+// indexed by 5 bits of the hash, and only allocates the entries which are present as told by its bitmap.
+// The hash only tells where a key is, two keys are the same only if they are equal, so the keys whose hashes
+// collide are all kept, in a collision node below the last level if the hashes are the same all the way down.
+// Like the vector, a hamt is a value and the operations copy only the path to the entry they change.
+type hamt struct {
+	root *hamtNode
+	size int
+}
+
+type hamtNode struct {
+	bitmap  uint32
+	entries []hamtEntry
+}
+
+// hamtEntry a key and its value, or a child node if child is not nil
+type hamtEntry struct {
+	hash  uint64
+	key   Object
+	value int
+	child *hamtNode
+}
+
+func (e hamtEntry) matches(hash uint64, key Object) bool {
+	return e.hash == hash && Equals(e.key, key)
+}
+
+// hashOf mix the type and the value of the hash key, so that the 5 bits of every level are spread evenly
+func hashOf(key Hashable) uint64 {
+	return mix(key.HashKey())
+}
+
+func mix(key HashKey) uint64 {
+	h := uint64(key.HashValue)
+	for i := 0; i < len(key.Type); i++ {
+		h = (h ^ uint64(key.Type[i])) * 1099511628211
+	}
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+func (m hamt) get(hash uint64, key Object) (int, bool) {
+	if m.root == nil {
+		return 0, false
+	}
+	return m.root.get(0, hash, key)
+}
+
+func (m hamt) set(hash uint64, key Object, value int) hamt {
+	root := m.root
+	if root == nil {
+		root = &hamtNode{}
+	}
+	root, added := root.set(0, hamtEntry{hash: hash, key: key, value: value})
+	if added {
+		m.size++
+	}
+	m.root = root
+	return m
+}
+
+func (m hamt) delete(hash uint64, key Object) hamt {
+	if m.root == nil {
+		return m
+	}
+	root, removed := m.root.delete(0, hash, key)
+	if removed {
+		m.size--
+	}
+	m.root = root
+	return m
+}
+
+// position the bit of the hash at the level, and the index of its entry among the present ones
+func (n *hamtNode) position(shift uint, hash uint64) (uint32, int) {
+	bit := uint32(1) << ((hash >> shift) & hamtMask)
+	return bit, bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *hamtNode) get(shift uint, hash uint64, key Object) (int, bool) {
+	for shift < 64 {
+		bit, i := n.position(shift, hash)
+		if n.bitmap&bit == 0 {
+			return 0, false
+		}
+		entry := n.entries[i]
+		if entry.child == nil {
+			return entry.value, entry.matches(hash, key)
+		}
+		n, shift = entry.child, shift+hamtBits
+	}
+	for _, entry := range n.entries {
+		if entry.matches(hash, key) {
+			return entry.value, true
+		}
+	}
+	return 0, false
+}
+
+// set a node with the entry added or replacing the entry of its key, and whether it's added
+func (n *hamtNode) set(shift uint, entry hamtEntry) (*hamtNode, bool) {
+	if shift >= 64 {
+		for i, e := range n.entries {
+			if e.matches(entry.hash, entry.key) {
+				return n.replace(i, entry), false
+			}
+		}
+		return &hamtNode{entries: append(n.entries[:len(n.entries):len(n.entries)], entry)}, true
+	}
+
+	bit, i := n.position(shift, entry.hash)
+	if n.bitmap&bit == 0 {
+		entries := make([]hamtEntry, len(n.entries)+1)
+		copy(entries, n.entries[:i])
+		entries[i] = entry
+		copy(entries[i+1:], n.entries[i:])
+		return &hamtNode{bitmap: n.bitmap | bit, entries: entries}, true
+	}
+
+	existing := n.entries[i]
+	switch {
+	case existing.child != nil:
+		child, added := existing.child.set(shift+hamtBits, entry)
+		return n.replace(i, hamtEntry{child: child}), added
+	case existing.matches(entry.hash, entry.key):
+		return n.replace(i, entry), false
+	}
+	// two keys share the bits of this level, push both of them down into a new node, which is a collision node
+	// if their hashes are the same
+	child, _ := (&hamtNode{}).set(shift+hamtBits, existing)
+	child, _ = child.set(shift+hamtBits, entry)
+	return n.replace(i, hamtEntry{child: child}), true
+}
+
+// delete a node without the entry of the key, and whether it was present
+func (n *hamtNode) delete(shift uint, hash uint64, key Object) (*hamtNode, bool) {
+	if shift >= 64 {
+		for i, e := range n.entries {
+			if e.matches(hash, key) {
+				return n.remove(0, i), true
+			}
+		}
+		return n, false
+	}
+
+	bit, i := n.position(shift, hash)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	existing := n.entries[i]
+	if existing.child == nil {
+		if !existing.matches(hash, key) {
+			return n, false
+		}
+		return n.remove(bit, i), true
+	}
+
+	child, removed := existing.child.delete(shift+hamtBits, hash, key)
+	switch {
+	case !removed:
+		return n, false
+	case len(child.entries) == 0:
+		return n.remove(bit, i), true
+	case len(child.entries) == 1 && child.entries[0].child == nil:
+		// a single key left in the child doesn't need a node of its own
+		return n.replace(i, child.entries[0]), true
+	}
+	return n.replace(i, hamtEntry{child: child}), true
+}
+
+func (n *hamtNode) replace(i int, entry hamtEntry) *hamtNode {
+	entries := make([]hamtEntry, len(n.entries))
+	copy(entries, n.entries)
+	entries[i] = entry
+	return &hamtNode{bitmap: n.bitmap, entries: entries}
+}
+
+func (n *hamtNode) remove(bit uint32, i int) *hamtNode {
+	entries := make([]hamtEntry, len(n.entries)-1)
+	copy(entries, n.entries[:i])
+	copy(entries[i:], n.entries[i+1:])
+	return &hamtNode{bitmap: n.bitmap &^ bit, entries: entries}
+}
@@ -6,8 +6,27 @@ import (
 	"strings"
 )
 
+// Hash keeps its pairs in insertion order, so that Inspect and iteration are deterministic.
+// Setting a key which is already present replaces its value and keeps its original position.
+//
+// The pairs are kept in a persistent vector in their order, and a hamt maps every key to its position, so assoc
+// and dissoc return a new hash in near constant time sharing the pairs with the original one.
+// Dissoc leaves a hole in the vector, which is compacted once the holes outnumber the pairs.
+// The hash of a key only narrows down where it is, the keys are told apart by Equals, so keys whose hashes
+// collide are kept side by side and never overwrite each other.
 type Hash struct {
-	Pairs map[HashKey]*HashPair
+	index hamt
+	pairs vector[hashEntry]
+}
+
+// hashEntry a pair and the hash of its key, the pair is nil if the key was removed
+type hashEntry struct {
+	hash uint64
+	pair *HashPair
+}
+
+func NewHash() *Hash {
+	return &Hash{}
 }
 
 func (h *Hash) Type() ObjType {
@@ -18,10 +37,10 @@ func (h *Hash) Inspect() string {
 	buffer := bytes.Buffer{}
 	buffer.WriteString("{")
 
-	elements := make([]string, 0)
-	for _, v := range h.Pairs {
+	elements := make([]string, 0, h.Len())
+	for _, v := range h.Pairs() {
 		elements = append(elements, fmt.Sprintf("%s:%s",
-			v.Value.Inspect(), v.Value.Inspect()))
+			v.Key.Inspect(), v.Value.Inspect()))
 	}
 
 	buffer.WriteString(strings.Join(elements, ", "))
@@ -29,15 +48,147 @@ func (h *Hash) Inspect() string {
 	return buffer.String()
 }
 
+// Equal the hashes have the same keys and the values of each key are equal, regardless of the order of the pairs
+func (h *Hash) Equal(o Object) *Boolean {
+	other, ok := o.(*Hash)
+	if !ok || h.Len() != other.Len() {
+		return NativeFalse
+	}
+	for _, entry := range h.entries() {
+		otherPair, ok := other.get(entry.hash, entry.pair.Key)
+		if !ok || !Equals(entry.pair.Value, otherPair.Value) {
+			return NativeFalse
+		}
+	}
+	return NativeTrue
+}
+
+func (h *Hash) NotEqual(o Object) *Boolean {
+	return NativeBoolean(!h.Equal(o).Value)
+}
+
 func (h *Hash) Index(object Object) Object {
-	hashable, ok := object.(Hashable)
+	hashable, ok := AsHashable(object)
 	if !ok {
-		return &Error{Message: fmt.Sprintf("unusable as hash key: %s", object.Type())}
+		return newUnusableHashKeyError(object)
 	}
-	o, ok := h.Pairs[hashable.HashKey()]
+	o, ok := h.Get(hashable)
 	if ok {
 		return o.Value
 	} else {
 		return NativeNull
 	}
 }
+
+// Contains tells if the key is in the hash
+func (h *Hash) Contains(key Object) Object {
+	hashable, ok := AsHashable(key)
+	if !ok {
+		return newUnusableHashKeyError(key)
+	}
+	_, ok = h.Get(hashable)
+	return NativeBoolean(ok)
+}
+
+// Set add the pair to the end of the hash, or replace the value of the key in place if it is already present
+func (h *Hash) Set(key Hashable, value Object) {
+	h.set(hashOf(key), &HashPair{Key: key, Value: value})
+}
+
+func (h *Hash) set(hash uint64, pair *HashPair) {
+	if i, ok := h.index.get(hash, pair.Key); ok {
+		h.pairs = h.pairs.assoc(i, hashEntry{hash: hash, pair: pair})
+		return
+	}
+	h.index = h.index.set(hash, pair.Key, h.pairs.size())
+	h.pairs = h.pairs.push(hashEntry{hash: hash, pair: pair})
+}
+
+// Merge set every pair of other in its order, the pairs of other override the pairs of h
+func (h *Hash) Merge(other *Hash) {
+	for _, entry := range other.entries() {
+		h.set(entry.hash, entry.pair)
+	}
+}
+
+func (h *Hash) Get(key Hashable) (*HashPair, bool) {
+	return h.get(hashOf(key), key)
+}
+
+func (h *Hash) get(hash uint64, key Object) (*HashPair, bool) {
+	i, ok := h.index.get(hash, key)
+	if !ok {
+		return nil, false
+	}
+	return h.pairs.get(i).pair, true
+}
+
+func (h *Hash) Len() int {
+	return h.index.size
+}
+
+// Pairs returns the pairs in insertion order
+func (h *Hash) Pairs() []*HashPair {
+	pairs := make([]*HashPair, 0, h.Len())
+	for _, entry := range h.entries() {
+		pairs = append(pairs, entry.pair)
+	}
+	return pairs
+}
+
+// Assoc a new hash with the key set to the value, h is not modified
+func (h *Hash) Assoc(key, value Object) Object {
+	hashable, ok := AsHashable(key)
+	if !ok {
+		return newUnusableHashKeyError(key)
+	}
+	hash := &Hash{index: h.index, pairs: h.pairs}
+	hash.Set(hashable, value)
+	return hash
+}
+
+// Dissoc a new hash without the key, h is not modified
+func (h *Hash) Dissoc(key Object) Object {
+	hashable, ok := AsHashable(key)
+	if !ok {
+		return newUnusableHashKeyError(key)
+	}
+	return h.dissoc(hashOf(hashable), key)
+}
+
+func (h *Hash) dissoc(hash uint64, key Object) *Hash {
+	i, ok := h.index.get(hash, key)
+	if !ok {
+		return h
+	}
+	result := &Hash{index: h.index.delete(hash, key), pairs: h.pairs.assoc(i, hashEntry{})}
+	if holes := result.pairs.size() - result.Len(); holes > vectorWidth && holes > result.Len() {
+		result.compact()
+	}
+	return result
+}
+
+// entries the entries of the pairs which are present, in insertion order
+func (h *Hash) entries() []hashEntry {
+	entries := h.pairs.slice()
+	if len(entries) == h.Len() {
+		return entries
+	}
+	present := entries[:0]
+	for _, entry := range entries {
+		if entry.pair != nil {
+			present = append(present, entry)
+		}
+	}
+	return present
+}
+
+// compact rebuild the hash without the holes left by dissoc
+func (h *Hash) compact() {
+	entries := h.entries()
+	h.index = hamt{}
+	for i, entry := range entries {
+		h.index = h.index.set(entry.hash, entry.pair.Key, i)
+	}
+	h.pairs = newVector(entries)
+}
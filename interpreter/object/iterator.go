@@ -0,0 +1,141 @@
+package object
+
+// Iterable is implemented by the objects which can be looped over by comprehensions
+type Iterable interface {
+	Iterator() *Iterator
+}
+
+// Iterator produces the elements of an Iterable one by one, it's an Object so that the VM can keep it on the stack
+// while a loop is running, and the programs can step through it with the builtins iter and next.
+//
+// The elements may be computed lazily, like the ones yielded by a generator function, so producing one may fail:
+// the element is then an *Error, which is the last one, and the consumer must fail with it.
+// An element computed lazily is charged to the budget of the run asking for it, which is passed to Next, rather
+// than to the run creating the iterator, so an iterator created by a run can be consumed by a later one.
+type Iterator struct {
+	next func(budget Budget) (Object, bool)
+	// tail the iterator which takes over once next is exhausted, see Delegate
+	tail *Iterator
+	// current the iterator producing the elements, it's the iterator itself until it hands over to its tail
+	current *Iterator
+}
+
+// Budget the budget of the run consuming an iterator, see common.Budget
+type Budget interface {
+	Step() error
+	Check() error
+	Allocate(n int) error
+}
+
+func NewIterator(next func() (Object, bool)) *Iterator {
+	return &Iterator{next: func(Budget) (Object, bool) {
+		return next()
+	}}
+}
+
+// NewLazyIterator an iterator computing its elements under the budget of the consumer, like a generator
+func NewLazyIterator(next func(budget Budget) (Object, bool)) *Iterator {
+	return &Iterator{next: next}
+}
+
+// Next returns the next element computed under the budget, and false once the iterator is exhausted
+func (it *Iterator) Next(budget Budget) (Object, bool) {
+	if it.current == nil {
+		it.current = it
+	}
+	for {
+		element, ok := it.current.next(budget)
+		if ok || it.current.tail == nil {
+			return element, ok
+		}
+		// the tail of the tail is followed as well, so a chain of iterators handing over to each other is never
+		// walked again once passed
+		it.current = it.current.tail
+	}
+}
+
+// Delegate hand the elements following the ones of next over to the tail, it's called by next before it reports
+// its end. A generator ending with yield ...tail hands over instead of yielding the elements of the tail itself.
+func (it *Iterator) Delegate(tail *Iterator) {
+	it.tail = tail
+}
+
+// Iterator an iterator is iterable itself, so a generator can be looped over, the elements it produces are consumed
+func (it *Iterator) Iterator() *Iterator {
+	return it
+}
+
+func (it *Iterator) Type() ObjType {
+	return ObjIterator
+}
+
+func (it *Iterator) Inspect() string {
+	return "iterator"
+}
+
+// Iterator iterate over the characters of the string, a character is a rune rather than a byte
+func (s *StringObj) Iterator() *Iterator {
+	runes := []rune(s.Value)
+	i := 0
+	return NewIterator(func() (Object, bool) {
+		if i >= len(runes) {
+			return nil, false
+		}
+		i++
+		return &StringObj{Value: string(runes[i-1])}, true
+	})
+}
+
+// Iterator iterate over the elements of the array
+func (a *Array) Iterator() *Iterator {
+	i := 0
+	return NewIterator(func() (Object, bool) {
+		if i >= a.Size() {
+			return nil, false
+		}
+		i++
+		return a.Get(i - 1), true
+	})
+}
+
+// Iterator iterate over the pairs of the hash in insertion order, every element is an array of [key, value]
+func (h *Hash) Iterator() *Iterator {
+	pairs := h.Pairs()
+	i := 0
+	return NewIterator(func() (Object, bool) {
+		if i >= len(pairs) {
+			return nil, false
+		}
+		i++
+		return NewArray([]Object{pairs[i-1].Key, pairs[i-1].Value}), true
+	})
+}
+
+// Iterator iterate over the elements of the set in insertion order
+func (s *Set) Iterator() *Iterator {
+	elements := s.Elements()
+	i := 0
+	return NewIterator(func() (Object, bool) {
+		if i >= len(elements) {
+			return nil, false
+		}
+		i++
+		return elements[i-1], true
+	})
+}
+
+// step the next element as the hash {value: element, done: false}, or {value: null, done: true} once the iterator
+// is exhausted, it's the builtin next
+func (it *Iterator) step(budget Budget) Object {
+	element, ok := it.Next(budget)
+	if err, isError := element.(*Error); isError {
+		return err
+	}
+	if !ok {
+		element = NativeNull
+	}
+	hash := NewHash()
+	hash.Set(&StringObj{Value: "value"}, element)
+	hash.Set(&StringObj{Value: "done"}, NativeBoolean(!ok))
+	return hash
+}
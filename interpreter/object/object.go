@@ -5,6 +5,8 @@ import (
 	"0x822a5b87/monkey/interpreter/util"
 	"bytes"
 	"fmt"
+	"math"
+	"math/big"
 	"strconv"
 )
 
@@ -40,10 +42,23 @@ type HashPair struct {
 	Value Object
 }
 
+// Hashable an object which can be a key of a hash, the keys which are Equals must have the same HashKey,
+// but the keys with the same HashKey may be different
 type Hashable interface {
+	Object
 	HashKey() HashKey
 }
 
+// AsHashable the object as a key of a hash if it's usable as one, which an array is only if all of its elements are
+func AsHashable(obj Object) (Hashable, bool) {
+	if array, ok := obj.(*Array); ok {
+		_, ok = array.hashKey()
+		return array, ok
+	}
+	hashable, ok := obj.(Hashable)
+	return hashable, ok
+}
+
 type Integer struct {
 	Value int64
 }
@@ -63,46 +78,75 @@ func (i *Integer) HashKey() HashKey {
 	}
 }
 
+// Add the arithmetic of integers promotes the result to a BigInteger when it overflows int64
 func (i *Integer) Add(o Object) Object {
-	if other, ok := o.(*Integer); ok {
-		return &Integer{Value: i.Value + other.Value}
+	switch other := o.(type) {
+	case *Integer:
+		if sum := i.Value + other.Value; (sum > i.Value) == (other.Value > 0) {
+			return &Integer{Value: sum}
+		}
+		return bigArithmetic((*big.Int).Add, i, other)
+	case *BigInteger:
+		return bigArithmetic((*big.Int).Add, i, other)
 	}
 	return NativeNull
 }
 
 func (i *Integer) Sub(o Object) Object {
-	if other, ok := o.(*Integer); ok {
-		return &Integer{Value: i.Value - other.Value}
+	switch other := o.(type) {
+	case *Integer:
+		if difference := i.Value - other.Value; (difference < i.Value) == (other.Value > 0) {
+			return &Integer{Value: difference}
+		}
+		return bigArithmetic((*big.Int).Sub, i, other)
+	case *BigInteger:
+		return bigArithmetic((*big.Int).Sub, i, other)
 	}
 	return NativeNull
 }
 
 func (i *Integer) Mul(o Object) Object {
-	if other, ok := o.(*Integer); ok {
-		return &Integer{Value: i.Value * other.Value}
+	switch other := o.(type) {
+	case *Integer:
+		if i.Value == 0 || other.Value == 0 {
+			return &Integer{Value: 0}
+		}
+		product := i.Value * other.Value
+		if product/other.Value == i.Value && product/i.Value == other.Value {
+			return &Integer{Value: product}
+		}
+		return bigArithmetic((*big.Int).Mul, i, other)
+	case *BigInteger:
+		return bigArithmetic((*big.Int).Mul, i, other)
 	}
 	return NativeNull
 }
 
+// Divide truncates toward zero, dividing by zero is an error
 func (i *Integer) Divide(o Object) Object {
-	if other, ok := o.(*Integer); ok {
+	if isZero(o) {
+		return newDivisionByZeroError()
+	}
+	switch other := o.(type) {
+	case *Integer:
+		if i.Value == math.MinInt64 && other.Value == -1 {
+			return bigArithmetic((*big.Int).Quo, i, other)
+		}
 		return &Integer{Value: i.Value / other.Value}
+	case *BigInteger:
+		return bigArithmetic((*big.Int).Quo, i, other)
 	}
 	return NativeNull
 }
 
 func (i *Integer) Equal(o Object) *Boolean {
-	var other *Integer
-	var ok bool
-	if other, ok = o.(*Integer); !ok {
-		return NativeFalse
-	}
-
-	if i.Value == other.Value {
-		return NativeTrue
-	} else {
-		return NativeFalse
+	switch other := o.(type) {
+	case *Integer:
+		return NativeBoolean(i.Value == other.Value)
+	case *BigInteger:
+		return NativeBoolean(other.Value.IsInt64() && other.Value.Int64() == i.Value)
 	}
+	return NativeFalse
 }
 
 func (i *Integer) NotEqual(o Object) *Boolean {
@@ -113,28 +157,27 @@ func (i *Integer) NotEqual(o Object) *Boolean {
 	}
 }
 
-func (i *Integer) GreaterThan(o Object) *Boolean {
-	var other *Integer
-	var ok bool
-	if other, ok = o.(*Integer); !ok {
-		return NativeFalse
-	}
-
-	if i.Value > other.Value {
-		return NativeTrue
-	}
-
-	return NativeFalse
-}
-
-func (i *Integer) LessThan(o Object) *Boolean {
-	if !i.Equal(o).Value && !i.GreaterThan(o).Value {
-		return NativeTrue
+func (i *Integer) Compare(o Object) (int, error) {
+	switch other := o.(type) {
+	case *Integer:
+		switch {
+		case i.Value < other.Value:
+			return -1, nil
+		case i.Value > other.Value:
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	case *BigInteger:
+		return big.NewInt(i.Value).Cmp(other.Value), nil
 	}
-	return NativeFalse
+	return 0, &NotComparableError{Lhs: i, Rhs: o}
 }
 
 func (i *Integer) Negative() Object {
+	if i.Value == math.MinInt64 {
+		return NewBigInteger(new(big.Int).Neg(big.NewInt(i.Value)))
+	}
 	return &Integer{Value: -i.Value}
 }
 
@@ -193,6 +236,21 @@ func (n *Null) Inspect() string {
 	return "null"
 }
 
+func (n *Null) Equal(o Object) *Boolean {
+	if _, ok := o.(*Null); ok {
+		return NativeTrue
+	}
+	return NativeFalse
+}
+
+func (n *Null) NotEqual(o Object) *Boolean {
+	if n.Equal(o).Value {
+		return NativeFalse
+	} else {
+		return NativeTrue
+	}
+}
+
 type Return struct {
 	Object
 }
@@ -207,6 +265,12 @@ func (n *Return) Inspect() string {
 
 type Error struct {
 	Message string
+	// Stack the call stack where the error happened, the innermost call is the last, it's empty for the errors
+	// happened outside any function
+	Stack []Frame
+	// Err the Go error which caused the error, like an exceeded limit of the execution, it's nil for the errors
+	// of the program itself
+	Err error
 }
 
 func (e *Error) Type() ObjType {
@@ -217,10 +281,22 @@ func (e *Error) Inspect() string {
 	return e.Message
 }
 
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 type Fn struct {
 	Params []*ast.Identifier
 	Body   *ast.BlockStatement
 	Env    *Environment
+	// Locals the names of the slots of the frame of a call, see ast.FnLiteral.Locals
+	Locals []string
+	// Generator a call returns an iterator over the values yielded by the body, see ast.FnLiteral.Generator
+	Generator bool
 }
 
 func (f *Fn) Type() ObjType {
@@ -1,6 +1,10 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &StringObj{Value: "Hello World"}
@@ -58,3 +62,232 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestBigIntegerHashKey(t *testing.T) {
+	small := &Integer{Value: 42}
+	big1 := &BigInteger{Value: big.NewInt(42)}
+	huge1 := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 80)}
+	huge2 := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 80)}
+	negative := &BigInteger{Value: new(big.Int).Neg(huge1.Value)}
+
+	if small.HashKey() != big1.HashKey() {
+		t.Errorf("big and small integers with same content have different hash keys")
+	}
+
+	if huge1.HashKey() != huge2.HashKey() {
+		t.Errorf("big integers with same content have different hash keys")
+	}
+
+	if huge1.HashKey() == negative.HashKey() {
+		t.Errorf("big integers with different signs have same hash keys")
+	}
+}
+
+func TestArrayPersistence(t *testing.T) {
+	// 2000 elements take a trie of two levels plus the tail
+	const n = 2000
+	var elements []Object
+	arrays := []*Array{NewArray(nil)}
+	for i := 0; i < n; i++ {
+		elements = append(elements, &Integer{Value: int64(i)})
+		arrays = append(arrays, arrays[i].Push(elements[i]).(*Array))
+	}
+	for size, array := range arrays {
+		if array.Size() != size || !array.Equal(NewArray(elements[:size])).Value {
+			t.Fatalf("array of size [%d] got [%d] elements [%s]", size, array.Size(), array.Inspect())
+		}
+	}
+
+	array := arrays[n]
+	for i := 0; i < n; i += 7 {
+		updated := array.Assoc(&Integer{Value: int64(i)}, NativeNull).(*Array)
+		if updated.Get(i) != NativeNull || array.Get(i) != elements[i] {
+			t.Fatalf("assoc [%d] got [%s] and [%s]", i, updated.Get(i).Inspect(), array.Get(i).Inspect())
+		}
+		array = updated
+	}
+
+	var rest Object = arrays[n]
+	for i := 0; i < n; i++ {
+		if rest.(*Array).First() != elements[i] || rest.(*Array).Size() != n-i {
+			t.Fatalf("rest [%d] got [%s]", i, rest.(*Array).First().Inspect())
+		}
+		rest = rest.(*Array).Rest()
+	}
+	if rest.(*Array).Size() != 0 || rest.(*Array).Rest() != NativeNull {
+		t.Fatalf("expected an empty array, got [%s]", rest.Inspect())
+	}
+}
+
+func TestBigIntegerIndex(t *testing.T) {
+	array := NewArray([]Object{&Integer{Value: 1}, &Integer{Value: 2}})
+	small, huge := &BigInteger{Value: big.NewInt(1)}, &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 64)}
+
+	if actual := array.Index(small); !Equals(actual, &Integer{Value: 2}) {
+		t.Fatalf("expected the element [2] at a big index which fits in int64, got [%s]", actual.Inspect())
+	}
+	if actual := array.Assoc(small, NativeNull); actual.Inspect() != "[1, null]" {
+		t.Fatalf("expected [1, null] after assoc at a big index which fits in int64, got [%s]", actual.Inspect())
+	}
+	if actual := (&StringObj{Value: "ab"}).Index(small); actual.Inspect() != "b" {
+		t.Fatalf("expected [b] at a big index which fits in int64, got [%s]", actual.Inspect())
+	}
+
+	if actual := array.Index(huge); actual != NativeNull {
+		t.Fatalf("expected null at a big index, got [%s]", actual.Inspect())
+	}
+	if actual := array.Assoc(huge, NativeNull).Inspect(); actual != "array index out of range: 18446744073709551616" {
+		t.Fatalf("expected an out of range error at a big index, got [%s]", actual)
+	}
+}
+
+func TestHashPersistence(t *testing.T) {
+	const n = 1000
+	expected := make(map[int64]int64)
+	hash := NewHash()
+	var snapshot *Hash
+	var snapshotExpected map[int64]int64
+	for i := int64(0); i < 3*n; i++ {
+		key := &Integer{Value: i * 7919 % n}
+		if i%3 == 2 {
+			hash = hash.Dissoc(key).(*Hash)
+			delete(expected, key.Value)
+		} else {
+			hash = hash.Assoc(key, &Integer{Value: i}).(*Hash)
+			expected[key.Value] = i
+		}
+		if i == n {
+			snapshot, snapshotExpected = hash, make(map[int64]int64)
+			for key, value := range expected {
+				snapshotExpected[key] = value
+			}
+		}
+	}
+
+	// the snapshot is not modified by the later assoc and dissoc
+	testHashPairs(t, snapshot, snapshotExpected)
+	testHashPairs(t, hash, expected)
+
+	for key := range expected {
+		hash = hash.Dissoc(&Integer{Value: key}).(*Hash)
+	}
+	if hash.Len() != 0 || hash.Inspect() != "{}" {
+		t.Fatalf("expected an empty hash, got [%s]", hash.Inspect())
+	}
+}
+
+func testHashPairs(t *testing.T, hash *Hash, expected map[int64]int64) {
+	t.Helper()
+	if hash.Len() != len(expected) || len(hash.Pairs()) != len(expected) {
+		t.Fatalf("expected [%d] pairs, got [%d]", len(expected), hash.Len())
+	}
+	for key, value := range expected {
+		pair, ok := hash.Get(&Integer{Value: key})
+		if !ok || pair.Value.(*Integer).Value != value {
+			t.Fatalf("key [%d] expected [%d], got [%v]", key, value, pair)
+		}
+	}
+}
+
+// collidingKey a key whose hash key is chosen by the test, so that different keys can be made to collide
+type collidingKey struct {
+	name string
+	key  HashKey
+}
+
+func (k *collidingKey) Type() ObjType   { return ObjString }
+func (k *collidingKey) Inspect() string { return k.name }
+func (k *collidingKey) HashKey() HashKey {
+	return k.key
+}
+
+func (k *collidingKey) Equal(o Object) *Boolean {
+	other, ok := o.(*collidingKey)
+	return NativeBoolean(ok && k.name == other.name)
+}
+
+func (k *collidingKey) NotEqual(o Object) *Boolean {
+	return NativeBoolean(!k.Equal(o).Value)
+}
+
+func TestHashKeyCollisions(t *testing.T) {
+	const n = 200
+	collision := HashKey{Type: ObjString, HashValue: 42}
+	key := func(i int) *collidingKey {
+		return &collidingKey{name: fmt.Sprintf("key%d", i), key: collision}
+	}
+
+	hash := NewHash()
+	for i := 0; i < n; i++ {
+		hash.Set(key(i), &Integer{Value: int64(i)})
+	}
+	// setting an equal key replaces the value instead of adding a pair
+	hash.Set(key(7), &Integer{Value: -7})
+	if hash.Len() != n {
+		t.Fatalf("expected [%d] pairs, got [%d]", n, hash.Len())
+	}
+	for i := 0; i < n; i++ {
+		expected := int64(i)
+		if i == 7 {
+			expected = -7
+		}
+		pair, ok := hash.Get(key(i))
+		if !ok || pair.Value.(*Integer).Value != expected {
+			t.Fatalf("key [%d] expected [%d], got [%v]", i, expected, pair)
+		}
+	}
+	if _, ok := hash.Get(key(n)); ok {
+		t.Fatalf("expected a colliding key which was never set to be absent")
+	}
+
+	removed := hash
+	for i := 0; i < n; i += 2 {
+		removed = removed.Dissoc(key(i)).(*Hash)
+	}
+	if removed.Len() != n/2 || hash.Len() != n {
+		t.Fatalf("expected [%d] and [%d] pairs, got [%d] and [%d]", n/2, n, removed.Len(), hash.Len())
+	}
+	for i := 0; i < n; i++ {
+		if _, ok := removed.Get(key(i)); ok != (i%2 == 1) {
+			t.Fatalf("key [%d] expected present = [%t], got [%t]", i, i%2 == 1, ok)
+		}
+	}
+
+	set := NewSet()
+	for i := 0; i < n; i++ {
+		set.Insert(key(i))
+	}
+	set = set.Remove(key(0)).(*Set)
+	if set.Len().Value != n-1 || set.Contains(key(0)) != NativeFalse || set.Contains(key(1)) != NativeTrue {
+		t.Fatalf("expected the colliding elements to be kept apart, got [%s]", set.Inspect())
+	}
+}
+
+func TestHashKeyCollisionAcrossTypes(t *testing.T) {
+	str := &StringObj{Value: "one"}
+	impostor := &collidingKey{name: "impostor", key: str.HashKey()}
+	integer := &Integer{Value: str.HashKey().HashValue}
+
+	hash := NewHash()
+	hash.Set(str, &Integer{Value: 1})
+	hash.Set(impostor, &Integer{Value: 2})
+	hash.Set(integer, &Integer{Value: 3})
+
+	tests := []struct {
+		key      Hashable
+		expected int64
+	}{
+		{&StringObj{Value: "one"}, 1},
+		{&collidingKey{name: "impostor", key: str.HashKey()}, 2},
+		{&Integer{Value: str.HashKey().HashValue}, 3},
+	}
+	if hash.Len() != len(tests) {
+		t.Fatalf("expected [%d] pairs, got [%d]", len(tests), hash.Len())
+	}
+	for i, tt := range tests {
+		pair, ok := hash.Get(tt.key)
+		if !ok || pair.Value.(*Integer).Value != tt.expected {
+			t.Errorf("tests[%d] expected=%d, got=%v", i, tt.expected, pair)
+		}
+	}
+}
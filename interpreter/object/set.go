@@ -0,0 +1,139 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Set a collection of distinct hashable elements, it's a hash whose pairs map every element to itself,
+// so it keeps the elements in insertion order, and add and remove are persistent like assoc and dissoc.
+type Set struct {
+	hash Hash
+}
+
+func NewSet() *Set {
+	return &Set{}
+}
+
+func (s *Set) Type() ObjType {
+	return ObjSet
+}
+
+func (s *Set) Inspect() string {
+	buffer := bytes.Buffer{}
+	elements := make([]string, 0, s.hash.Len())
+	for _, element := range s.Elements() {
+		elements = append(elements, element.Inspect())
+	}
+	buffer.WriteString("#{")
+	buffer.WriteString(strings.Join(elements, ", "))
+	buffer.WriteString("}")
+	return buffer.String()
+}
+
+// Insert add the element in place, it's only meant for the sets being built, like a set literal
+func (s *Set) Insert(element Hashable) {
+	s.insert(hashOf(element), element)
+}
+
+func (s *Set) insert(hash uint64, element Object) {
+	if _, ok := s.hash.get(hash, element); !ok {
+		s.hash.set(hash, &HashPair{Key: element, Value: element})
+	}
+}
+
+// Elements returns the elements in insertion order
+func (s *Set) Elements() []Object {
+	elements := make([]Object, 0, s.hash.Len())
+	for _, entry := range s.hash.entries() {
+		elements = append(elements, entry.pair.Key)
+	}
+	return elements
+}
+
+func (s *Set) Len() Integer {
+	return Integer{Value: int64(s.hash.Len())}
+}
+
+// Add a new set with the element, s is not modified
+func (s *Set) Add(element Object) Object {
+	hashable, ok := AsHashable(element)
+	if !ok {
+		return newUnusableHashKeyError(element)
+	}
+	set := &Set{hash: s.hash}
+	set.Insert(hashable)
+	return set
+}
+
+// Remove a new set without the element, s is not modified
+func (s *Set) Remove(element Object) Object {
+	hashable, ok := AsHashable(element)
+	if !ok {
+		return newUnusableHashKeyError(element)
+	}
+	return &Set{hash: *s.hash.dissoc(hashOf(hashable), element)}
+}
+
+// Contains tells if the element is in the set, it's the operator in
+func (s *Set) Contains(element Object) Object {
+	hashable, ok := AsHashable(element)
+	if !ok {
+		return newUnusableHashKeyError(element)
+	}
+	_, ok = s.hash.Get(hashable)
+	return NativeBoolean(ok)
+}
+
+// Union the elements of s followed by the elements of other which are not in s
+func (s *Set) Union(other *Set) *Set {
+	set := &Set{hash: s.hash}
+	for _, entry := range other.hash.entries() {
+		set.insert(entry.hash, entry.pair.Key)
+	}
+	return set
+}
+
+// Intersection the elements of s which are also in other
+func (s *Set) Intersection(other *Set) *Set {
+	return s.filter(func(entry hashEntry) bool {
+		_, ok := other.hash.get(entry.hash, entry.pair.Key)
+		return ok
+	})
+}
+
+// Difference the elements of s which are not in other
+func (s *Set) Difference(other *Set) *Set {
+	return s.filter(func(entry hashEntry) bool {
+		_, ok := other.hash.get(entry.hash, entry.pair.Key)
+		return !ok
+	})
+}
+
+func (s *Set) filter(keep func(hashEntry) bool) *Set {
+	set := NewSet()
+	for _, entry := range s.hash.entries() {
+		if keep(entry) {
+			set.insert(entry.hash, entry.pair.Key)
+		}
+	}
+	return set
+}
+
+// Equal the sets have the same elements, regardless of their order
+func (s *Set) Equal(o Object) *Boolean {
+	other, ok := o.(*Set)
+	if !ok || s.hash.Len() != other.hash.Len() {
+		return NativeFalse
+	}
+	for _, entry := range s.hash.entries() {
+		if _, ok := other.hash.get(entry.hash, entry.pair.Key); !ok {
+			return NativeFalse
+		}
+	}
+	return NativeTrue
+}
+
+func (s *Set) NotEqual(o Object) *Boolean {
+	return NativeBoolean(!s.Equal(o).Value)
+}
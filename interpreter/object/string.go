@@ -1,12 +1,19 @@
 package object
 
 import (
-	"crypto/md5"
-	"encoding/binary"
+	"hash/maphash"
+	"strings"
+	"sync/atomic"
 )
 
+// hashSeed is random for every process, so that the program can't be fed keys which are known to collide
+var hashSeed = maphash.MakeSeed()
+
 type StringObj struct {
 	Value string
+	// hash caches the hash of Value once computed, 0 means not yet, it's accessed atomically since strings
+	// are shared between goroutines
+	hash uint64
 }
 
 func (s *StringObj) Type() ObjType {
@@ -18,13 +25,14 @@ func (s *StringObj) Inspect() string {
 }
 
 func (s *StringObj) HashKey() HashKey {
-	hasher := md5.New()
-	hasher.Write([]byte(s.Value))
-	hashValue := int64(binary.BigEndian.Uint64(hasher.Sum(nil)))
-
+	hash := atomic.LoadUint64(&s.hash)
+	if hash == 0 {
+		hash = maphash.String(hashSeed, s.Value) | 1
+		atomic.StoreUint64(&s.hash, hash)
+	}
 	return HashKey{
 		Type:      ObjString,
-		HashValue: hashValue,
+		HashValue: int64(hash),
 	}
 }
 
@@ -32,15 +40,30 @@ func (s *StringObj) Add(object Object) Object {
 	return &StringObj{Value: s.Value + object.Inspect()}
 }
 
-func (s *StringObj) Index(o Object) Object {
-	other, ok := o.(*Integer)
+func (s *StringObj) Equal(o Object) *Boolean {
+	other, ok := o.(*StringObj)
+	return NativeBoolean(ok && s.Value == other.Value)
+}
+
+func (s *StringObj) NotEqual(o Object) *Boolean {
+	return NativeBoolean(!s.Equal(o).Value)
+}
+
+// Compare order the strings byte-wise
+func (s *StringObj) Compare(o Object) (int, error) {
+	other, ok := o.(*StringObj)
 	if !ok {
-		return NativeNull
+		return 0, &NotComparableError{Lhs: s, Rhs: o}
 	}
-	if other.Value >= int64(len(s.Value)) || other.Value < 0 {
+	return strings.Compare(s.Value, other.Value), nil
+}
+
+func (s *StringObj) Index(o Object) Object {
+	i, ok := indexValue(o)
+	if !ok || i >= int64(len(s.Value)) || i < 0 {
 		return NativeNull
 	}
-	ch := s.Value[other.Value]
+	ch := s.Value[i]
 	return &StringObj{Value: string(rune(ch))}
 }
 
@@ -11,4 +11,6 @@ const (
 	ObjBuiltIn  ObjType = "BUILT_IN"
 	ObjArray    ObjType = "ARRAY"
 	ObjHash     ObjType = "HASH"
+	ObjSet      ObjType = "SET"
+	ObjIterator ObjType = "ITERATOR"
 )
@@ -0,0 +1,171 @@
+package object
+
+const (
+	vectorBits  = 5
+	vectorWidth = 1 << vectorBits
+	vectorMask  = vectorWidth - 1
+)
+
+// vector a persistent vector, a trie of 32-way nodes whose leaves hold the elements, plus a tail holding the last
+// elements until it's full, so pushing is amortized constant time and an update copies only the path to the leaf.
+// The elements before offset were dropped by rest, they are still in the trie but not visible.
+// A vector is a value, the operations return a new vector sharing the untouched nodes with the old one,
+// so the nodes and the tail must never be modified after they are shared. The zero vector is empty.
+type vector[T any] struct {
+	count  int
+	offset int
+	shift  uint
+	root   *vectorNode[T]
+	tail   []T
+}
+
+// vectorNode an inner node of the trie holds its children, a leaf holds its elements
+type vectorNode[T any] struct {
+	children []*vectorNode[T]
+	elements []T
+}
+
+func newVector[T any](elements []T) vector[T] {
+	v := vector[T]{}
+	for len(elements) > vectorWidth {
+		leaf := make([]T, vectorWidth)
+		copy(leaf, elements)
+		v = v.pushLeaf(leaf)
+		elements = elements[vectorWidth:]
+	}
+	v.tail = make([]T, len(elements))
+	copy(v.tail, elements)
+	v.count += len(elements)
+	return v
+}
+
+func (v vector[T]) size() int {
+	return v.count - v.offset
+}
+
+func (v vector[T]) tailOffset() int {
+	return v.count - len(v.tail)
+}
+
+// leaf the elements of the leaf or the tail holding the absolute index i
+func (v vector[T]) leaf(i int) []T {
+	if i >= v.tailOffset() {
+		return v.tail
+	}
+	node := v.root
+	for level := v.shift; level > 0; level -= vectorBits {
+		node = node.children[(i>>level)&vectorMask]
+	}
+	return node.elements
+}
+
+func (v vector[T]) get(i int) T {
+	i += v.offset
+	return v.leaf(i)[i&vectorMask]
+}
+
+// push a vector with obj appended, the tail is copied unless it's full and pushed into the trie
+func (v vector[T]) push(obj T) vector[T] {
+	if len(v.tail) < vectorWidth {
+		tail := make([]T, len(v.tail)+1)
+		copy(tail, v.tail)
+		tail[len(v.tail)] = obj
+		v.tail = tail
+		v.count++
+		return v
+	}
+	v = v.pushLeaf(v.tail)
+	v.tail = make([]T, 1)
+	v.tail[0] = obj
+	v.count++
+	return v
+}
+
+// pushLeaf a vector with the full leaf appended to the trie, the tail must be empty or full
+func (v vector[T]) pushLeaf(elements []T) vector[T] {
+	leaf := &vectorNode[T]{elements: elements}
+	if v.root == nil {
+		v.root, v.shift = &vectorNode[T]{}, vectorBits
+	}
+	trieCount := v.tailOffset()
+	if trieCount>>vectorBits >= 1<<v.shift {
+		// the root is full, grow the trie by a level
+		v.root = &vectorNode[T]{children: []*vectorNode[T]{v.root, newVectorPath(v.shift, leaf)}}
+		v.shift += vectorBits
+	} else {
+		v.root = v.root.pushLeaf(v.shift, trieCount, leaf)
+	}
+	v.count += len(elements) - len(v.tail)
+	v.tail = nil
+	return v
+}
+
+func (n *vectorNode[T]) pushLeaf(level uint, i int, leaf *vectorNode[T]) *vectorNode[T] {
+	children := make([]*vectorNode[T], len(n.children), len(n.children)+1)
+	copy(children, n.children)
+	child := leaf
+	if level > vectorBits {
+		if sub := (i >> level) & vectorMask; sub < len(children) {
+			children[sub] = children[sub].pushLeaf(level-vectorBits, i, leaf)
+			return &vectorNode[T]{children: children}
+		}
+		child = newVectorPath(level-vectorBits, leaf)
+	}
+	return &vectorNode[T]{children: append(children, child)}
+}
+
+// newVectorPath a chain of inner nodes from the level down to the leaf
+func newVectorPath[T any](level uint, leaf *vectorNode[T]) *vectorNode[T] {
+	if level == 0 {
+		return leaf
+	}
+	return &vectorNode[T]{children: []*vectorNode[T]{newVectorPath(level-vectorBits, leaf)}}
+}
+
+// assoc a vector with the element at i replaced by obj, i must be in range
+func (v vector[T]) assoc(i int, obj T) vector[T] {
+	i += v.offset
+	if i >= v.tailOffset() {
+		tail := make([]T, len(v.tail))
+		copy(tail, v.tail)
+		tail[i&vectorMask] = obj
+		v.tail = tail
+		return v
+	}
+	v.root = v.root.assoc(v.shift, i, obj)
+	return v
+}
+
+func (n *vectorNode[T]) assoc(level uint, i int, obj T) *vectorNode[T] {
+	if level == 0 {
+		elements := make([]T, len(n.elements))
+		copy(elements, n.elements)
+		elements[i&vectorMask] = obj
+		return &vectorNode[T]{elements: elements}
+	}
+	children := make([]*vectorNode[T], len(n.children))
+	copy(children, n.children)
+	sub := (i >> level) & vectorMask
+	children[sub] = children[sub].assoc(level-vectorBits, i, obj)
+	return &vectorNode[T]{children: children}
+}
+
+// rest a vector without its first element, the vector must not be empty
+func (v vector[T]) rest() vector[T] {
+	v.offset++
+	if v.offset == v.count {
+		return vector[T]{}
+	}
+	return v
+}
+
+// slice the elements copied into a new slice
+func (v vector[T]) slice() []T {
+	elements := make([]T, 0, v.size())
+	for i := v.offset; i < v.count; {
+		leaf := v.leaf(i)
+		elements = append(elements, leaf[i&vectorMask:]...)
+		i += len(leaf) - i&vectorMask
+	}
+	return elements
+}
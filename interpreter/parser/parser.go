@@ -5,20 +5,23 @@ import (
 	"0x822a5b87/monkey/interpreter/common"
 	"0x822a5b87/monkey/interpreter/lexer"
 	"0x822a5b87/monkey/interpreter/token"
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 )
 
 type Precedence int
 
 const (
-	LowestPrecedence      Precedence = 10
-	EqualsPrecedence      Precedence = 20
-	LessGreaterPrecedence Precedence = 30
-	SumPrecedence         Precedence = 40
-	ProductPrecedence     Precedence = 50
-	PrefixPrecedence      Precedence = 60
-	CallPrecedence        Precedence = 70
+	LowestPrecedence         Precedence = 10
+	NullCoalescingPrecedence Precedence = 15
+	EqualsPrecedence         Precedence = 20
+	LessGreaterPrecedence    Precedence = 30
+	SumPrecedence            Precedence = 40
+	ProductPrecedence        Precedence = 50
+	PrefixPrecedence         Precedence = 60
+	CallPrecedence           Precedence = 70
 )
 
 type prefixParseFn func() ast.Expression
@@ -32,17 +35,51 @@ type Parser struct {
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 
+	// precedences the precedence of every token type
 	precedences map[token.TokenType]Precedence
+	// operators the user-defined operators declared by this source and the sources parsed before it
+	operators *Operators
+	// functions the function literals being parsed, the innermost last, a yield statement makes the innermost one
+	// a generator
+	functions []*ast.FnLiteral
+	// nesting the number of enclosing brackets ( [ and the braces of hashes and sets, a line break inside them
+	// never ends the statement, see isEndOfLine
+	nesting int
 
 	tracing bool
+	// traceLevel and traceLine the indentation and the number of the next line of the trace
+	traceLevel int
+	traceLine  int
+}
+
+// Operators the user-defined infix operators declared by infix and infixr, keyed by their symbol.
+// A session parsing its inputs one by one, like the REPL, parses every input with the same Operators,
+// so that an operator declared by an input can be used by the following ones.
+type Operators struct {
+	precedences      map[string]Precedence
+	rightAssociative map[string]bool
+}
+
+func NewOperators() *Operators {
+	return &Operators{precedences: make(map[string]Precedence), rightAssociative: make(map[string]bool)}
 }
 
 func NewParser(l lexer.Lexer) *Parser {
+	return NewParserWithOperators(l, NewOperators())
+}
+
+// NewParserWithOperators a parser knowing the operators declared by the sources parsed before, the operators
+// declared by the source are added to them
+func NewParserWithOperators(l lexer.Lexer, operators *Operators) *Parser {
 	p := &Parser{
 		lex:            l,
 		prefixParseFns: make(map[token.TokenType]prefixParseFn),
 		infixParseFns:  make(map[token.TokenType]infixParseFn),
 		precedences:    make(map[token.TokenType]Precedence),
+		operators:      operators,
+	}
+	for operator := range operators.precedences {
+		p.lex.DeclareOperator(operator)
 	}
 
 	p.precedences[token.INT] = LowestPrecedence
@@ -59,9 +96,18 @@ func NewParser(l lexer.Lexer) *Parser {
 	p.precedences[token.NotEq] = EqualsPrecedence
 	p.precedences[token.TRUE] = LowestPrecedence
 	p.precedences[token.FALSE] = LowestPrecedence
+	p.precedences[token.NULL] = LowestPrecedence
+	p.precedences[token.NullCoalescing] = NullCoalescingPrecedence
+	p.precedences[token.OptionalChaining] = CallPrecedence
+	p.precedences[token.OptionalIndex] = CallPrecedence
 	p.precedences[token.LPAREN] = CallPrecedence
 	p.precedences[token.RPAREN] = LowestPrecedence
 	p.precedences[token.COLON] = LowestPrecedence
+	p.precedences[token.ELLIPSIS] = LowestPrecedence
+	p.precedences[token.FOR] = LowestPrecedence
+	p.precedences[token.IF] = LowestPrecedence
+	p.precedences[token.INFIX] = LowestPrecedence
+	p.precedences[token.INFIXR] = LowestPrecedence
 
 	p.precedences[token.LBRACE] = CallPrecedence
 	p.precedences[token.RBRACE] = LowestPrecedence
@@ -69,7 +115,11 @@ func NewParser(l lexer.Lexer) *Parser {
 	p.precedences[token.LBRACKET] = CallPrecedence
 	p.precedences[token.RBRACKET] = LowestPrecedence
 
+	p.precedences[token.SetLBrace] = LowestPrecedence
+	p.precedences[token.IN] = LessGreaterPrecedence
+
 	p.precedences[token.RETURN] = LowestPrecedence
+	p.precedences[token.YIELD] = LowestPrecedence
 
 	p.registerPrefix(token.IDENTIFIER, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseInteger)
@@ -77,14 +127,18 @@ func NewParser(l lexer.Lexer) *Parser {
 	p.registerPrefix(token.SUB, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNull)
 	p.registerPrefix(token.LPAREN, p.parseGroup)
 	p.registerPrefix(token.LBRACKET, p.parseArray)
 	p.registerPrefix(token.LBRACE, p.parseMap)
+	p.registerPrefix(token.SetLBrace, p.parseSet)
 	p.registerPrefix(token.IF, p.parseIfStmt)
 	p.registerPrefix(token.FUNCTION, p.parseFn)
 	p.registerPrefix(token.String, p.parseStringLiteral)
+	p.registerPrefix(token.ELLIPSIS, p.parseSpread)
 
 	p.registerInfix(token.PLUS, p.parseInfixOperator)
+	p.registerInfix(token.OPERATOR, p.parseInfixOperator)
 	p.registerInfix(token.SUB, p.parseInfixOperator)
 	p.registerInfix(token.ASTERISK, p.parseInfixOperator)
 	p.registerInfix(token.SLASH, p.parseInfixOperator)
@@ -92,8 +146,12 @@ func NewParser(l lexer.Lexer) *Parser {
 	p.registerInfix(token.LT, p.parseInfixOperator)
 	p.registerInfix(token.EQ, p.parseInfixOperator)
 	p.registerInfix(token.NotEq, p.parseInfixOperator)
+	p.registerInfix(token.IN, p.parseInfixOperator)
 	p.registerInfix(token.LPAREN, p.parseCall)
 	p.registerInfix(token.LBRACKET, p.parseIndex)
+	p.registerInfix(token.NullCoalescing, p.parseInfixOperator)
+	p.registerInfix(token.OptionalIndex, p.parseOptionalIndex)
+	p.registerInfix(token.OptionalChaining, p.parseOptionalChaining)
 
 	// call next token twice so that current token and peek token are both set
 	p.nextToken()
@@ -138,17 +196,42 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	for _, comment := range p.lex.Comments() {
+		program.Comments = append(program.Comments, &ast.Comment{Token: comment})
+	}
+
+	// the program is resolved once here, so that it's only read by the evaluations which may share it
+	ast.Resolve(program)
 	return program
 }
 
+// Parse parse the source code into a program, the syntax error is returned instead of panicking
+func Parse(sourceCode string) (*ast.Program, error) {
+	return ParseWithOperators(sourceCode, NewOperators())
+}
+
+// ParseWithOperators parse the source code like Parse, with the operators declared by the sources parsed before
+func ParseWithOperators(sourceCode string, operators *Operators) (program *ast.Program, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return NewParserWithOperators(*lexer.NewLexer(sourceCode), operators).ParseProgram(), nil
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.currToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.YIELD:
+		return p.parseYieldStatement()
 	case token.IDENTIFIER:
 		return p.parseAssignStatement()
+	case token.INFIX, token.INFIXR:
+		return p.parseInfixDeclaration()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -159,6 +242,12 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		Token:      p.currToken,
 		Statements: make([]ast.Statement, 0),
 	}
+	// the statements of a block end at line breaks again, even when the block is inside brackets like f(fn() { ... })
+	nesting := p.nesting
+	p.nesting = 0
+	defer func() {
+		p.nesting = nesting
+	}()
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
@@ -166,6 +255,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		blockStatement.Statements = append(blockStatement.Statements, stmt)
 	}
 	p.expectPeek(token.RBRACE)
+	blockStatement.End = p.currToken
 	return blockStatement
 }
 
@@ -182,7 +272,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 
 	letStmt.Value = p.parseExpression(LowestPrecedence)
-	p.expectPeek(token.SEMICOLON)
+	p.expectStatementEnd()
 
 	return letStmt
 }
@@ -191,10 +281,27 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	returnStatement := &ast.ReturnStatement{Token: p.currToken}
 	p.nextToken()
 	returnStatement.ReturnValue = p.parseExpression(LowestPrecedence)
-	p.expectPeek(token.SEMICOLON)
+	p.expectStatementEnd()
 	return returnStatement
 }
 
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	if len(p.functions) == 0 {
+		panic(fmt.Errorf("yield outside of a function at line %d, column %d", p.currToken.Line, p.currToken.Column))
+	}
+	p.functions[len(p.functions)-1].Generator = true
+
+	yieldStatement := &ast.YieldStatement{Token: p.currToken}
+	if p.peekTokenIs(token.ELLIPSIS) {
+		p.nextToken()
+		yieldStatement.Spread = true
+	}
+	p.nextToken()
+	yieldStatement.Value = p.parseExpression(LowestPrecedence)
+	p.expectStatementEnd()
+	return yieldStatement
+}
+
 func (p *Parser) parseAssignStatement() ast.Statement {
 	if p.peekTokenIs(token.ASSIGN) {
 		letStmt := &ast.LetStatement{Token: p.currToken}
@@ -205,7 +312,7 @@ func (p *Parser) parseAssignStatement() ast.Statement {
 		p.nextToken()
 
 		letStmt.Value = p.parseExpression(LowestPrecedence)
-		p.expectPeek(token.SEMICOLON)
+		p.expectStatementEnd()
 
 		return letStmt
 	} else {
@@ -213,6 +320,53 @@ func (p *Parser) parseAssignStatement() ast.Statement {
 	}
 }
 
+// parseInfixDeclaration parse `infix 45 <+> (a, b) => expr`, the precedence is a value in the precedences table,
+// so 45 binds tighter than + (SumPrecedence) and looser than * (ProductPrecedence).
+// The operator is declared right after the declaration is parsed, and can be used in the following statements.
+func (p *Parser) parseInfixDeclaration() *ast.InfixDeclaration {
+	declaration := &ast.InfixDeclaration{
+		Token:            p.currToken,
+		RightAssociative: p.currTokenIs(token.INFIXR),
+	}
+
+	p.expectPeek(token.INT)
+	precedence, err := strconv.ParseInt(p.currToken.Literal, 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	if Precedence(precedence) <= LowestPrecedence || Precedence(precedence) >= PrefixPrecedence {
+		panic(fmt.Errorf("precedence of infix operator must be between [%d] and [%d], got [%d]",
+			LowestPrecedence, PrefixPrecedence, precedence))
+	}
+	declaration.Precedence = precedence
+
+	p.expectPeek(token.OPERATOR)
+	declaration.Operator = p.currToken.Literal
+
+	p.expectPeek(token.LPAREN)
+	for i := 0; i < 2; i++ {
+		p.expectPeek(token.IDENTIFIER)
+		declaration.Params = append(declaration.Params, p.parseIdentifier().(*ast.Identifier))
+		if i == 0 {
+			p.expectPeek(token.COMMA)
+		}
+	}
+	p.expectPeek(token.RPAREN)
+	p.expectPeek(token.ARROW)
+	p.nextToken()
+	declaration.Body = p.parseExpression(LowestPrecedence)
+	p.expectStatementEnd()
+
+	p.declareInfixOperator(declaration.Operator, Precedence(precedence), declaration.RightAssociative)
+	return declaration
+}
+
+// declareInfixOperator add a user-defined operator to the operators table
+func (p *Parser) declareInfixOperator(operator string, precedence Precedence, rightAssociative bool) {
+	p.operators.precedences[operator] = precedence
+	p.operators.rightAssociative[operator] = rightAssociative
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.currToken}
 	stmt.Expr = p.parseExpression(LowestPrecedence)
@@ -226,12 +380,12 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 func (p *Parser) parseExpression(precedence Precedence) ast.Expression {
 	if p.tracing {
-		defer untrace(trace(fmt.Sprintf("parseExpression : token [%s]", p.currToken.Literal)))
+		defer p.untrace(p.trace(fmt.Sprintf("parseExpression : token [%s]", p.currToken.Literal)))
 	}
 	// start parse expression from prefix parse function
 	prefixFn := p.getPrefixFn(p.currToken.Type)
 	lhs := prefixFn()
-	for !p.isEof() && precedence < p.peekPrecedence() {
+	for !p.isEof() && !p.isEndOfLine() && p.peekTakesLhs(precedence) {
 		p.nextToken()
 		infixFn := p.getInfixFn(p.currToken.Type)
 		lhs = infixFn(lhs)
@@ -239,6 +393,16 @@ func (p *Parser) parseExpression(precedence Precedence) ast.Expression {
 	return lhs
 }
 
+// peekTakesLhs reports whether the peek operator takes the expression parsed at the precedence as its lhs, it does if
+// it binds tighter, or as tight and it's right associative: a <+> b <+> c is parsed as a <+> (b <+> c) for infixr
+func (p *Parser) peekTakesLhs(precedence Precedence) bool {
+	peek := p.peekPrecedence()
+	if precedence == peek && p.peekTokenIs(token.OPERATOR) {
+		return p.operators.rightAssociative[p.peekToken.Literal]
+	}
+	return precedence < peek
+}
+
 func (p *Parser) getPrefixFn(tokenType token.TokenType) prefixParseFn {
 	fn, ok := p.prefixParseFns[tokenType]
 	if !ok {
@@ -263,6 +427,59 @@ func (p *Parser) isEof() bool {
 	return p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.EOF)
 }
 
+// isEndOfLine reports whether the current token ends a statement written without semicolon.
+// Similar to the semicolon insertion of Go, a line break terminates the statement
+// if the last token of the line is an identifier, a literal or one of the closing ) ] },
+// so that a line ending with an operator or an opening bracket continues on the next line.
+// The line break doesn't terminate the statement inside brackets, nor before a token which can only continue
+// an expression like + or ?., which can't start a statement anyway. A line starting with ( [ or - always starts
+// a new statement, so that the meaning of the code never depends on a semicolon further on.
+func (p *Parser) isEndOfLine() bool {
+	if !p.peekToken.NewLine || p.nesting > 0 || !endsLine(p.currToken.Type) {
+		return false
+	}
+	return !p.isInfixOnly(p.peekToken.Type)
+}
+
+// endsLine reports whether a line break after a token of the type may end the statement, see isEndOfLine
+func endsLine(tokenType token.TokenType) bool {
+	switch tokenType {
+	case token.IDENTIFIER, token.INT, token.String, token.TRUE, token.FALSE, token.NULL,
+		token.RPAREN, token.RBRACKET, token.RBRACE:
+		return true
+	default:
+		return false
+	}
+}
+
+// isInfixOnly reports whether a token of the type can only continue an expression, it can't start one
+func (p *Parser) isInfixOnly(tokenType token.TokenType) bool {
+	_, infix := p.infixParseFns[tokenType]
+	_, prefix := p.prefixParseFns[tokenType]
+	return infix && !prefix
+}
+
+// nest enter a pair of brackets, the returned function leaves them
+func (p *Parser) nest() func() {
+	p.nesting++
+	return func() {
+		p.nesting--
+	}
+}
+
+// expectStatementEnd the statement is terminated either by a semicolon, or by the end of line, the end of block
+// and the end of file, only the semicolon is consumed.
+func (p *Parser) expectStatementEnd() {
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+		return
+	}
+	if p.isEndOfLine() || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		return
+	}
+	panic(fmt.Errorf("expected [%s], got [%s]", token.SEMICOLON, p.peekToken.Type))
+}
+
 func (p *Parser) peekTokenIs(tokenType token.TokenType) bool {
 	return p.peekToken.Type == tokenType
 }
@@ -277,7 +494,18 @@ func (p *Parser) getPrecedence(tokenType token.TokenType) Precedence {
 }
 
 func (p *Parser) peekPrecedence() Precedence {
-	return p.getPrecedence(p.peekToken.Type)
+	return p.precedenceOf(p.peekToken)
+}
+
+// precedenceOf the precedence of user-defined operators is looked up by their symbol
+func (p *Parser) precedenceOf(tok token.Token) Precedence {
+	if tok.Type == token.OPERATOR {
+		if precedence, ok := p.operators.precedences[tok.Literal]; ok {
+			return precedence
+		}
+		return p.getPrecedence(token.TokenType(tok.Literal))
+	}
+	return p.getPrecedence(tok.Type)
 }
 
 func (p *Parser) expect(tokenType token.TokenType) bool {
@@ -307,7 +535,7 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	if p.tracing {
-		defer untrace(trace(fmt.Sprintf("parsePrefixExpression : token [%s]", p.currToken.Literal)))
+		defer p.untrace(p.trace(fmt.Sprintf("parsePrefixExpression : token [%s]", p.currToken.Literal)))
 	}
 	expr := ast.PrefixExpression{
 		Token:    p.currToken,
@@ -330,9 +558,18 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.BooleanExpression{Token: p.currToken, Value: b}
 }
 
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.NullLiteral{Token: p.currToken}
+}
+
 func (p *Parser) parseInteger() ast.Expression {
 	integerLiteral := p.currToken.Literal
 	integer, err := strconv.ParseInt(integerLiteral, 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if value, ok := new(big.Int).SetString(integerLiteral, 10); ok {
+			return &ast.BigIntegerLiteral{Token: p.currToken, Value: value}
+		}
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -347,6 +584,7 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 }
 
 func (p *Parser) parseGroup() ast.Expression {
+	defer p.nest()()
 	// skip left parentheses
 	p.expect(token.LPAREN)
 	groupExpr := p.parseExpression(LowestPrecedence)
@@ -355,12 +593,89 @@ func (p *Parser) parseGroup() ast.Expression {
 }
 
 func (p *Parser) parseArray() ast.Expression {
-	arrayLiteral := &ast.ArrayLiteral{Token: p.currToken}
-	arrayLiteral.Elements = p.parseExpressionList(token.RBRACKET)
+	defer p.nest()()
+	arrayLiteral := &ast.ArrayLiteral{Token: p.currToken, Elements: make([]ast.Expression, 0)}
+	if !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		first := p.parseExpression(LowestPrecedence)
+		if p.peekTokenIs(token.FOR) {
+			return p.parseArrayComprehension(arrayLiteral.Token, first)
+		}
+		arrayLiteral.Elements = append(arrayLiteral.Elements, first)
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+	arrayLiteral.Elements = append(arrayLiteral.Elements, p.parseExpressionList(token.RBRACKET)...)
 	p.expectPeek(token.RBRACKET)
+	arrayLiteral.End = p.currToken
 	return arrayLiteral
 }
 
+// parseSet parse #{1, 2, 3}, the elements may be spread like #{...array}
+func (p *Parser) parseSet() ast.Expression {
+	defer p.nest()()
+	setLiteral := &ast.SetLiteral{Token: p.currToken}
+	setLiteral.Elements = p.parseExpressionList(token.RBRACE)
+	p.expectPeek(token.RBRACE)
+	setLiteral.End = p.currToken
+	return setLiteral
+}
+
+func (p *Parser) parseArrayComprehension(tok token.Token, element ast.Expression) ast.Expression {
+	comprehension := &ast.ArrayComprehension{
+		Token:   tok,
+		Element: element,
+		Clause:  p.parseComprehensionClause(),
+	}
+	p.expectPeek(token.RBRACKET)
+	return comprehension
+}
+
+func (p *Parser) parseHashComprehension(tok token.Token, key, value ast.Expression) ast.Expression {
+	comprehension := &ast.HashComprehension{
+		Token:  tok,
+		Key:    key,
+		Value:  value,
+		Clause: p.parseComprehensionClause(),
+	}
+	p.expectPeek(token.RBRACE)
+	return comprehension
+}
+
+// parseComprehensionClause parse `for target in iterable if condition` while the peek token is 'for'
+func (p *Parser) parseComprehensionClause() *ast.ComprehensionClause {
+	p.expectPeek(token.FOR)
+	clause := &ast.ComprehensionClause{Token: p.currToken}
+
+	if p.peekTokenIs(token.LBRACKET) {
+		p.nextToken()
+		clause.Destructure = true
+		for !p.peekTokenIs(token.RBRACKET) {
+			p.expectPeek(token.IDENTIFIER)
+			clause.Targets = append(clause.Targets, p.parseIdentifier().(*ast.Identifier))
+			if p.peekTokenIs(token.COMMA) {
+				p.nextToken()
+			}
+		}
+		p.expectPeek(token.RBRACKET)
+	} else {
+		p.expectPeek(token.IDENTIFIER)
+		clause.Targets = append(clause.Targets, p.parseIdentifier().(*ast.Identifier))
+	}
+
+	p.expectPeek(token.IN)
+	p.nextToken()
+	clause.Iterable = p.parseExpression(LowestPrecedence)
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		clause.Condition = p.parseExpression(LowestPrecedence)
+	}
+	return clause
+}
+
 //func (p *Parser) parseMap() ast.Expression {
 //	m := &ast.HashExpression{
 //		Token: p.currToken,
@@ -379,28 +694,48 @@ func (p *Parser) parseArray() ast.Expression {
 //}
 
 func (p *Parser) parseMap() ast.Expression {
+	defer p.nest()()
 	m := &ast.HashExpression{
 		Token: p.currToken,
-		Pairs: make(map[ast.Expression]ast.Expression),
+		Pairs: make([]*ast.HashPair, 0),
 	}
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
+		if p.currTokenIs(token.ELLIPSIS) {
+			m.Pairs = append(m.Pairs, &ast.HashPair{Spread: p.parseSpread().(*ast.SpreadExpression)})
+			if p.peekTokenIs(token.COMMA) {
+				p.nextToken()
+			}
+			continue
+		}
 		k := p.parseExpression(LowestPrecedence)
 		p.expectPeek(token.COLON)
 		p.nextToken()
 		v := p.parseExpression(LowestPrecedence)
+		if p.peekTokenIs(token.FOR) && len(m.Pairs) == 0 {
+			return p.parseHashComprehension(m.Token, k, v)
+		}
 		if p.peekTokenIs(token.COMMA) {
 			p.nextToken()
 		}
-		m.Pairs[k] = v
+		m.Pairs = append(m.Pairs, &ast.HashPair{Key: k, Value: v})
 	}
 	p.expectPeek(token.RBRACE)
+	m.End = p.currToken
 
 	return m
 }
 
+func (p *Parser) parseSpread() ast.Expression {
+	spread := &ast.SpreadExpression{Token: p.currToken}
+	p.nextToken()
+	spread.Value = p.parseExpression(LowestPrecedence)
+	return spread
+}
+
 func (p *Parser) parseIndex(lhs ast.Expression) ast.Expression {
+	defer p.nest()()
 	indexExpression := &ast.IndexExpression{
 		Token: p.currToken,
 		Lhs:   lhs,
@@ -411,6 +746,32 @@ func (p *Parser) parseIndex(lhs ast.Expression) ast.Expression {
 	return indexExpression
 }
 
+// parseOptionalIndex parse lhs?[index], which evaluates to null when lhs is null
+func (p *Parser) parseOptionalIndex(lhs ast.Expression) ast.Expression {
+	defer p.nest()()
+	indexExpression := &ast.IndexExpression{
+		Token:    p.currToken,
+		Lhs:      lhs,
+		Optional: true,
+	}
+	p.expect(token.OptionalIndex)
+	indexExpression.Index = p.parseExpression(LowestPrecedence)
+	p.expectPeek(token.RBRACKET)
+	return indexExpression
+}
+
+// parseOptionalChaining parse lhs?.name, which is a shorthand for lhs?["name"]
+func (p *Parser) parseOptionalChaining(lhs ast.Expression) ast.Expression {
+	indexExpression := &ast.IndexExpression{
+		Token:    p.currToken,
+		Lhs:      lhs,
+		Optional: true,
+	}
+	p.expectPeek(token.IDENTIFIER)
+	indexExpression.Index = &ast.StringLiteral{Token: p.currToken, Literal: p.currToken.Literal}
+	return indexExpression
+}
+
 func (p *Parser) parseExpressionList(terminalTokenType token.TokenType) []ast.Expression {
 	expressions := make([]ast.Expression, 0)
 	for !p.peekTokenIs(terminalTokenType) {
@@ -448,7 +809,7 @@ func (p *Parser) parseIfStmt() ast.Expression {
 
 func (p *Parser) parseInfixOperator(lhs ast.Expression) ast.Expression {
 	if p.tracing {
-		defer untrace(trace(fmt.Sprintf("parseInfixOperator : token [%s]", p.currToken.Literal)))
+		defer p.untrace(p.trace(fmt.Sprintf("parseInfixOperator : token [%s]", p.currToken.Literal)))
 	}
 	expr := &ast.InfixExpression{
 		Token:    p.currToken,
@@ -456,7 +817,7 @@ func (p *Parser) parseInfixOperator(lhs ast.Expression) ast.Expression {
 		Lhs:      lhs,
 	}
 
-	precedence := p.getPrecedence(p.currToken.Type)
+	precedence := p.precedenceOf(p.currToken)
 	p.nextToken()
 
 	expr.Rhs = p.parseExpression(precedence)
@@ -465,12 +826,14 @@ func (p *Parser) parseInfixOperator(lhs ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseCall(lhs ast.Expression) ast.Expression {
+	defer p.nest()()
 	call := &ast.CallExpression{
 		Token: p.currToken,
 		Fn:    lhs,
 	}
 	call.Arguments = p.parseExpressionList(token.RPAREN)
 	p.expectPeek(token.RPAREN)
+	call.End = p.currToken
 
 	return call
 }
@@ -495,7 +858,31 @@ func (p *Parser) parseFn() ast.Expression {
 	}
 	p.expectPeek(token.RPAREN)
 	p.expectPeek(token.LBRACE)
+	p.functions = append(p.functions, fn)
 	fn.Body = p.parseBlockStatement()
+	p.functions = p.functions[:len(p.functions)-1]
+	if fn.Generator {
+		markTail(fn.Body)
+	}
 
 	return fn
 }
+
+// markTail mark the yield spread which is the last statement of a generator body as a tail, see
+// ast.YieldStatement.Tail, and so are the last statements of the branches of an if expression which is the last one
+func markTail(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		return
+	}
+	switch stmt := block.Statements[len(block.Statements)-1].(type) {
+	case *ast.YieldStatement:
+		stmt.Tail = stmt.Spread
+	case *ast.ExpressionStatement:
+		if ifExpr, ok := stmt.Expr.(*ast.IfExpression); ok {
+			markTail(ifExpr.Consequence)
+			if ifExpr.Alternative != nil {
+				markTail(ifExpr.Alternative)
+			}
+		}
+	}
+}
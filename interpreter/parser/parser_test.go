@@ -6,6 +6,7 @@ import (
 	"0x822a5b87/monkey/interpreter/token"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -74,6 +75,182 @@ let foo_bar = 510;
 	}
 }
 
+func TestParseProgramResolves(t *testing.T) {
+	program := parseProgram("let f = fn(x) { x }")
+
+	fn := program.Statements[0].(*ast.LetStatement).Value.(*ast.FnLiteral)
+	x := fn.Body.Statements[0].(*ast.ExpressionStatement).Expr.(*ast.Identifier)
+	if depth, slot, ok := x.Binding(); !ok || depth != 0 || slot != 0 {
+		t.Fatalf("expected x to be resolved to the slot [0] of its frame, got [%d %d %t]", depth, slot, ok)
+	}
+}
+
+func TestOptionalSemicolons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 5\nx = 10\nreturn x",
+			"let x = 5; x = 10; return x;",
+		},
+		{
+			"let a = b\n[1, 2]",
+			"let a = b; [1, 2]",
+		},
+		{
+			"let a = b\n-1",
+			"let a = b; -1",
+		},
+		{
+			"let a = f\n(1)",
+			"let a = f; (1)",
+		},
+		{
+			"let a = 1 +\n2 *\n3",
+			"let a = 1 + 2 * 3;",
+		},
+		{
+			"let add = fn(a, b) {\n\tlet c = a + b\n\treturn c\n}\nadd(1, 2)",
+			"let add = fn(a, b) { let c = a + b; return c; }; add(1, 2)",
+		},
+		{
+			"let h = {\n\t\"one\": 1,\n\t\"two\": 2\n}\nh[\"one\"]",
+			"let h = {\"one\": 1, \"two\": 2}; h[\"one\"]",
+		},
+		{
+			"let xs = [\n\t1,\n\t2\n]\nlen(xs)",
+			"let xs = [1, 2]; len(xs)",
+		},
+		{
+			"if (x) {\n\t1\n}\nelse {\n\t2\n}\ny",
+			"if (x) { 1 } else { 2 }; y",
+		},
+		{
+			"let f = fn() { return 1 }; let g = fn() { 2 }",
+			"let f = fn() { return 1; }; let g = fn() { 2 };",
+		},
+		{
+			"let a = null ?? 1\nlet b = a?.c\nb",
+			"let a = null ?? 1; let b = a?.c; b",
+		},
+		// a line break doesn't end a statement before an operator, nor inside brackets
+		{
+			"let x = 1\n  + 2;",
+			"let x = 1 + 2;",
+		},
+		{
+			"let x = (1\n + 2);",
+			"let x = (1 + 2);",
+		},
+		// a line starting with ( is a new statement whether the statement ends with a semicolon or not
+		{
+			"let y = f\n(3); y",
+			"let y = f; (3); y",
+		},
+		{
+			"let f = add\n(1 + 2) * 3;",
+			"let f = add; (1 + 2) * 3",
+		},
+		{
+			"let f = add\n(1 + 2) * 3",
+			"let f = add; (1 + 2) * 3",
+		},
+		{
+			"let a = b\n?.c\n?.d;",
+			"let a = b?.c?.d;",
+		},
+		{
+			"f(fn() {\n\tlet a = 1\n\ta\n}, [\n\t1\n\t- 2\n])",
+			"f(fn() { let a = 1; a }, [1 - 2])",
+		},
+	}
+
+	for i, tt := range tests {
+		actual := parseProgram(tt.input).String()
+		expected := parseProgram(tt.expected).String()
+		if actual != expected {
+			t.Errorf("tests[%d] expected=%q, got=%q", i, expected, actual)
+		}
+	}
+}
+
+func TestInfixDeclaration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"infix 45 <+> (a, b) => a + b",
+			"infix 45 <+> (a, b) => (a + b)",
+		},
+		{
+			"infix 45 <+> (a, b) => a; 1 + 2 <+> 3 * 4",
+			"infix 45 <+> (a, b) => a(1 + (2 <+> (3 * 4)))",
+		},
+		{
+			"infix 45 <+> (a, b) => a; 1 <+> 2 <+> 3",
+			"infix 45 <+> (a, b) => a((1 <+> 2) <+> 3)",
+		},
+		{
+			"infixr 45 <+> (a, b) => a; 1 <+> 2 <+> 3",
+			"infixr 45 <+> (a, b) => a(1 <+> (2 <+> 3))",
+		},
+		{
+			// the precedence of a right associative operator is not lowered below the one of the operator next to it
+			"infixr 45 <+> (a, b) => a\ninfix 44 <-> (a, b) => a\n1 <+> 2 <-> 3 <+> 4 <+> 5",
+			"infixr 45 <+> (a, b) => ainfix 44 <-> (a, b) => a((1 <+> 2) <-> (3 <+> (4 <+> 5)))",
+		},
+		{
+			"infixr 44 <-> (a, b) => a\ninfixr 45 <+> (a, b) => a\n1 <-> 2 <+> 3 <-> 4",
+			"infixr 44 <-> (a, b) => ainfixr 45 <+> (a, b) => a(1 <-> ((2 <+> 3) <-> 4))",
+		},
+		{
+			"infix 15 |> (x, f) => f(x)\nxs |> len == 1",
+			"infix 15 |> (x, f) => f(x)(xs |> (len == 1))",
+		},
+		{
+			"infix 25 |> (x, f) => f(x)\nxs |> len == 1",
+			"infix 25 |> (x, f) => f(x)((xs |> len) == 1)",
+		},
+	}
+
+	for i, tt := range tests {
+		actual := parseProgram(tt.input).String()
+		if actual != tt.expected {
+			t.Errorf("tests[%d] expected=%q, got=%q", i, tt.expected, actual)
+		}
+	}
+}
+
+func TestInfixDeclarationOfPreviousSource(t *testing.T) {
+	operators := NewOperators()
+	if _, err := ParseWithOperators("infixr 45 <+> (a, b) => a * 10 + b", operators); err != nil {
+		t.Fatalf("unexpected error [%s]", err)
+	}
+	program, err := ParseWithOperators("1 <+> 2 <+> 3", operators)
+	if err != nil {
+		t.Fatalf("unexpected error [%s]", err)
+	}
+	if program.String() != "(1 <+> (2 <+> 3))" {
+		t.Fatalf("expected=%q, got=%q", "(1 <+> (2 <+> 3))", program.String())
+	}
+
+	// the operators are only known to the sources parsed with the same table
+	if _, err = Parse("1 <+> 2"); err == nil {
+		t.Fatalf("expected a syntax error for an undeclared operator")
+	}
+}
+
+func TestMissingSemicolon(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected a syntax error for two statements on the same line")
+		}
+	}()
+	parseProgram("let x = 5 let y = 10")
+}
+
 func TestReturnStatement(t *testing.T) {
 	input := `
 return 5;
@@ -397,6 +574,66 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"null",
+			"null",
+		},
+		{
+			"a ?? b ?? c",
+			"((a ?? b) ?? c)",
+		},
+		{
+			"a ?? b == c",
+			"(a ?? (b == c))",
+		},
+		{
+			"a?.b?[1 + 2]",
+			"((a?.b)?[(1 + 2)])",
+		},
+		{
+			"a?[0] ?? -b[1]",
+			"((a?[0]) ?? (-(b[1])))",
+		},
+		{
+			"f(a)?.b",
+			"(f(a)?.b)",
+		},
+		{
+			"[...a, b + c, ...f(d)]",
+			"[...a, (b + c), ...f(d)]",
+		},
+		{
+			"add(...args, a * b)",
+			"add(...args, (a * b))",
+		},
+		{
+			"{...defaults}",
+			"{...defaults}",
+		},
+		{
+			"[x * 2 for x in xs if x > 0]",
+			"[(x * 2) for x in xs if (x > 0)]",
+		},
+		{
+			"[f(x) for x in [y for y in ys]]",
+			"[f(x) for x in [y for y in ys]]",
+		},
+		{
+			"{k: v + 1 for [k, v] in pairs}",
+			"{k:(v + 1) for [k, v] in pairs}",
+		},
+		{
+			"#{1, a + b, ...xs}",
+			"#{1, (a + b), ...xs}",
+		},
+		{
+			"a + 1 in b == !c in #{}",
+			"(((a + 1) in b) == ((!c) in #{}))",
+		},
+		{
+			"[x for x in xs if x in ys]",
+			"[x for x in xs if (x in ys)]",
+		},
 	}
 
 	for _, tt := range tests {
@@ -687,6 +924,94 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingOptionalChaining(t *testing.T) {
+	input := `user?.name`
+	program := parseProgram(input)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expr.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expr)
+	}
+
+	if !indexExp.Optional {
+		t.Fatalf("exp is expected to be optional")
+	}
+
+	if !testIdentifier(t, indexExp.Lhs, "user") {
+		return
+	}
+
+	name, ok := indexExp.Index.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("index not *ast.StringLiteral. got=%T", indexExp.Index)
+	}
+	if name.Literal != "name" {
+		t.Fatalf("index expected [%s], got [%s]", "name", name.Literal)
+	}
+}
+
+func TestParsingComprehensions(t *testing.T) {
+	input := `{k: v for [k, v] in pairs if v}`
+	program := parseProgram(input)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	comprehension, ok := stmt.Expr.(*ast.HashComprehension)
+	if !ok {
+		t.Fatalf("exp not *ast.HashComprehension. got=%T", stmt.Expr)
+	}
+
+	clause := comprehension.Clause
+	if !clause.Destructure || len(clause.Targets) != 2 {
+		t.Fatalf("clause expected to destructure into 2 targets, got [%s]", clause.String())
+	}
+	if !testIdentifier(t, clause.Targets[0], "k") || !testIdentifier(t, clause.Targets[1], "v") {
+		return
+	}
+	if !testIdentifier(t, clause.Iterable, "pairs") || !testIdentifier(t, clause.Condition, "v") {
+		return
+	}
+}
+
+func TestParsingGenerators(t *testing.T) {
+	tests := []struct {
+		input     string
+		generator bool
+		tail      bool
+	}{
+		{"fn(xs) { yield 1; yield ...xs; }", true, true},
+		{"fn(xs) { yield ...xs; 1 }", true, false},
+		{"fn(xs) { if (xs) { yield ...xs } }", true, true},
+		{"fn(xs) { fn() { yield xs } }", false, false},
+	}
+
+	for i, tt := range tests {
+		stmt := parseProgram(tt.input).Statements[0].(*ast.ExpressionStatement)
+		fn := stmt.Expr.(*ast.FnLiteral)
+		if fn.Generator != tt.generator {
+			t.Errorf("tests[%d] expected generator [%t], got [%t]", i, tt.generator, fn.Generator)
+		}
+
+		tail := false
+		ast.Inspect(fn, func(node ast.Node) bool {
+			if yield, ok := node.(*ast.YieldStatement); ok && yield.Tail {
+				tail = true
+			}
+			return true
+		})
+		if tail != tt.tail {
+			t.Errorf("tests[%d] expected tail spread [%t], got [%t]", i, tt.tail, tail)
+		}
+	}
+}
+
+func TestYieldOutsideFunction(t *testing.T) {
+	_, err := Parse("yield 1;")
+	if err == nil || !strings.Contains(err.Error(), "yield outside of a function") {
+		t.Fatalf("expected a syntax error for yield outside of a function, got [%v]", err)
+	}
+}
+
 func TestParsingEmptyHashLiteral(t *testing.T) {
 	input := "{}"
 
@@ -724,7 +1049,8 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
@@ -736,6 +1062,27 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	}
 }
 
+func TestParsingHashLiteralsKeepSourceOrder(t *testing.T) {
+	input := `{"b": 1, "a": 2, ...c, "a": 3}`
+	program := parseProgram(input)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expr.(*ast.HashExpression)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expr)
+	}
+
+	expected := []string{`b:1`, `a:2`, `...c`, `a:3`}
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+	for i, pair := range hash.Pairs {
+		if pair.String() != expected[i] {
+			t.Errorf("pair [%d] expected=%q, got=%q", i, expected[i], pair.String())
+		}
+	}
+}
+
 func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
 	input := `{true: 1, false: 2}`
 
@@ -756,7 +1103,8 @@ func TestParsingHashLiteralsBooleanKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		boolean, ok := key.(*ast.BooleanExpression)
 		if !ok {
 			t.Errorf("key is not ast.BooleanLiteral. got=%T", key)
@@ -788,7 +1136,8 @@ func TestParsingHashLiteralsIntegerKeys(t *testing.T) {
 		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		integer, ok := key.(*ast.IntegerLiteral)
 		if !ok {
 			t.Errorf("key is not ast.IntegerLiteral. got=%T", key)
@@ -827,7 +1176,8 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		},
 	}
 
-	for key, value := range hash.Pairs {
+	for _, pair := range hash.Pairs {
+		key, value := pair.Key, pair.Value
 		literal, ok := key.(*ast.StringLiteral)
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
@@ -5,37 +5,33 @@ import (
 	"strings"
 )
 
-var traceLevel int = 0
-
-var line int = 0
-
 const traceIdentPlaceholder string = "\t"
 
-func identLevel() string {
-	return fmt.Sprintf("%3d %s", line, strings.Repeat(traceIdentPlaceholder, traceLevel-1))
+func (p *Parser) identLevel() string {
+	return fmt.Sprintf("%3d %s", p.traceLine, strings.Repeat(traceIdentPlaceholder, p.traceLevel-1))
 }
 
-func tracePrint(fs string) {
-	fmt.Printf("%s%s\n", identLevel(), fs)
+func (p *Parser) tracePrint(fs string) {
+	fmt.Printf("%s%s\n", p.identLevel(), fs)
 }
 
-func incIdent() {
-	traceLevel = traceLevel + 1
+func (p *Parser) incIdent() {
+	p.traceLevel = p.traceLevel + 1
 }
 
-func decIdent() {
-	traceLevel = traceLevel - 1
+func (p *Parser) decIdent() {
+	p.traceLevel = p.traceLevel - 1
 }
 
-func trace(msg string) string {
-	incIdent()
-	tracePrint(fmt.Sprintf("BEGIN %s", msg))
-	line++
+func (p *Parser) trace(msg string) string {
+	p.incIdent()
+	p.tracePrint(fmt.Sprintf("BEGIN %s", msg))
+	p.traceLine++
 	return msg
 }
 
-func untrace(msg string) {
-	tracePrint(fmt.Sprintf("END %s", msg))
-	line++
-	decIdent()
+func (p *Parser) untrace(msg string) {
+	p.tracePrint(fmt.Sprintf("END %s", msg))
+	p.traceLine++
+	p.decIdent()
 }
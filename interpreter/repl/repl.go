@@ -1,30 +1,25 @@
 package repl
 
 import (
-	"0x822a5b87/monkey/compiler/compiler"
-	"0x822a5b87/monkey/compiler/vm"
 	"0x822a5b87/monkey/interpreter/ast"
-	"0x822a5b87/monkey/interpreter/evaluator"
-	"0x822a5b87/monkey/interpreter/lexer"
+	"0x822a5b87/monkey/interpreter/engine"
 	"0x822a5b87/monkey/interpreter/object"
-	"0x822a5b87/monkey/interpreter/parser"
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
 )
 
 const PROMPT = ">> "
-const Interpreter = "i"
-const Compiler = "c"
-
-var c *compiler.Compiler
-var v *vm.Vm
+const Interpreter = string(engine.Interpreter)
+const Compiler = string(engine.Compiler)
 
 func Start(typed string, in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment(nil)
+	runtime := engine.New(engine.Kind(typed))
 
 	for {
 		fmt.Print(PROMPT)
@@ -34,68 +29,33 @@ func Start(typed string, in io.Reader, out io.Writer) {
 			return
 		}
 
-		l := lexer.NewLexer(sourceCode)
-
-		p := parser.NewParser(*l)
-		program := p.ParseProgram()
+		// the operators declared by the previous inputs are kept by the runtime along with the bindings
+		program, err := runtime.Parse(sourceCode)
+		if err != nil {
+			silentWrite(out, err.Error()+"\n")
+			continue
+		}
 		for _, stmt := range program.Statements {
-			switch typed {
-			case Interpreter:
-				interpret(out, stmt, env)
-			case Compiler:
-				compile(out, stmt)
-			}
+			run(out, runtime, stmt)
 		}
 	}
 }
 
-func compile(out io.Writer, stmt ast.Statement) {
-	newCompiler()
-	err := c.Compile(stmt)
-	if err != nil {
+// run run the statement and print its value, or the error with its traceback
+func run(out io.Writer, runtime *engine.Runtime, stmt ast.Statement) {
+	obj, err := runtime.Run(context.Background(), stmt)
+	var evalErr *object.Error
+	switch {
+	case errors.As(err, &evalErr):
+		silentWrite(out, evalErr.Traceback())
+	case err != nil:
 		silentWrite(out, err.Error())
-		silentWrite(out, "\n")
-		return
+	default:
+		silentWrite(out, obj.Inspect())
 	}
-	newVm(c.ByteCode())
-	err = v.Run()
-	if err != nil {
-		silentWrite(out, err.Error())
-		silentWrite(out, "\n")
-		return
-	}
-
-	stackTop := v.TestOnlyLastPoppedStackElement()
-
-	silentWrite(out, stackTop.Inspect())
 	silentWrite(out, "\n")
 }
 
-func newCompiler() {
-	if c == nil {
-		c = compiler.NewCompiler()
-	} else {
-		c = compiler.NewCompilerWithState(c)
-	}
-}
-
-func newVm(code *compiler.ByteCode) {
-	if v == nil {
-		v = vm.NewVm(code)
-	} else {
-		v = vm.NewVmWithState(code, v)
-	}
-}
-
-func interpret(out io.Writer, stmt ast.Statement, env *object.Environment) {
-	obj := evaluator.Eval(stmt, env)
-	_, err := io.WriteString(out, obj.Inspect())
-	fmt.Println()
-	if err != nil {
-		fmt.Println(err.Error())
-	}
-}
-
 func readSourceCode(scanner *bufio.Scanner) string {
 	buffer := bytes.Buffer{}
 	for {
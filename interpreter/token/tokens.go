@@ -6,6 +6,14 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	// NewLine reports whether there is a line break between this token and the previous one,
+	// it's what allows a statement to be terminated by the end of line instead of a semicolon.
+	NewLine bool
+	// BlankLine reports whether there is an empty line between this token and the previous token or comment
+	BlankLine bool
+	// Line and Column the 1-based position of the first char of the token
+	Line   int
+	Column int
 }
 
 var keywords = map[string]TokenType{
@@ -16,12 +24,19 @@ var keywords = map[string]TokenType{
 	"false":  FALSE,
 	"if":     IF,
 	"else":   ELSE,
+	"null":   NULL,
+	"for":    FOR,
+	"in":     IN,
+	"infix":  INFIX,
+	"infixr": INFIXR,
+	"yield":  YIELD,
 }
 
 // system info
 const (
 	ILLEGAL TokenType = "ILLEGAL" // signifies a token/character we don't know
 	EOF     TokenType = "EOF"     // end of file
+	COMMENT TokenType = "COMMENT" // a line comment, it's never returned by the lexer but kept aside for tools
 )
 
 // identifiers and literals
@@ -43,6 +58,12 @@ const (
 	LT       TokenType = "<"
 	EQ       TokenType = "=="
 	NotEq    TokenType = "!="
+
+	NullCoalescing   TokenType = "??"
+	OptionalChaining TokenType = "?."
+	OptionalIndex    TokenType = "?["
+	// OPERATOR a user-defined infix operator declared by `infix 45 <+> (a, b) => ...`, the literal is the symbol
+	OPERATOR TokenType = "OPERATOR"
 )
 
 // delimiters
@@ -50,6 +71,8 @@ const (
 	COMMA     TokenType = ","
 	SEMICOLON TokenType = ";"
 	COLON     TokenType = ":"
+	ELLIPSIS  TokenType = "..."
+	ARROW     TokenType = "=>"
 
 	LPAREN   TokenType = "("
 	RPAREN   TokenType = ")"
@@ -57,6 +80,8 @@ const (
 	RBRACKET TokenType = "]"
 	LBRACE   TokenType = "{"
 	RBRACE   TokenType = "}"
+	// SetLBrace opens a set literal #{1, 2, 3}, which is closed by RBRACE
+	SetLBrace TokenType = "#{"
 )
 
 // preserved keywords
@@ -68,8 +93,17 @@ const (
 	FALSE    TokenType = "FALSE"
 	IF       TokenType = "IF"
 	ELSE     TokenType = "ELSE"
+	NULL     TokenType = "NULL"
+	FOR      TokenType = "FOR"
+	IN       TokenType = "IN"
+	INFIX    TokenType = "INFIX"
+	INFIXR   TokenType = "INFIXR"
+	YIELD    TokenType = "YIELD"
 )
 
+// InOperator the membership test `x in collection` is spelled as the keyword in
+const InOperator = "in"
+
 func LookupIdentifier(identifier string) TokenType {
 	if tok, ok := keywords[identifier]; ok {
 		return tok